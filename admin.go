@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maxAdminBodyBytes is the size JSON request bodies of the admin API are limited to
+const maxAdminBodyBytes = 1 << 20
+
+// AdminHandler exposes an HTTP API to inspect and adjust tenant rules at runtime:
+//
+//	GET   /tenants                      list tenants
+//	GET   /disabled-rules               rules disabled at runtime, with the violations they kept out of results
+//	PUT   /disabled-rules               disable a rule, see DisabledRule
+//	DELETE /disabled-rules              enable a disabled rule again
+//	GET   /tenants/{id}/rules           tenant rules, with their version as ETag
+//	PUT   /tenants/{id}/rules           replace tenant rules, requires If-Match
+//	PATCH /tenants/{id}/rules           merge tenant rules, requires If-Match, an empty rule removes it
+//	GET   /tenants/{id}/expressions     expression rules of the tenant, with the version of the tenant rules as ETag
+//	PUT   /tenants/{id}/expressions     replace expression rules, requires If-Match
+//	GET   /tenants/{id}/rules/{entity}  effective rules of POCUser or a registered entity, ex: Address
+//	GET   /tenants/{id}/rules/{entity}/origins  where each effective rule of an entity comes from
+//	GET   /tenants/{id}/schema/{entity} JSON Schema of an entity, titles follow Accept-Language
+//	POST  /tenants/{id}/validate        validate a sample POCUser, messages follow Accept-Language
+//	GET   /tenants/{id}/versions        history of the tenant rules
+//	GET   /tenants/{id}/versions/diff   changes of every kind of rules between ?from= and ?to= versions
+//	POST  /tenants/{id}/versions/{n}/rollback  re-activate version n, requires If-Match
+//
+// Every request must carry the admin token as a bearer token, "Authorization: Bearer <token>". JSON bodies are limited to maxAdminBodyBytes.
+// Changes are recorded under the author given by the X-Admin-User header.
+type AdminHandler struct {
+	vp    *POCDefaultValidationProvider
+	token string
+}
+
+// NewAdminHandler returns an AdminHandler authenticating requests with the given token
+func NewAdminHandler(vp *POCDefaultValidationProvider, token string) *AdminHandler {
+	return &AdminHandler{vp: vp, token: token}
+}
+
+type adminTenant struct {
+	ID           string `json:"id"`
+	DisplayName  string `json:"displayName,omitempty"`
+	Parent       string `json:"parent,omitempty"`
+	Enabled      *bool  `json:"enabled,omitempty"`
+	RulesVersion int    `json:"rulesVersion"`
+}
+
+type adminRules struct {
+	Version     int               `json:"version"`
+	Rules       map[string]string `json:"rules"`
+	Expressions []ExpressionRule  `json:"expressions,omitempty"`
+}
+
+type adminValidation struct {
+	Valid      bool        `json:"valid"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// adminDisabledRule is a rule to disable or enable, the tenant is referenced by ID or alias, empty for all tenants
+type adminDisabledRule struct {
+	Entity string `json:"entity"`
+	Field  string `json:"field"`
+	Tag    string `json:"tag"`
+	Tenant string `json:"tenant,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type adminError struct {
+	Error    string   `json:"error"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authenticated(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeAdminError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 1 && parts[0] == "tenants" {
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodGet: h.listTenants})
+		return
+	}
+	if len(parts) == 1 && parts[0] == "disabled-rules" {
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+				writeAdminJSON(w, http.StatusOK, h.vp.DisabledRules())
+			},
+			http.MethodPut:    func(w http.ResponseWriter, r *http.Request) { h.switchRule(w, r, true) },
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) { h.switchRule(w, r, false) },
+		})
+		return
+	}
+	if len(parts) < 3 || parts[0] != "tenants" {
+		writeAdminError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	// rules of disabled tenants are managed like any other, unknown tenants are not resolved by the policy
+	key, err := h.vp.configuredTenantKey(parts[1])
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	tenant := h.vp.tenantIDOf(key)
+
+	switch {
+	case len(parts) == 3 && parts[2] == "rules":
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet:   func(w http.ResponseWriter, r *http.Request) { h.getRules(w, tenant) },
+			http.MethodPut:   func(w http.ResponseWriter, r *http.Request) { h.updateRules(w, r, tenant, false) },
+			http.MethodPatch: func(w http.ResponseWriter, r *http.Request) { h.updateRules(w, r, tenant, true) },
+		})
+	case len(parts) == 3 && parts[2] == "expressions":
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) { h.getRules(w, tenant) },
+			http.MethodPut: func(w http.ResponseWriter, r *http.Request) { h.updateExpressions(w, r, tenant) },
+		})
+	case len(parts) == 4 && parts[2] == "rules":
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) { h.getEffectiveRules(w, tenant, parts[3]) },
+		})
+	case len(parts) == 5 && parts[2] == "rules" && parts[4] == "origins":
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) { h.getRuleOrigins(w, tenant, parts[3]) },
+		})
+	case len(parts) == 4 && parts[2] == "schema":
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) { h.getSchema(w, r, tenant, parts[3]) },
+		})
+	case len(parts) == 3 && parts[2] == "validate":
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request) { h.validateSample(w, r, tenant) },
+		})
+	case len(parts) == 3 && parts[2] == "versions":
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+				history, err := h.vp.TenantRuleHistory(tenant)
+				if err != nil {
+					writeAdminError(w, http.StatusNotFound, err)
+					return
+				}
+				writeAdminJSON(w, http.StatusOK, history)
+			},
+		})
+	case len(parts) == 4 && parts[2] == "versions" && parts[3] == "diff":
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) { h.diffVersions(w, r, tenant) },
+		})
+	case len(parts) == 5 && parts[2] == "versions" && parts[4] == "rollback":
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request) { h.rollback(w, r, tenant, parts[3]) },
+		})
+	default:
+		writeAdminError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (h *AdminHandler) authenticated(r *http.Request) bool {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(authorization, "Bearer ")
+	return len(h.token) > 0 && subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+func (h *AdminHandler) route(w http.ResponseWriter, r *http.Request, handlers map[string]http.HandlerFunc) {
+	handler, ok := handlers[r.Method]
+	if !ok {
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	handler(w, r)
+}
+
+func (h *AdminHandler) listTenants(w http.ResponseWriter, _ *http.Request) {
+	tenants := make([]adminTenant, 0)
+	for _, key := range h.vp.tenantKeys() {
+		_, version := h.vp.tenantRulesOf(key)
+		tenant := adminTenant{ID: h.vp.tenantIDOf(key), RulesVersion: version}
+		if h.vp.tenants != nil {
+			if t, ok := h.vp.tenants.byKeyOf(key); ok {
+				tenant.DisplayName, tenant.Parent, tenant.Enabled = t.DisplayName, t.Parent, &t.Enabled
+			}
+		}
+		tenants = append(tenants, tenant)
+	}
+	writeAdminJSON(w, http.StatusOK, tenants)
+}
+
+// switchRule disables or enables again the rule of the request body
+func (h *AdminHandler) switchRule(w http.ResponseWriter, r *http.Request, disable bool) {
+	var body adminDisabledRule
+	if !decodeAdminBody(w, r, &body) {
+		return
+	}
+	rule, err := h.vp.disabledRuleTenant(DisabledRule{Entity: body.Entity, Field: body.Field, Tag: body.Tag, Tenant: body.Tenant})
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	if !disable {
+		if !h.vp.EnableRule(rule) {
+			writeAdminError(w, http.StatusNotFound, errors.New("rule is not disabled"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := h.vp.DisableRule(rule, body.Reason, adminAuthor(r)); err != nil {
+		writeAdminError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, h.vp.DisabledRules())
+}
+
+func (h *AdminHandler) getRules(w http.ResponseWriter, tenant string) {
+	rules, version, err := h.vp.TenantRules(tenant)
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	expressions, err := h.vp.TenantExpressionRules(tenant)
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	w.Header().Set("ETag", rulesETag(version))
+	writeAdminJSON(w, http.StatusOK, adminRules{Version: version, Rules: rules, Expressions: expressions})
+}
+
+// entityNamed returns a value of the entity type named in a path, writing an error response when it is unknown
+func (h *AdminHandler) entityNamed(w http.ResponseWriter, name string) (any, bool) {
+	t, ok := h.vp.entityNamed(name)
+	if !ok {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("unknown entity %q", name))
+		return nil, false
+	}
+	return reflect.Zero(t).Interface(), true
+}
+
+func (h *AdminHandler) getEffectiveRules(w http.ResponseWriter, tenant string, name string) {
+	entity, ok := h.entityNamed(w, name)
+	if !ok {
+		return
+	}
+	_, version, err := h.vp.TenantRules(tenant)
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	var rules map[string]string
+	if _, user := entity.(POCUser); user {
+		rules, err = h.vp.EffectiveUserRules(tenant)
+	} else {
+		rules, err = h.vp.EffectiveEntityRules(tenant, entity)
+	}
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	w.Header().Set("ETag", rulesETag(version))
+	writeAdminJSON(w, http.StatusOK, adminRules{Version: version, Rules: rules})
+}
+
+func (h *AdminHandler) getRuleOrigins(w http.ResponseWriter, tenant string, name string) {
+	entity, ok := h.entityNamed(w, name)
+	if !ok {
+		return
+	}
+	var origins []RuleOrigin
+	var err error
+	if _, user := entity.(POCUser); user {
+		origins, err = h.vp.UserRuleOrigins(tenant)
+	} else {
+		origins, err = h.vp.EntityRuleOrigins(tenant, entity)
+	}
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, origins)
+}
+
+func (h *AdminHandler) getSchema(w http.ResponseWriter, r *http.Request, tenant string, name string) {
+	entity, ok := h.entityNamed(w, name)
+	if !ok {
+		return
+	}
+	var schema map[string]interface{}
+	var err error
+	if _, user := entity.(POCUser); user {
+		schema, err = h.vp.UserJSONSchema(tenant, acceptedLanguage(r))
+	} else {
+		schema, err = h.vp.EntityJSONSchema(tenant, entity, acceptedLanguage(r))
+	}
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(schema)
+}
+
+// acceptedLanguage returns the first language accepted by the request, ex: fr-CA for fr-CA,fr;q=0.9,en;q=0.8
+func acceptedLanguage(r *http.Request) string {
+	language, _, _ := strings.Cut(r.Header.Get("Accept-Language"), ",")
+	language, _, _ = strings.Cut(language, ";")
+	return strings.TrimSpace(language)
+}
+
+// ifMatchVersion returns the rules version of the If-Match header, writing an error response when it is not usable
+func ifMatchVersion(w http.ResponseWriter, r *http.Request) (int, bool) {
+	ifMatch := r.Header.Get("If-Match")
+	if len(ifMatch) == 0 {
+		writeAdminError(w, http.StatusPreconditionRequired, errors.New("If-Match header is required"))
+		return 0, false
+	}
+	version, err := strconv.Atoi(strings.Trim(ifMatch, `"`))
+	if err != nil {
+		writeAdminError(w, http.StatusPreconditionFailed, fmt.Errorf("invalid If-Match %q", ifMatch))
+		return 0, false
+	}
+	return version, true
+}
+
+// adminAuthor returns the author changes are recorded under
+func adminAuthor(r *http.Request) string {
+	if author := r.Header.Get("X-Admin-User"); len(author) > 0 {
+		return author
+	}
+	return "admin"
+}
+
+func (h *AdminHandler) updateRules(w http.ResponseWriter, r *http.Request, tenant string, patch bool) {
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	var rules map[string]string
+	if !decodeAdminBody(w, r, &rules) {
+		return
+	}
+
+	var err error
+	if patch {
+		_, err = h.vp.PatchTenantRules(tenant, version, adminAuthor(r), rules)
+	} else {
+		_, err = h.vp.UpdateTenantRules(tenant, version, adminAuthor(r), rules)
+	}
+	h.writeRulesUpdate(w, tenant, err)
+}
+
+func (h *AdminHandler) updateExpressions(w http.ResponseWriter, r *http.Request, tenant string) {
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	var expressions []ExpressionRule
+	if !decodeAdminBody(w, r, &expressions) {
+		return
+	}
+	_, err := h.vp.UpdateTenantExpressionRules(tenant, version, adminAuthor(r), expressions)
+	h.writeRulesUpdate(w, tenant, err)
+}
+
+func (h *AdminHandler) rollback(w http.ResponseWriter, r *http.Request, tenant string, target string) {
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	targetVersion, err := strconv.Atoi(target)
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("invalid version %q", target))
+		return
+	}
+	_, err = h.vp.RollbackTenantRules(tenant, version, targetVersion, adminAuthor(r))
+	h.writeRulesUpdate(w, tenant, err)
+}
+
+func (h *AdminHandler) diffVersions(w http.ResponseWriter, r *http.Request, tenant string) {
+	from, errFrom := strconv.Atoi(r.URL.Query().Get("from"))
+	to, errTo := strconv.Atoi(r.URL.Query().Get("to"))
+	if errFrom != nil || errTo != nil {
+		writeAdminError(w, http.StatusBadRequest, errors.New("from and to versions are required"))
+		return
+	}
+	changes, err := h.vp.DiffTenantRules(tenant, from, to)
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, changes)
+}
+
+// writeRulesUpdate writes the response of a rules update: the new rules or the reason of the failure
+func (h *AdminHandler) writeRulesUpdate(w http.ResponseWriter, tenant string, err error) {
+	var lintErr *RuleLintError
+	switch {
+	case errors.Is(err, ErrVersionConflict):
+		writeAdminError(w, http.StatusPreconditionFailed, err)
+		return
+	case errors.Is(err, ErrUnknownRuleVersion):
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	case errors.As(err, &lintErr):
+		writeAdminJSON(w, http.StatusUnprocessableEntity, adminError{Error: "invalid rules", Problems: lintErr.Problems})
+		return
+	case err != nil:
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.getRules(w, tenant)
+}
+
+func (h *AdminHandler) validateSample(w http.ResponseWriter, r *http.Request, tenant string) {
+	var user POCUser
+	if !decodeAdminBody(w, r, &user) {
+		return
+	}
+	ctx := context.WithValue(r.Context(), "tenant", tenant)
+	ctx = context.WithValue(ctx, "locale", acceptedLanguage(r))
+	err := h.vp.ValidateUserWithRulesValidation(ctx, user)
+	if errors.Is(err, ErrTenantDisabled) {
+		writeAdminError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil && validationOutcome(err) == outcomeError {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, adminValidation{Valid: err == nil, Violations: h.vp.RedactionPolicy().Violations(err)})
+}
+
+// rulesETag returns the ETag of a tenant rules version
+func rulesETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// decodeAdminBody decodes the JSON body of a request into v, limited to maxAdminBodyBytes.
+// When it fails, the error is written and false returned.
+func decodeAdminBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)).Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeAdminError(w, http.StatusRequestEntityTooLarge, err)
+	case err != nil:
+		writeAdminError(w, http.StatusBadRequest, err)
+	}
+	return err == nil
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeAdminJSON(w, status, adminError{Error: err.Error()})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func adminRequest(t *testing.T, h http.Handler, method, path, ifMatch, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer secret")
+	if len(ifMatch) > 0 {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestAdminHandler(t *testing.T) {
+	store := NewFileRuleStore(filepath.Join(t.TempDir(), "rules.json"))
+	vp := newTestProvider()
+	assert.NoError(t, vp.SetRuleStore(store))
+	h := NewAdminHandler(vp, "secret")
+
+	// authentication
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tenants", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// the token alone is not a bearer token
+	r := httptest.NewRequest(http.MethodGet, "/tenants", nil)
+	r.Header.Set("Authorization", "secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = adminRequest(t, h, http.MethodGet, "/tenants", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"id":"1","rulesVersion":0},{"id":"2","rulesVersion":0}]`, w.Body.String())
+
+	// optimistic concurrency
+	w = adminRequest(t, h, http.MethodPut, "/tenants/2/rules", "", `{"FirstName":"max=5"}`)
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	w = adminRequest(t, h, http.MethodPut, "/tenants/2/rules", `"3"`, `{"FirstName":"max=5"}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = adminRequest(t, h, http.MethodPut, "/tenants/2/rules", `"0"`, `{"FirstName":"max=5"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	// linting
+	w = adminRequest(t, h, http.MethodPatch, "/tenants/2/rules", `"1"`, `{"Unknown":"required","LastName":"required","Phone":"isprovincename"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "Unknown: unknown field")
+	assert.Contains(t, w.Body.String(), "LastName: field of an embedded struct")
+	assert.Contains(t, w.Body.String(), "Phone: Undefined validation function 'isprovincename'")
+
+	w = adminRequest(t, h, http.MethodPatch, "/tenants/2/rules", `"1"`, `{"Phone":"e164"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"version":2,"rules":{"FirstName":"max=5","Phone":"e164"}}`, w.Body.String())
+
+	w = adminRequest(t, h, http.MethodGet, "/tenants/2/rules/POCUser", "", "")
+	var effective adminRules
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &effective))
+	assert.Equal(t, "max=10,max=5", effective.Rules["FirstName"])
+	assert.Equal(t, "min=18", effective.Rules["Age"])
+
+	// registered entities are served like POCUser
+	w = adminRequest(t, h, http.MethodGet, "/tenants/2/rules/Address", "", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, Register[Address](vp, EntityRules{Rules: map[string]string{"ZipCode": "required"}},
+		map[string]EntityRules{"2": {Rules: map[string]string{"Province": "isprovincecode"}}}))
+	w = adminRequest(t, h, http.MethodGet, "/tenants/2/rules/Address", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"version":2,"rules":{"ZipCode":"required","Province":"isprovincecode"}}`, w.Body.String())
+	w = adminRequest(t, h, http.MethodGet, "/tenants/2/rules/Address/origins", "", "")
+	assert.JSONEq(t, `[{"field":"Province","rule":"isprovincecode","source":"tenant 2 registration"},
+		{"field":"ZipCode","rule":"required","source":"registration"}]`, w.Body.String())
+	w = adminRequest(t, h, http.MethodGet, "/tenants/2/schema/Address", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"x-rules":"isprovincecode"`)
+
+	w = adminRequest(t, h, http.MethodPost, "/tenants/2/validate", "", `{"FIRSTNAME":"Samantha","myAge":"25","Email":"sam@mail.com","Phone":"555"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var validation adminValidation
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &validation))
+	assert.False(t, validation.Valid)
+	assert.Len(t, validation.Violations, 2) // FirstName and Phone
+	assertNoPII(t, []string{"sam@mail.com"}, w.Body.String())
+
+	// rules are persisted
+	reloaded := newTestProvider()
+	assert.NoError(t, reloaded.SetRuleStore(store))
+	rules, version, err := reloaded.TenantRules("2")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+	assert.Equal(t, map[string]string{"FirstName": "max=5", "Phone": "e164"}, rules)
+}
+
+func TestAdminServed(t *testing.T) {
+	vp := newTestProvider()
+	mux := newServeMux(vp, "secret")
+	w := adminRequest(t, mux, http.MethodGet, "/admin/tenants", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"id":"1","rulesVersion":0},{"id":"2","rulesVersion":0}]`, w.Body.String())
+	w = adminRequest(t, newServeMux(vp, ""), http.MethodGet, "/admin/tenants", "", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// bodies are limited
+	w = adminRequest(t, mux, http.MethodPut, "/admin/tenants/2/rules", `"0"`, `{"FirstName":"`+strings.Repeat("a", maxAdminBodyBytes)+`"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	w = adminRequest(t, mux, http.MethodPost, "/admin/tenants/2/validate", "", `{"FIRSTNAME":`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	_, version, err := vp.TenantRules("2")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// DefaultAsyncTimeout is the timeout applied to an asynchronous validator registered without one
+const DefaultAsyncTimeout = time.Second
+
+// DefaultAsyncCacheSize is the number of asynchronous validation results cached unless set otherwise
+const DefaultAsyncCacheSize = 10000
+
+// asyncUnavailable is the param reported on a violation when an asynchronous validator could not complete
+const asyncUnavailable = "unavailable"
+
+// AsyncValidator validates an entity with checks requiring I/O (ex: unique email per tenant, account ID exists).
+// Asynchronous validators only run once the synchronous rules pass, concurrently, each with its own timeout.
+type AsyncValidator interface {
+	// Tag is the rule name reported on violation
+	Tag() string
+	// Field is the struct field the violation is reported on
+	Field() string
+	// CacheKey returns the key the result is cached under for the tenant, tag and field, an empty key disables caching
+	CacheKey(entity any) string
+	// Validate returns whether the entity is valid, an error means the check could not be done
+	Validate(ctx context.Context, entity any) (bool, error)
+}
+
+// AsyncValidatorFunc adapts a function to the AsyncValidator interface
+type AsyncValidatorFunc struct {
+	tag   string
+	field string
+	key   func(entity any) string
+	fn    func(ctx context.Context, entity any) (bool, error)
+}
+
+// NewAsyncValidator returns an AsyncValidator running fn, key may be nil to disable caching
+func NewAsyncValidator(tag, field string, key func(entity any) string, fn func(ctx context.Context, entity any) (bool, error)) *AsyncValidatorFunc {
+	return &AsyncValidatorFunc{tag: tag, field: field, key: key, fn: fn}
+}
+
+func (v *AsyncValidatorFunc) Tag() string {
+	return v.tag
+}
+
+func (v *AsyncValidatorFunc) Field() string {
+	return v.field
+}
+
+func (v *AsyncValidatorFunc) CacheKey(entity any) string {
+	if v.key == nil {
+		return ""
+	}
+	return v.key(entity)
+}
+
+func (v *AsyncValidatorFunc) Validate(ctx context.Context, entity any) (bool, error) {
+	return v.fn(ctx, entity)
+}
+
+// asyncRule is an asynchronous validator with its timeout
+type asyncRule struct {
+	validator AsyncValidator
+	timeout   time.Duration
+}
+
+// asyncResultCache caches asynchronous validation results for a limited time.
+// It holds at most size results, the least recently used one is evicted first.
+type asyncResultCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[string]*list.Element // of *asyncCacheEntry
+	recent  *list.List               // most recently used first
+}
+
+type asyncCacheEntry struct {
+	key     string
+	valid   bool
+	expires time.Time
+}
+
+func newAsyncResultCache(ttl time.Duration, size int) *asyncResultCache {
+	return &asyncResultCache{ttl: ttl, size: size, entries: make(map[string]*list.Element), recent: list.New()}
+}
+
+func (c *asyncResultCache) get(key string) (valid, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return false, false
+	}
+	entry := element.Value.(*asyncCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(element)
+		return false, false
+	}
+	c.recent.MoveToFront(element)
+	return entry.valid, true
+}
+
+func (c *asyncResultCache) set(key string, valid bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl <= 0 || c.size <= 0 {
+		return
+	}
+	entry := &asyncCacheEntry{key: key, valid: valid, expires: time.Now().Add(c.ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.recent.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.recent.PushFront(entry)
+	c.evict()
+}
+
+// setTTL changes how long results are cached, zero empties the cache
+func (c *asyncResultCache) setTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+	c.evict()
+}
+
+// setSize changes how many results are cached, evicting the least recently used ones it can no longer hold
+func (c *asyncResultCache) setSize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = size
+	c.evict()
+}
+
+// evict removes the least recently used results over the size of the cache, all of them when caching is disabled.
+// c.mu must be held.
+func (c *asyncResultCache) evict() {
+	for c.recent.Len() > 0 && (c.recent.Len() > c.size || c.ttl <= 0) {
+		c.remove(c.recent.Back())
+	}
+}
+
+// len returns the number of cached results, expired ones included until they are looked up or evicted
+func (c *asyncResultCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.recent.Len()
+}
+
+// remove removes a cached result, c.mu must be held
+func (c *asyncResultCache) remove(element *list.Element) {
+	c.recent.Remove(element)
+	delete(c.entries, element.Value.(*asyncCacheEntry).key)
+}
+
+// AddAsyncValidator adds an asynchronous validator applied to all tenants.
+// A zero timeout means DefaultAsyncTimeout.
+func (vp *POCDefaultValidationProvider) AddAsyncValidator(v AsyncValidator, timeout time.Duration) {
+	vp.addAsyncValidator(globalScope, v, timeout)
+}
+
+// AddTenantAsyncValidator adds an asynchronous validator applied to the given tenant and its sub-brands.
+// It replaces the validator of an ancestor, or of all tenants, with the same field and tag.
+// A zero timeout means DefaultAsyncTimeout.
+func (vp *POCDefaultValidationProvider) AddTenantAsyncValidator(tenant string, v AsyncValidator, timeout time.Duration) error {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return err
+	}
+	vp.addAsyncValidator(tenantID, v, timeout)
+	return nil
+}
+
+// addAsyncValidator adds an asynchronous validator applied to a tenant key, or to all tenants with globalScope
+func (vp *POCDefaultValidationProvider) addAsyncValidator(tenantID int, v AsyncValidator, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultAsyncTimeout
+	}
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	vp.asyncValidators[tenantID] = append(vp.asyncValidators[tenantID], asyncRule{validator: v, timeout: timeout})
+}
+
+// asyncRulesOf returns the asynchronous validators of all tenants, then the ones of the ancestors of a tenant
+// and its own, see inheritRules
+func (vp *POCDefaultValidationProvider) asyncRulesOf(tenantID int) []asyncRule {
+	chain := chainScopes(vp.tenantChain(tenantID))
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	var rules []asyncRule
+	for _, key := range chain {
+		rules = inheritRules(rules, vp.asyncValidators[key], func(r asyncRule) [2]string {
+			return [2]string{r.validator.Field(), r.validator.Tag()}
+		})
+	}
+	return rules
+}
+
+// SetAsyncCacheTTL sets how long asynchronous validation results are cached, zero disables caching
+func (vp *POCDefaultValidationProvider) SetAsyncCacheTTL(ttl time.Duration) {
+	vp.asyncCache.setTTL(ttl)
+}
+
+// SetAsyncCacheSize sets how many asynchronous validation results are cached, DefaultAsyncCacheSize unless set.
+// The least recently used results are evicted first, zero disables caching.
+func (vp *POCDefaultValidationProvider) SetAsyncCacheSize(size int) {
+	vp.asyncCache.setSize(size)
+}
+
+// validateAsync runs the global and inherited tenant asynchronous validators concurrently.
+// A validator returning an error or timing out is reported as a violation with the "unavailable" param,
+// so an entity is never accepted without all its checks completing.
+// Panics are recovered and the validators run reported to hooks through the guard of the validation.
+func (vp *POCDefaultValidationProvider) validateAsync(ctx context.Context, tenantID int, entity any, guard *panicGuard) error {
+	rules := vp.asyncRulesOf(tenantID)
+	if len(rules) == 0 {
+		return nil
+	}
+
+	violations := make([]validator.FieldError, len(rules))
+	var wg sync.WaitGroup
+	for i, r := range rules {
+		wg.Add(1)
+		go func(i int, r asyncRule) {
+			defer wg.Done()
+			var start time.Time
+			if guard.hooks != nil {
+				start = time.Now()
+			}
+			// a panic would crash the process from this goroutine
+			defer func() {
+				p := recover()
+				field := guard.entity.Name() + "." + r.validator.Field()
+				if p != nil {
+					guard.recovered(r.validator.Tag(), field, p)
+					violations[i] = newProviderFieldError(guard.entity, r.validator.Field(), InternalErrorTag, r.validator.Tag(), nil)
+				}
+				if guard.hooks != nil {
+					guard.afterRule(r.validator.Tag(), field, start, violations[i] == nil, p != nil)
+				}
+			}()
+			violations[i] = vp.runAsyncRule(ctx, tenantID, r, entity)
+		}(i, r)
+	}
+	wg.Wait()
+
+	var errs ValidationErrors
+	for _, v := range violations {
+		if v != nil {
+			errs = append(errs, v)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// runAsyncRule runs a single asynchronous validator, using the cache when possible
+func (vp *POCDefaultValidationProvider) runAsyncRule(ctx context.Context, tenantID int, r asyncRule, entity any) validator.FieldError {
+	value := reflect.Indirect(reflect.ValueOf(entity))
+	var fieldValue interface{}
+	if f := value.FieldByName(r.validator.Field()); f.IsValid() {
+		fieldValue = f.Interface()
+	}
+
+	key := r.validator.CacheKey(entity)
+	if len(key) > 0 {
+		key = fmt.Sprintf("%d/%s/%s/%s", tenantID, r.validator.Tag(), r.validator.Field(), key)
+		if valid, ok := vp.asyncCache.get(key); ok {
+			if valid {
+				return nil
+			}
+			return newProviderFieldError(value.Type(), r.validator.Field(), r.validator.Tag(), "", fieldValue)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	valid, err := r.validator.Validate(ctx, entity)
+	if err == nil {
+		// the validator may ignore the context, do not trust a result returned after the deadline
+		err = ctx.Err()
+	}
+	if err != nil {
+		return newProviderFieldError(value.Type(), r.validator.Field(), r.validator.Tag(), asyncUnavailable, fieldValue)
+	}
+	if len(key) > 0 {
+		vp.asyncCache.set(key, valid)
+	}
+	if valid {
+		return nil
+	}
+	return newProviderFieldError(value.Type(), r.validator.Field(), r.validator.Tag(), "", fieldValue)
+}
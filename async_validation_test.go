@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// provideValidUser returns a user passing the default and tenant A rules
+func provideValidUser() POCUser {
+	return POCUser{
+		BaseUser:  BaseUser{LastName: "Smith"},
+		FirstName: "Sam",
+		Age:       25,
+		Email:     "sam@mail.com",
+		Phone:     "+16175551212",
+		Addresses: []*Address{{ZipCode: "H2X1Y4", Province: "Quebec"}},
+		Account:   &Account{ID: "anuuid", Balance: 10},
+	}
+}
+
+func newTestProvider() *POCDefaultValidationProvider {
+	vp := NewPOCDefaultValidationProvider()
+	// without registry tenants are numbers, 1 stands for nesto and 2 for ig, see newTenantProvider
+	_ = vp.SetTenantValidator("1", NewTenantAUserValidator())
+	_ = vp.SetTenantValidator("2", NewTenantBUserValidator())
+	_ = vp.RegisterTenantValidation("1", "startswiths", ValidateFieldStartsWithS)
+	_ = vp.RegisterTenantValidation("1", "isprovincename", isProvinceName)
+	_ = vp.RegisterTenantValidation("2", "isprovincecode", isProvinceCode)
+	return vp
+}
+
+func TestAsyncValidators(t *testing.T) {
+	// in-memory stand-ins for the lookups
+	emails := map[string]bool{"taken@mail.com": true}
+	var lookups int32
+	uniqueEmail := NewAsyncValidator("uniqueemail", "Email",
+		func(entity any) string { return entity.(POCUser).Email },
+		func(ctx context.Context, entity any) (bool, error) {
+			atomic.AddInt32(&lookups, 1)
+			return !emails[entity.(POCUser).Email], nil
+		})
+	watchList := NewAsyncValidator("watchlist", "LastName", nil,
+		func(ctx context.Context, entity any) (bool, error) {
+			<-ctx.Done() // lookup hangs
+			return false, ctx.Err()
+		})
+
+	vp := newTestProvider()
+	vp.AddAsyncValidator(uniqueEmail, 0)
+	vp.AddTenantAsyncValidator("2", watchList, 10*time.Millisecond)
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+
+	user := provideValidUser()
+	assert.NoError(t, vp.ValidateUserWithStructValidation(ctx, user))
+
+	user.Email = "taken@mail.com"
+	for i := 0; i < 2; i++ {
+		err := vp.ValidateUserWithRulesValidation(ctx, user)
+		assert.Error(t, err)
+		fieldErrors := err.(ValidationErrors)
+		assert.Len(t, fieldErrors, 1)
+		assert.Equal(t, "uniqueemail", fieldErrors[0].Tag())
+		assert.Equal(t, "POCUser.Email", fieldErrors[0].Namespace())
+		assert.Equal(t, "Key: 'POCUser.Email' Error:Field validation for 'Email' failed on the 'uniqueemail' tag", err.Error())
+	}
+	// the second validation used the cached result
+	assert.Equal(t, int32(2), atomic.LoadInt32(&lookups))
+
+	// asynchronous validators do not run when synchronous rules fail
+	user.Age = 10
+	_ = vp.ValidateUserWithRulesValidation(ctx, user)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&lookups))
+
+	// a timed out lookup is reported as unavailable, only for the tenant it is registered for
+	user = provideValidUser()
+	user.Addresses = nil
+	ctx = context.WithValue(context.Background(), "tenant", 2)
+	err := vp.ValidateUserWithRulesValidation(ctx, user)
+	assert.Error(t, err)
+	fieldErrors := err.(ValidationErrors)
+	assert.Len(t, fieldErrors, 1)
+	assert.Equal(t, "watchlist", fieldErrors[0].Tag())
+	assert.Equal(t, asyncUnavailable, fieldErrors[0].Param())
+}
+
+func TestAsyncCacheEviction(t *testing.T) {
+	lookups := map[string]int{}
+	var mu sync.Mutex
+	uniqueEmail := NewAsyncValidator("uniqueemail", "Email",
+		func(entity any) string { return entity.(POCUser).Email },
+		func(ctx context.Context, entity any) (bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			lookups[entity.(POCUser).Email]++
+			return true, nil
+		})
+
+	vp := newTestProvider()
+	vp.AddAsyncValidator(uniqueEmail, 0)
+	vp.SetAsyncCacheSize(2)
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+
+	validate := func(email string) {
+		user := provideValidUser()
+		user.Email = email
+		assert.NoError(t, vp.ValidateUserWithRulesValidation(ctx, user))
+	}
+	validate("a@mail.com")
+	validate("b@mail.com")
+	validate("a@mail.com") // cached, b is now the least recently used
+	validate("c@mail.com") // evicts b
+	assert.Equal(t, 2, vp.asyncCache.len())
+	validate("a@mail.com")
+	validate("b@mail.com")
+	assert.Equal(t, map[string]int{"a@mail.com": 1, "b@mail.com": 2, "c@mail.com": 1}, lookups)
+
+	// a zero TTL disables and empties the cache
+	vp.SetAsyncCacheTTL(0)
+	assert.Equal(t, 0, vp.asyncCache.len())
+}
+
+func TestAsyncCacheKeyedByField(t *testing.T) {
+	// the same tag checks both fields against the same entity key
+	blocked := func(field string) *AsyncValidatorFunc {
+		return NewAsyncValidator("blocked", field,
+			func(entity any) string { return entity.(POCUser).LastName },
+			func(ctx context.Context, entity any) (bool, error) { return field != "Email", nil })
+	}
+	vp := newTestProvider()
+	vp.AddAsyncValidator(blocked("Phone"), 0)
+	vp.AddAsyncValidator(blocked("Email"), 0)
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, []string{"Email:blocked"}, fieldFailures(vp.ValidateUserWithRulesValidation(ctx, provideValidUser())))
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// validation outcomes, as recorded in metrics and audit records
+const (
+	outcomeValid   = "valid"
+	outcomeInvalid = "invalid"
+	outcomeError   = "error"
+)
+
+// validationOutcome returns the outcome of a validation based on its error
+func validationOutcome(err error) string {
+	if err == nil {
+		return outcomeValid
+	}
+	if _, ok := fieldErrorsOf(err); ok {
+		return outcomeInvalid
+	}
+	return outcomeError
+}
+
+// AuditRecord is the decision taken on an entity at a submission
+type AuditRecord struct {
+	Tenant         string      `json:"tenant"` // ID of the tenant
+	EntityType     string      `json:"entityType"`
+	EntityID       string      `json:"entityID,omitempty"`
+	RuleSetVersion string      `json:"ruleSetVersion"`
+	AsOf           time.Time   `json:"asOf"` // time the rules in force were picked at
+	Timestamp      time.Time   `json:"timestamp"`
+	Outcome        string      `json:"outcome"`
+	Violations     []Violation `json:"violations,omitempty"` // redacted
+}
+
+// AuditSink records the validation decisions taken by the provider
+type AuditSink interface {
+	Record(ctx context.Context, record AuditRecord) error
+}
+
+// MemoryAuditSink keeps audit records in memory, meant for tests
+type MemoryAuditSink struct {
+	mu      sync.Mutex
+	records []AuditRecord
+}
+
+// NewMemoryAuditSink returns an empty MemoryAuditSink
+func NewMemoryAuditSink() *MemoryAuditSink {
+	return &MemoryAuditSink{}
+}
+
+func (s *MemoryAuditSink) Record(_ context.Context, record AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+// Records returns the recorded decisions, oldest first
+func (s *MemoryAuditSink) Records() []AuditRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]AuditRecord{}, s.records...)
+}
+
+// Query returns the recorded decisions of an entity, oldest first
+func (s *MemoryAuditSink) Query(entityID string) []AuditRecord {
+	var records []AuditRecord
+	for _, r := range s.Records() {
+		if r.EntityID == entityID {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// JSONLinesAuditSink appends audit records to a JSON lines file, one record per line
+type JSONLinesAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewJSONLinesAuditSink opens, or creates, the JSON lines file records are appended to
+func NewJSONLinesAuditSink(path string) (*JSONLinesAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesAuditSink{file: file}, nil
+}
+
+func (s *JSONLinesAuditSink) Record(_ context.Context, record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the underlying file
+func (s *JSONLinesAuditSink) Close() error {
+	return s.file.Close()
+}
+
+// QueryAuditLog reads a JSON lines audit log and returns the decisions of an entity, in file order
+func QueryAuditLog(r io.Reader, entityID string) ([]AuditRecord, error) {
+	var records []AuditRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("audit log line %d: %w", line, err)
+		}
+		if record.EntityID == entityID {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// SetAuditSink sets the sink every validation decision is recorded to, nil disables auditing.
+// The entity ID is read from the "entityID" context value.
+func (vp *POCDefaultValidationProvider) SetAuditSink(sink AuditSink) {
+	vp.audit = sink
+}
+
+// recordAudit records a validation decision, it is meant to be deferred after the error has been redacted.
+// Failing to record a decision fails an otherwise valid validation, an entity is never accepted without trace.
+func (vp *POCDefaultValidationProvider) recordAudit(ctx context.Context, tenantID int, entityType reflect.Type, asOf time.Time, err *error) {
+	if vp.audit == nil {
+		return
+	}
+	entityID, _ := ctx.Value("entityID").(string)
+	record := AuditRecord{
+		Tenant:         vp.tenantIDOf(tenantID),
+		EntityType:     entityType.Name(),
+		EntityID:       entityID,
+		RuleSetVersion: vp.ruleSetVersionAt(tenantID, entityType, asOf),
+		AsOf:           asOf.UTC(),
+		Timestamp:      vp.now().UTC(),
+		Outcome:        validationOutcome(*err),
+		Violations:     vp.RedactionPolicy().Violations(*err),
+	}
+	if auditErr := vp.audit.Record(ctx, record); auditErr != nil && *err == nil {
+		*err = fmt.Errorf("recording audit: %w", auditErr)
+	}
+}
+
+// RuleSetVersion returns a hash identifying the rules applied now to a user of a tenant:
+// effective rules, expression rules, custom validation tags and the validator types of the tenant and its ancestors.
+func (vp *POCDefaultValidationProvider) RuleSetVersion(tenant string) (string, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return "", err
+	}
+	return vp.ruleSetVersionAt(tenantID, reflect.TypeOf(POCUser{}), vp.now()), nil
+}
+
+// ruleSetVersionAt returns a hash identifying the rules applied to an entity type of a tenant at the given time.
+// The version of a registered entity type other than POCUser hashes its effective rules and the custom tags.
+func (vp *POCDefaultValidationProvider) ruleSetVersionAt(tenantID int, entityType reflect.Type, asOf time.Time) string {
+	chain := vp.tenantChain(tenantID)
+	if entityType != reflect.TypeOf(POCUser{}) {
+		rules, _ := vp.effectiveEntityRules(tenantID, entityType)
+		return contentHash(struct {
+			Entity     string
+			Rules      map[string]string
+			CustomTags []string
+		}{entityType.Name(), rules, vp.validators.tags(chain)})
+	}
+	ruleSet := struct {
+		Rules       map[string]string
+		Expressions []ExpressionRule
+		Validator   string
+		CustomTags  []string
+	}{
+		Rules:      vp.effectiveUserRulesAt(tenantID, asOf),
+		CustomTags: vp.validators.tags(chain),
+	}
+	for _, key := range chain {
+		if v, ok := vp.tenantValidator(key); ok {
+			if len(ruleSet.Validator) > 0 {
+				ruleSet.Validator += ","
+			}
+			ruleSet.Validator += reflect.TypeOf(v).String()
+		}
+	}
+	for _, e := range vp.expressionRulesOf(tenantID) {
+		ruleSet.Expressions = append(ruleSet.Expressions, e.ExpressionRule)
+	}
+	return contentHash(ruleSet)
+}
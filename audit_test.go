@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingAuditSink struct{}
+
+func (failingAuditSink) Record(context.Context, AuditRecord) error {
+	return errors.New("disk full")
+}
+
+func TestAuditRecords(t *testing.T) {
+	sink := NewMemoryAuditSink()
+	vp := newTestProvider()
+	vp.SetAuditSink(sink)
+
+	ctx := context.WithValue(context.WithValue(context.Background(), "tenant", 1), "entityID", "app-1")
+	user := provideValidUser()
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(ctx, user))
+	user.Email = "not-an-email"
+	assert.Error(t, vp.ValidateUserWithRulesValidation(ctx, user))
+
+	records := sink.Query("app-1")
+	assert.Len(t, records, 2)
+	assert.Equal(t, outcomeValid, records[0].Outcome)
+	assert.Equal(t, outcomeInvalid, records[1].Outcome)
+	assert.Equal(t, "1", records[1].Tenant)
+	assert.Equal(t, "POCUser", records[1].EntityType)
+	nesto, err := vp.RuleSetVersion("1")
+	assert.NoError(t, err)
+	ig, err := vp.RuleSetVersion("2")
+	assert.NoError(t, err)
+	assert.Equal(t, nesto, records[1].RuleSetVersion)
+	assert.NotEqual(t, nesto, ig)
+	assert.Equal(t, "email", records[1].Violations[0].Rule)
+	assertNoPII(t, []string{user.Email}, records)
+
+	vp.SetAuditSink(failingAuditSink{})
+	assert.Error(t, vp.ValidateUserWithRulesValidation(ctx, provideValidUser()))
+}
+
+func TestAuditEntityRuleSetVersion(t *testing.T) {
+	sink := NewMemoryAuditSink()
+	vp := newTestProvider()
+	vp.SetAuditSink(sink)
+	assert.NoError(t, Register[Address](vp, EntityRules{Rules: map[string]string{"ZipCode": "required"}}, nil))
+	ctx := context.WithValue(context.WithValue(context.Background(), "tenant", 2), "entityID", "address-1")
+	address := Address{ZipCode: "H2X1Y4", Province: "QC"}
+
+	// the version follows the rules of the audited entity type, not the user rules
+	assert.NoError(t, vp.Validate(ctx, address))
+	vp.SetTenantRules("2", map[string]string{"Phone": "required"})
+	assert.NoError(t, vp.Validate(ctx, address))
+	assert.NoError(t, vp.SetTenantEntityRules("2", Address{}, EntityRules{Rules: map[string]string{"Province": "len=2"}}))
+	assert.NoError(t, vp.Validate(ctx, address))
+
+	records := sink.Query("address-1")
+	assert.Len(t, records, 3)
+	assert.Equal(t, "Address", records[0].EntityType)
+	assert.Equal(t, records[0].RuleSetVersion, records[1].RuleSetVersion)
+	assert.NotEqual(t, records[1].RuleSetVersion, records[2].RuleSetVersion)
+	userVersion, err := vp.RuleSetVersion("2")
+	assert.NoError(t, err)
+	assert.NotEqual(t, userVersion, records[2].RuleSetVersion)
+}
+
+func TestAuditCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewJSONLinesAuditSink(path)
+	assert.NoError(t, err)
+	vp := newTestProvider()
+	vp.SetAuditSink(sink)
+	for _, id := range []string{"app-1", "app-2", "app-1"} {
+		ctx := context.WithValue(context.WithValue(context.Background(), "tenant", 1), "entityID", id)
+		_ = vp.ValidateUserWithStructValidation(ctx, provideValidUser())
+	}
+	assert.NoError(t, sink.Close())
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	records, err := QueryAuditLog(f, "app-1")
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	var out strings.Builder
+	assert.NoError(t, runCommand("audit", []string{"-file", path, "-entity", "app-2"}, &out))
+	assert.Equal(t, 1, strings.Count(out.String(), "outcome=valid"))
+	assert.Error(t, runCommand("audit", []string{"-file", path}, &out))
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// DefaultBatchMaxItemResults is the default number of failed item results kept in a batch report
+const DefaultBatchMaxItemResults = 1000
+
+// ErrDuplicateBatchID is returned when two items of a batch have the same ID
+var ErrDuplicateBatchID = errors.New("duplicate batch item ID")
+
+// BatchItem is an entity validated as part of a batch, a POCUser or a registered entity, see Validate
+type BatchItem struct {
+	ID     string // optional, keyed by index when empty, ex: #3. IDs must be unique within a batch, #n keys are reserved.
+	Entity any
+}
+
+// BatchOptions configures a batch validation
+type BatchOptions struct {
+	Workers        int // number of concurrent validations, runtime.NumCPU() when zero
+	MaxItemResults int // maximum number of failed item results kept, DefaultBatchMaxItemResults when zero
+}
+
+// BatchItemResult is the validation result of a single failed item
+type BatchItemResult struct {
+	Key   string
+	Index int
+	Err   error
+}
+
+// BatchReport aggregates the results of a batch validation.
+// Only failed items are kept, up to a limit, so memory stays bounded whatever the batch size.
+type BatchReport struct {
+	Total            int
+	Valid            int
+	Invalid          int // items failing validation rules
+	Errored          int // items that could not be validated
+	Skipped          int // items not validated because the batch was cancelled
+	Items            map[string]BatchItemResult
+	Truncated        bool // true when failed items were dropped from Items
+	FailuresByRule   map[string]int
+	FailuresByField  map[string]int
+	FailuresByTenant map[string]int // by tenant ID
+
+	maxItemResults int
+}
+
+// newBatchReport returns an empty report keeping at most maxItemResults failed items
+func newBatchReport(maxItemResults int) *BatchReport {
+	return &BatchReport{
+		Items:            make(map[string]BatchItemResult),
+		FailuresByRule:   make(map[string]int),
+		FailuresByField:  make(map[string]int),
+		FailuresByTenant: make(map[string]int),
+		maxItemResults:   maxItemResults,
+	}
+}
+
+// add records the result of an item
+func (r *BatchReport) add(tenant string, result BatchItemResult) {
+	if result.Err == nil {
+		r.Valid++
+		return
+	}
+	if fieldErrors, ok := fieldErrorsOf(result.Err); ok {
+		r.Invalid++
+		for _, fe := range fieldErrors {
+			r.FailuresByRule[fe.Tag()]++
+			r.FailuresByField[collapseIndexes(fe.StructNamespace())]++
+		}
+	} else {
+		r.Errored++
+	}
+	r.FailuresByTenant[tenant]++
+	if len(r.Items) >= r.maxItemResults {
+		r.Truncated = true
+		return
+	}
+	r.Items[result.Key] = result
+}
+
+// Merge adds the counters of another report, used to aggregate batches of several tenants
+func (r *BatchReport) Merge(other *BatchReport) {
+	r.Total += other.Total
+	r.Valid += other.Valid
+	r.Invalid += other.Invalid
+	r.Errored += other.Errored
+	r.Skipped += other.Skipped
+	r.Truncated = r.Truncated || other.Truncated
+	for k, v := range other.FailuresByRule {
+		r.FailuresByRule[k] += v
+	}
+	for k, v := range other.FailuresByField {
+		r.FailuresByField[k] += v
+	}
+	for k, v := range other.FailuresByTenant {
+		r.FailuresByTenant[k] += v
+	}
+	for k, v := range other.Items {
+		if len(r.Items) >= r.maxItemResults {
+			r.Truncated = true
+			break
+		}
+		r.Items[k] = v
+	}
+}
+
+// indexPattern matches slice indexes and map keys in a namespace, ex: Applicants[123456]
+var indexPattern = regexp.MustCompile(`\[[^\]]*\]`)
+
+// collapseIndexes replaces slice indexes and map keys of a namespace by a wildcard
+// so Applicants[123456].Email and Applicants[42].Email are counted as the same field.
+func collapseIndexes(namespace string) string {
+	return indexPattern.ReplaceAllString(namespace, "[*]")
+}
+
+// ValidateBatch validates items of a tenant concurrently using a bounded worker pool.
+// When the context is cancelled, the items not validated yet are skipped and the context error is returned
+// with the partial report. A batch holding the same ID twice is rejected before any item is validated.
+func (vp *POCDefaultValidationProvider) ValidateBatch(ctx context.Context, tenant string, items []BatchItem, opts BatchOptions) (*BatchReport, error) {
+	key, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return nil, err
+	}
+	// failures are counted by tenant ID whatever the tenant is referenced by
+	tenant = vp.tenantIDOf(key)
+	keys := make(map[string]int, len(items))
+	for i := range items {
+		key := batchItemKey(items, i)
+		if previous, ok := keys[key]; ok {
+			return nil, fmt.Errorf("batch items %d and %d: %w %q", previous, i, ErrDuplicateBatchID, key)
+		}
+		keys[key] = i
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	maxItemResults := opts.MaxItemResults
+	if maxItemResults <= 0 {
+		maxItemResults = DefaultBatchMaxItemResults
+	}
+	report := newBatchReport(maxItemResults)
+	report.Total = len(items)
+
+	ctx = context.WithValue(ctx, "tenant", tenant)
+	jobs := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				err := vp.validateBatchItem(ctx, items[i].Entity)
+				mu.Lock()
+				report.add(tenant, BatchItemResult{Key: batchItemKey(items, i), Index: i, Err: err})
+				mu.Unlock()
+			}
+		}()
+	}
+
+	sent := 0
+send:
+	for ; sent < len(items); sent++ {
+		select {
+		case jobs <- sent:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	report.Skipped = len(items) - sent
+	if report.Skipped > 0 {
+		return report, ctx.Err()
+	}
+	return report, nil
+}
+
+// batchItemKey returns the key of an item in the report: its ID, or its index prefixed by # when it has none,
+// so natural IDs like 12 do not collide with the index of another item
+func batchItemKey(items []BatchItem, i int) string {
+	if len(items[i].ID) == 0 {
+		return "#" + strconv.Itoa(i)
+	}
+	return items[i].ID
+}
+
+// validateBatchItem validates a single batch item, a panicking validation is reported as an error of the item
+func (vp *POCDefaultValidationProvider) validateBatchItem(ctx context.Context, entity any) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("validation panicked: %v", r)
+		}
+	}()
+	return vp.Validate(ctx, entity)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBatch(t *testing.T) {
+	vp := newTestProvider()
+	assert.NoError(t, Register[Address](vp, EntityRules{Rules: map[string]string{"ZipCode": "required"}}, nil))
+	items := make([]BatchItem, 100)
+	for i := range items {
+		items[i] = BatchItem{Entity: provideValidUser()}
+	}
+	invalidEmail := provideValidUser()
+	invalidEmail.Email = "not an email"
+	items[10] = BatchItem{ID: "app-10", Entity: invalidEmail}
+	items[20].Entity = &Address{Province: "Quebec"}
+	items[30].Entity = Account{}
+
+	report, err := vp.ValidateBatch(context.Background(), "1", items, BatchOptions{Workers: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, 100, report.Total)
+	assert.Equal(t, 97, report.Valid)
+	assert.Equal(t, 2, report.Invalid)
+	assert.Equal(t, 1, report.Errored)
+	assert.Equal(t, 3, report.FailuresByTenant["1"])
+	assert.Equal(t, 1, report.FailuresByRule["email"])
+	assert.Equal(t, 1, report.FailuresByField["Address.ZipCode"])
+	assert.Contains(t, report.Items, "app-10")
+	assert.Contains(t, report.Items, "#20")
+	assert.ErrorIs(t, report.Items["#30"].Err, ErrUnregisteredEntity)
+}
+
+func TestValidateBatchDuplicateIDs(t *testing.T) {
+	vp := newTestProvider()
+	items := []BatchItem{{ID: "app-1", Entity: provideValidUser()}, {Entity: provideValidUser()}, {ID: "app-1", Entity: provideValidUser()}}
+	report, err := vp.ValidateBatch(context.Background(), "1", items, BatchOptions{})
+	assert.ErrorIs(t, err, ErrDuplicateBatchID)
+	assert.Nil(t, report)
+
+	// IDs do not collide with the index key of an item without ID
+	items[1].Entity = Account{}
+	items[2].ID = "1"
+	report, err = vp.ValidateBatch(context.Background(), "1", items, BatchOptions{})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, report.Items["#1"].Err, ErrUnregisteredEntity)
+	assert.NotContains(t, report.Items, "1")
+}
+
+func TestValidateBatchBoundedResults(t *testing.T) {
+	vp := newTestProvider()
+	items := make([]BatchItem, 50)
+	for i := range items {
+		user := provideValidUser()
+		user.Age = 10
+		items[i] = BatchItem{ID: fmt.Sprintf("app-%d", i), Entity: user}
+	}
+	report, err := vp.ValidateBatch(context.Background(), "1", items, BatchOptions{MaxItemResults: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, 50, report.Invalid)
+	assert.Len(t, report.Items, 5)
+	assert.True(t, report.Truncated)
+}
+
+func TestValidateBatchCancelled(t *testing.T) {
+	vp := newTestProvider()
+	items := make([]BatchItem, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := vp.ValidateBatch(ctx, "1", items, BatchOptions{Workers: 1})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 10, report.Total)
+	assert.Equal(t, report.Total, report.Skipped+report.Valid+report.Invalid+report.Errored)
+}
+
+func TestCollapseIndexes(t *testing.T) {
+	assert.Equal(t, "Application.Applicants[*].Address.PostalCode", collapseIndexes("Application.Applicants[123456].Address.PostalCode"))
+	assert.Equal(t, "POCUser.Addresses[*].ZipCode", collapseIndexes("POCUser.Addresses[1].ZipCode"))
+}
+
+// benchmark test written to measure performance of the batch validation on 1000 users
+func BenchmarkValidateBatch1000(b *testing.B) {
+	vp := newTestProvider()
+	items := make([]BatchItem, 1000)
+	for i := range items {
+		items[i] = BatchItem{Entity: provideValidUser()}
+	}
+
+	b.ResetTimer() // to eliminate prep time spoil the results
+
+	for n := 0; n < b.N; n++ {
+		_, _ = vp.ValidateBatch(context.Background(), "1", items, BatchOptions{})
+	}
+}
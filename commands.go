@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// runCommand runs a command of the CLI, ex: go run . audit -file audit.jsonl -entity app-1
+func runCommand(name string, args []string, out io.Writer) error {
+	switch name {
+	case "audit":
+		return runAuditCommand(args, out)
+	case "replay":
+		return runReplayCommand(args, out)
+	case "lint":
+		return runLintCommand(args, out)
+	case "origins":
+		return runOriginsCommand(args, out)
+	case "disabled":
+		return runDisabledCommand(args, out)
+	case "serve":
+		return runServeCommand(args, out)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// runAuditCommand lists the validation decisions recorded for an entity ID in a JSON lines audit log
+func runAuditCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	flags.SetOutput(out)
+	file := flags.String("file", "audit.jsonl", "JSON lines audit log")
+	entityID := flags.String("entity", "", "entity ID to list the decisions of")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(*entityID) == 0 {
+		return errors.New("audit: -entity is required")
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	records, err := QueryAuditLog(f, *entityID)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		fmt.Fprintf(out, "no decision recorded for %s\n", *entityID)
+		return nil
+	}
+	for _, r := range records {
+		fmt.Fprintf(out, "%s tenant=%s entity=%s ruleset=%s outcome=%s\n",
+			r.Timestamp.Format(time.RFC3339), r.Tenant, r.EntityType, r.RuleSetVersion, r.Outcome)
+		for _, v := range r.Violations {
+			fmt.Fprintf(out, "  %s failed on %s\n", v.Namespace, v.Rule)
+		}
+	}
+	return nil
+}
+
+// runReplayCommand re-validates NDJSON payloads against two versions of the rules of a tenant, ex:
+// go run . replay -rules rules.json -tenant ig -from 3 -to 4 -input payloads.ndjson
+func runReplayCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(out)
+	rulesFile := flags.String("rules", "rules.json", "rule store file holding the tenant rule versions")
+	input := flags.String("input", "-", "NDJSON payloads or payload envelopes, - for stdin")
+	tenant := flags.String("tenant", "", "tenant the rules belong to, by ID or alias")
+	from := flags.Int("from", 0, "rule version the payloads were validated against, 0 for no tenant rules")
+	to := flags.Int("to", 0, "rule version to validate the payloads against")
+	examples := flags.Int("examples", DefaultReplayMaxExamples, "example records to report")
+	asJSON := flags.Bool("json", false, "write the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(*tenant) == 0 {
+		return errors.New("replay: -tenant is required")
+	}
+
+	vp, err := newTenantProvider(Development)
+	if err != nil {
+		return err
+	}
+	if _, err := vp.configuredTenantKey(*tenant); err != nil {
+		return fmt.Errorf("replay: %w", err)
+	}
+	if err := vp.SetRuleStore(NewFileRuleStore(*rulesFile)); err != nil {
+		return err
+	}
+	r := io.Reader(os.Stdin)
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	if *examples == 0 {
+		*examples = -1
+	}
+	report, err := vp.ReplayTenantRules(context.Background(), *tenant, *from, *to, r, ReplayOptions{MaxExamples: *examples})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return writeReplayReport(out, report)
+}
+
+// writeReplayReport writes a replay report for a human reader
+func writeReplayReport(out io.Writer, report *ReplayReport) error {
+	fmt.Fprintf(out, "tenant %s, rules version %d -> %d\n", report.Tenant, report.FromVersion, report.ToVersion)
+	fmt.Fprintf(out, "replayed %d, changed %d (newly invalid %d, newly valid %d), skipped %d, malformed %d\n",
+		report.Total, report.Changed, report.NewlyInvalid, report.NewlyValid, report.Skipped, len(report.Malformed))
+	for _, e := range report.Malformed {
+		fmt.Fprintf(out, "  line %d: %s\n", e.Line, e.Error)
+	}
+	for _, counts := range []struct {
+		title  string
+		counts map[string]int
+	}{{"by field", report.ChangesByField}, {"by rule", report.ChangesByRule}} {
+		if len(counts.counts) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "changes %s:\n", counts.title)
+		keys := make([]string, 0, len(counts.counts))
+		for k := range counts.counts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(out, "  %s %d\n", k, counts.counts[k])
+		}
+	}
+	for _, e := range report.Examples {
+		record, err := json.Marshal(e.Record)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "line %d %s: %s -> %s %s\n", e.Line, e.EntityID, e.FromOutcome, e.ToOutcome, record)
+		for _, v := range e.NewlyFailing {
+			fmt.Fprintf(out, "  now fails %s on %s\n", v.Namespace, v.Rule)
+		}
+		for _, v := range e.NewlyPassing {
+			fmt.Fprintf(out, "  now passes %s on %s\n", v.Namespace, v.Rule)
+		}
+	}
+	return nil
+}
+
+// runLintCommand warns about the entity fields lacking a display name, for every tenant
+func runLintCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.SetOutput(out)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	vp, err := newTenantProvider(Development)
+	if err != nil {
+		return err
+	}
+	warnings := 0
+	for _, tenant := range vp.Tenants() {
+		tenantWarnings, err := vp.LintDisplayNames(tenant)
+		if err != nil {
+			return err
+		}
+		for _, warning := range tenantWarnings {
+			fmt.Fprintf(out, "warning: tenant %s, %s\n", tenant, warning)
+			warnings++
+		}
+	}
+	if warnings == 0 {
+		fmt.Fprintln(out, "no warning")
+	}
+	return nil
+}
+
+// runOriginsCommand lists the effective user rules of a tenant with where each comes from, ex:
+// go run . origins -tenant ig-mortgages
+func runOriginsCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("origins", flag.ContinueOnError)
+	flags.SetOutput(out)
+	tenant := flags.String("tenant", "", "tenant to list the rules of, by ID or alias")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(*tenant) == 0 {
+		return errors.New("origins: -tenant is required")
+	}
+
+	vp, err := newTenantProvider(Development)
+	if err != nil {
+		return err
+	}
+	origins, err := vp.UserRuleOrigins(*tenant)
+	if err != nil {
+		return fmt.Errorf("origins: %w", err)
+	}
+	for _, o := range origins {
+		fmt.Fprintf(out, "%s %s from %s\n", o.Field, o.Rule, o.Source)
+	}
+	return nil
+}
+
+// runDisabledCommand lists the rules disabled at runtime on a provider through its admin API, ex:
+// ADMIN_TOKEN=secret go run . disabled -admin https://validation.internal/admin
+func runDisabledCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("disabled", flag.ContinueOnError)
+	flags.SetOutput(out)
+	admin := flags.String("admin", os.Getenv("ADMIN_URL"), "base URL of the admin API, ADMIN_URL by default")
+	token := flags.String("token", os.Getenv("ADMIN_TOKEN"), "admin token, ADMIN_TOKEN by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(*admin) == 0 {
+		return errors.New("disabled: -admin or ADMIN_URL is required")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, *admin+"/disabled-rules", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+*token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("disabled: admin API answered %s", resp.Status)
+	}
+	var rules []DisabledRuleState
+	if err := json.NewDecoder(resp.Body).Decode(&rules); err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		fmt.Fprintln(out, "no disabled rule")
+		return nil
+	}
+	for _, r := range rules {
+		tenant := r.Tenant
+		if len(tenant) == 0 {
+			tenant = "all"
+		}
+		fmt.Fprintf(out, "%s.%s %s tenant=%s suppressed=%d disabled %s by %s: %s\n", r.Entity, r.Field, r.Tag,
+			tenant, r.Suppressed, r.DisabledAt.Format(time.RFC3339), r.DisabledBy, r.Reason)
+	}
+	return nil
+}
+
+// metricsExpvarName is the expvar name the validation metrics are published under by the serve command
+const metricsExpvarName = "validation"
+
+// runServeCommand serves the provider over HTTP until it fails, ex: ADMIN_TOKEN=secret go run . serve -addr :8080
+func runServeCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.SetOutput(out)
+	addr := flags.String("addr", ":8080", "address to listen on")
+	token := flags.String("token", os.Getenv("ADMIN_TOKEN"), "admin token, ADMIN_TOKEN by default, the admin API is not served without one")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	vp, err := newTenantProvider(Production)
+	if err != nil {
+		return err
+	}
+	vp.Metrics().PublishExpvar(metricsExpvarName)
+	fmt.Fprintf(out, "listening on %s\n", *addr)
+	return http.ListenAndServe(*addr, newServeMux(vp, *token))
+}
+
+// newServeMux returns the routes of the serve command:
+//
+//	GET /metrics     validation metrics in the OpenMetrics text format
+//	GET /debug/vars  expvar variables, the validation metrics are published under metricsExpvarName
+//	/admin/...       the admin API authenticated by adminToken, see AdminHandler, not served when empty
+func newServeMux(vp *POCDefaultValidationProvider, adminToken string) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", vp.Metrics())
+	mux.Handle("/debug/vars", expvar.Handler())
+	if len(adminToken) > 0 {
+		mux.Handle("/admin/", http.StripPrefix("/admin", NewAdminHandler(vp, adminToken)))
+	}
+	return mux
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// csvDecodeRule is the rule reported when a cell cannot be decoded into its field
+const csvDecodeRule = "decode"
+
+// CSVImportError is a violation found while importing a CSV file
+type CSVImportError struct {
+	Row    int    // 1-based row number in the file, the header being row 1
+	Column string // column header, empty when the violation is not tied to a column
+	Rule   string
+}
+
+func (e CSVImportError) String() string {
+	if len(e.Column) == 0 {
+		return fmt.Sprintf("row %d: %s", e.Row, e.Rule)
+	}
+	return fmt.Sprintf("row %d, column %s: %s", e.Row, e.Column, e.Rule)
+}
+
+// CSVImportReport summarizes a CSV import validation.
+// Only the first DefaultBatchMaxItemResults errors are kept, all of them are written to the annotated CSV.
+type CSVImportReport struct {
+	Rows            int
+	Valid           int
+	Invalid         int
+	Errors          []CSVImportError
+	Truncated       bool
+	UnmappedColumns []string // columns not matching any entity field, ignored
+}
+
+// csvColumn maps a CSV column to an entity field
+type csvColumn struct {
+	header string
+	path   string  // struct field path, ex: Account.ID
+	index  [][]int // field index at each level of the path
+}
+
+// csvColumnMapper maps CSV headers to entity fields, by field name or JSON tag, case insensitively
+type csvColumnMapper struct {
+	entity  reflect.Type
+	columns []*csvColumn // indexed like the CSV header, nil for unmapped columns
+	byPath  map[string]*csvColumn
+}
+
+// newCSVColumnMapper resolves the CSV header against the entity struct fields
+func newCSVColumnMapper(entity reflect.Type, header []string) (*csvColumnMapper, []string) {
+	fields := make(map[string]*csvColumn)
+	collectCSVFields(entity, "", nil, nil, fields)
+
+	m := &csvColumnMapper{entity: entity, columns: make([]*csvColumn, len(header)), byPath: make(map[string]*csvColumn)}
+	var unmapped []string
+	for i, h := range header {
+		field, ok := fields[strings.ToLower(strings.TrimSpace(h))]
+		if !ok {
+			unmapped = append(unmapped, h)
+			continue
+		}
+		column := &csvColumn{header: h, path: field.path, index: field.index}
+		m.columns[i] = column
+		m.byPath[column.path] = column
+	}
+	return m, unmapped
+}
+
+// collectCSVFields registers every scalar field of t under its lower-cased name and JSON tag.
+// Embedded structs are promoted, other nested structs are reachable with a dotted name (ex: account.anID).
+func collectCSVFields(t reflect.Type, prefix string, names []string, index [][]int, fields map[string]*csvColumn) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	zero := reflect.New(t).Elem().Interface()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		jsonName, _, _ := strings.Cut(extractJSONTag(zero, f.Name), ",")
+		if jsonName == "-" {
+			continue
+		}
+		fieldIndex := append(append([][]int{}, index...), f.Index)
+		fieldType := f.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() == reflect.Struct && !isCSVScanner(f.Type) {
+			if f.Anonymous {
+				collectCSVFields(f.Type, prefix, names, fieldIndex, fields)
+			} else {
+				var nested []string
+				for _, n := range csvNames(names, f.Name, jsonName) {
+					nested = append(nested, n+".")
+				}
+				collectCSVFields(f.Type, prefix+f.Name+".", nested, fieldIndex, fields)
+			}
+			continue
+		}
+		if !isCSVScalar(fieldType) && !isCSVScanner(f.Type) {
+			continue
+		}
+		column := &csvColumn{path: prefix + f.Name, index: fieldIndex}
+		for _, n := range csvNames(names, f.Name, jsonName) {
+			if _, exists := fields[n]; !exists {
+				fields[n] = column
+			}
+		}
+	}
+}
+
+// csvNames returns the lower-cased names a field can be referred to with, under every parent prefix
+func csvNames(prefixes []string, names ...string) []string {
+	if len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+	var result []string
+	for _, p := range prefixes {
+		for _, n := range names {
+			if len(n) > 0 {
+				result = append(result, strings.ToLower(p+n))
+			}
+		}
+	}
+	return result
+}
+
+func isCSVScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// isCSVScanner reports whether the type decodes itself, like null.String
+func isCSVScanner(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return reflect.PtrTo(t).Implements(reflect.TypeOf((*sql.Scanner)(nil)).Elem())
+}
+
+// decode decodes a CSV record into a new entity, returning the columns that could not be decoded
+func (m *csvColumnMapper) decode(record []string) (reflect.Value, []string) {
+	entity := reflect.New(m.entity).Elem()
+	var failed []string
+	for i, column := range m.columns {
+		if column == nil || i >= len(record) {
+			continue
+		}
+		if err := setCSVValue(fieldForWrite(entity, column.index), record[i]); err != nil {
+			failed = append(failed, column.header)
+		}
+	}
+	return entity, failed
+}
+
+// fieldForWrite walks the field index, allocating nil pointers on the way
+func fieldForWrite(v reflect.Value, index [][]int) reflect.Value {
+	for _, i := range index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.FieldByIndex(i)
+	}
+	return v
+}
+
+// setCSVValue decodes a cell into a field, an empty cell leaves pointers nil and values zero
+func setCSVValue(v reflect.Value, s string) error {
+	if len(s) == 0 {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	if scanner, ok := v.Addr().Interface().(sql.Scanner); ok {
+		return scanner.Scan(s)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// column returns the column header a field error is reported on, empty when no column maps its exact path
+func (m *csvColumnMapper) column(fe validator.FieldError) string {
+	// namespace without the entity name, ex: POCUser.Account.ID -> Account.ID
+	_, path, _ := strings.Cut(fe.StructNamespace(), ".")
+	if column, ok := m.byPath[path]; ok {
+		return column.header
+	}
+	// a field of the same name elsewhere in the entity is not the one reported, ex: Account.ID for ID
+	return ""
+}
+
+// ValidateCSV validates a CSV file of entities of a tenant row by row, without loading the file in memory.
+// entity is a value of the type rows are decoded into, a POCUser or a registered entity like an applicant or an address.
+// Columns are mapped to its fields by field name or JSON tag. When annotated is not nil, every invalid row is
+// written to it as an annotated error CSV with the original columns, the row number and the errors.
+// Rows that can not be read, ex: with a wrong number of fields, are reported as invalid rows.
+func (vp *POCDefaultValidationProvider) ValidateCSV(ctx context.Context, tenant string, entity any, r io.Reader, annotated io.Writer) (*CSVImportReport, error) {
+	if _, err := vp.configuredTenantKey(tenant); err != nil {
+		return nil, err
+	}
+	t := entityType(entity)
+	if t != reflect.TypeOf(POCUser{}) && !vp.entityRegistered(t) {
+		return nil, fmt.Errorf("%v: %w", t, ErrUnregisteredEntity)
+	}
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	// rows with a wrong number of fields are reported, not fatal
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	header = append([]string{}, header...)
+	mapper, unmapped := newCSVColumnMapper(t, header)
+	report := &CSVImportReport{UnmappedColumns: unmapped}
+
+	var writer *csv.Writer
+	if annotated != nil {
+		writer = csv.NewWriter(annotated)
+		if err := writer.Write(append(append([]string{}, header...), "row", "errors")); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx = context.WithValue(ctx, "tenant", tenant)
+	row := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		row++
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			return report, fmt.Errorf("reading CSV row %d: %w", row, err)
+		}
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.Rows++
+
+		var rowErrors []CSVImportError
+		switch {
+		case parseErr != nil:
+			rowErrors = []CSVImportError{{Row: row, Rule: parseErr.Err.Error()}}
+		case len(record) != len(header):
+			rowErrors = []CSVImportError{{Row: row, Rule: csv.ErrFieldCount.Error()}}
+		default:
+			rowErrors = vp.validateCSVRecord(ctx, mapper, row, record)
+		}
+		if len(rowErrors) == 0 {
+			report.Valid++
+			continue
+		}
+		report.Invalid++
+		for _, e := range rowErrors {
+			if len(report.Errors) >= DefaultBatchMaxItemResults {
+				report.Truncated = true
+				break
+			}
+			report.Errors = append(report.Errors, e)
+		}
+		if writer != nil {
+			if err := writer.Write(annotateCSVRecord(mapper, vp.redaction, record, row, rowErrors)); err != nil {
+				return report, err
+			}
+		}
+	}
+	if writer != nil {
+		writer.Flush()
+		return report, writer.Error()
+	}
+	return report, nil
+}
+
+// validateCSVRecord decodes and validates a single CSV record
+func (vp *POCDefaultValidationProvider) validateCSVRecord(ctx context.Context, mapper *csvColumnMapper, row int, record []string) []CSVImportError {
+	entity, failed := mapper.decode(record)
+	var rowErrors []CSVImportError
+	for _, column := range failed {
+		rowErrors = append(rowErrors, CSVImportError{Row: row, Column: column, Rule: csvDecodeRule})
+	}
+	if len(rowErrors) > 0 {
+		// rules would run against partially decoded data
+		return rowErrors
+	}
+
+	err := vp.validateBatchItem(ctx, entity.Interface())
+	if err == nil {
+		return nil
+	}
+	fieldErrors, ok := fieldErrorsOf(err)
+	if !ok {
+		return []CSVImportError{{Row: row, Rule: err.Error()}}
+	}
+	for _, fe := range fieldErrors {
+		rowErrors = append(rowErrors, CSVImportError{Row: row, Column: mapper.column(fe), Rule: fe.Tag()})
+	}
+	return rowErrors
+}
+
+// annotateCSVRecord returns the record, with PII cells redacted, followed by its row number and errors.
+// The record is padded or cut to the header so the annotations stay in their columns.
+func annotateCSVRecord(mapper *csvColumnMapper, policy *RedactionPolicy, record []string, row int, rowErrors []CSVImportError) []string {
+	annotated := make([]string, len(mapper.columns), len(mapper.columns)+2)
+	for i, cell := range record {
+		if i >= len(annotated) {
+			break
+		}
+		annotated[i] = cell
+		if i < len(mapper.columns) && mapper.columns[i] != nil && policy != nil && policy.IsPII(mapper.columns[i].path) {
+			if redacted := policy.Redact(mapper.columns[i].path, cell); redacted != nil {
+				annotated[i] = fmt.Sprint(redacted)
+			} else {
+				annotated[i] = ""
+			}
+		}
+	}
+	messages := make([]string, len(rowErrors))
+	for i, e := range rowErrors {
+		if len(e.Column) == 0 {
+			messages[i] = e.Rule
+		} else {
+			messages[i] = fmt.Sprintf("%s: %s", e.Column, e.Rule)
+		}
+	}
+	return append(annotated, strconv.Itoa(row), strings.Join(messages, "; "))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCSV(t *testing.T) {
+	input := strings.Join([]string{
+		"FIRSTNAME,myAge,email,Phone,account.anID,Account.Balance,notes",
+		"Sam,25,sam@mail.com,+16175551212,anuuid,10.5,first",
+		"Pam,17,not an email,+16175551212,anuuid,1,second",
+		"Sam,abc,sam@mail.com,+16175551212,anuuid,1,third",
+	}, "\n")
+
+	var annotated bytes.Buffer
+	vp := newTestProvider()
+	report, err := vp.ValidateCSV(context.Background(), "1", POCUser{}, strings.NewReader(input), &annotated)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Rows)
+	assert.Equal(t, 1, report.Valid)
+	assert.Equal(t, 2, report.Invalid)
+	assert.Equal(t, []string{"notes"}, report.UnmappedColumns)
+	assert.Equal(t, []CSVImportError{
+		{Row: 3, Column: "FIRSTNAME", Rule: "startswiths"},
+		{Row: 3, Column: "myAge", Rule: "min"},
+		{Row: 3, Column: "email", Rule: "email"},
+		{Row: 4, Column: "myAge", Rule: csvDecodeRule},
+	}, report.Errors)
+
+	records, err := csv.NewReader(&annotated).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, []string{"FIRSTNAME", "myAge", "email", "Phone", "account.anID", "Account.Balance", "notes", "row", "errors"}, records[0])
+	assert.Equal(t, "3", records[1][7])
+	assert.Equal(t, "FIRSTNAME: startswiths; myAge: min; email: email", records[1][8])
+	assert.Equal(t, "myAge: decode", records[2][8])
+}
+
+// csvApplicant is an applicant as uploaded by partners
+type csvApplicant struct {
+	Email   string  `json:"email"`
+	Address Address `json:"address"`
+}
+
+func TestValidateCSVEntities(t *testing.T) {
+	vp := newTestProvider()
+	assert.NoError(t, Register[Address](vp, EntityRules{Rules: map[string]string{"ZipCode": "required"}}, nil))
+	assert.NoError(t, Register[csvApplicant](vp, EntityRules{Rules: map[string]string{"Email": "required,email"}}, nil))
+	_, err := vp.ValidateCSV(context.Background(), "1", Account{}, strings.NewReader("anID\n"), nil)
+	assert.ErrorIs(t, err, ErrUnregisteredEntity)
+
+	input := strings.Join([]string{
+		"email,address.ZipCode,address.Province",
+		"sam@mail.com,H2X1Y4,Quebec",
+		"not an email,,Quebec",
+		"sam@mail.com,H2X1Y4",
+		`sam@mail.com,"H2X"1Y4,Quebec`,
+		"pam@mail.com,H2X1Y4,Quebec,extra",
+		"pam@mail.com,H2X1Y4,Quebec",
+	}, "\n")
+	var annotated bytes.Buffer
+	report, err := vp.ValidateCSV(context.Background(), "1", &csvApplicant{}, strings.NewReader(input), &annotated)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, report.Rows)
+	assert.Equal(t, 2, report.Valid)
+	assert.Equal(t, []CSVImportError{
+		{Row: 3, Column: "email", Rule: "email"},
+		{Row: 3, Column: "address.ZipCode", Rule: "required"},
+		{Row: 4, Rule: csv.ErrFieldCount.Error()},
+		{Row: 5, Rule: csv.ErrQuote.Error()},
+		{Row: 6, Rule: csv.ErrFieldCount.Error()},
+	}, report.Errors)
+	records, err := csv.NewReader(&annotated).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"**********om", "H2X1Y4", "", "4", "wrong number of fields"}, records[2])
+
+	report, err = vp.ValidateCSV(context.Background(), "1", Address{}, strings.NewReader("ZipCode,Province\n,Quebec\nH2X1Y4,Quebec\n"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []CSVImportError{{Row: 2, Column: "ZipCode", Rule: "required"}}, report.Errors)
+
+	// a field without column is not reported on a column of the same field name elsewhere in the entity
+	assert.NoError(t, Register[csvHousehold](vp, EntityRules{Rules: map[string]string{"Email": "required,email"}}, nil))
+	report, err = vp.ValidateCSV(context.Background(), "1", csvHousehold{}, strings.NewReader("email,partner.address.ZipCode\nsam@mail.com,H2X1Y4\n"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []CSVImportError{{Row: 2, Rule: "required"}}, report.Errors)
+}
+
+// csvHousehold is an applicant with a partner, both with an email
+type csvHousehold struct {
+	Email   string       `json:"email"`
+	Partner csvApplicant `json:"partner"`
+}
@@ -1,9 +1,21 @@
 package main
 
-import "github.com/go-playground/validator/v10"
+import (
+	"regexp"
+
+	"github.com/go-playground/validator/v10"
+)
 
 // custom validation functions - this can be placed in a shared location (such as pkg.validation)
 
+// testPhonePattern matches the phone numbers of test users, ex: 555-555-555
+var testPhonePattern = regexp.MustCompile(`^555-\d{3}-\d{3}$`)
+
+// TestPhone
+func isTestPhone(fl validator.FieldLevel) bool {
+	return testPhonePattern.MatchString(fl.Field().String())
+}
+
 // ProvinceCode
 func isProvinceCode(fl validator.FieldLevel) bool {
 	switch fl.Field().String() {
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// DisabledRule identifies a rule switched off at runtime, ex: a misfiring oneof list or a broken custom validation.
+// A disabled rule still runs: its violations are kept out of validation results and reported to the hook instead.
+// The tag of a disabled map rule is removed from the rule of its field before validating and evaluated on its own,
+// so it can not hide the other tags of the field. Violations of other rules, ex: reported by struct level
+// validators, are matched on their namespace once validated.
+type DisabledRule struct {
+	Entity string `json:"entity"` // type name of the validated entity, ex: POCUser
+	Field  string `json:"field"`  // Go path of the field below the entity without indexes, ex: FirstName, Addresses.Province
+	Tag    string `json:"tag"`    // ex: oneof, also matches the internal errors of a custom validation that panicked
+	Tenant string `json:"tenant"` // ID of the tenant, its sub-brands included, empty for all tenants
+}
+
+// DisabledRuleState is a disabled rule with why, when and by whom it was disabled
+type DisabledRuleState struct {
+	DisabledRule
+	Reason     string    `json:"reason"`
+	DisabledBy string    `json:"disabledBy"`
+	DisabledAt time.Time `json:"disabledAt"`
+	Suppressed int       `json:"suppressed"` // violations kept out of validation results since disabled
+}
+
+// DisabledRuleHit describes a violation of a disabled rule kept out of a validation result, its value is redacted
+type DisabledRuleHit struct {
+	Rule      DisabledRule
+	Tenant    string // ID of the tenant
+	EntityID  string // "entityID" context value, empty when not set
+	Violation Violation
+}
+
+// DisabledRuleHook is called for every violation of a disabled rule, ex: to log it.
+// It must be safe for concurrent use.
+type DisabledRuleHook func(ctx context.Context, hit DisabledRuleHit)
+
+// SetDisabledRuleHook sets the hook called for every violation of a disabled rule
+func (vp *POCDefaultValidationProvider) SetDisabledRuleHook(hook DisabledRuleHook) {
+	vp.disabledRuleHook = hook
+}
+
+// DisableRule disables a rule at runtime, the entity must be a POCUser or a registered entity.
+// Disabling a rule already disabled updates its reason and author.
+func (vp *POCDefaultValidationProvider) DisableRule(rule DisabledRule, reason, author string) error {
+	if len(rule.Tag) == 0 {
+		return errors.New("disabled rule tag is required")
+	}
+	rule, err := vp.disabledRuleTenant(rule)
+	if err != nil {
+		return err
+	}
+	entity, ok := vp.entityNamed(rule.Entity)
+	if !ok {
+		return fmt.Errorf("%s: %w", rule.Entity, ErrUnregisteredEntity)
+	}
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	if !hasFieldPath(entity, rule.Field) {
+		return fmt.Errorf("field %s does not exist on %s", rule.Field, rule.Entity)
+	}
+	state, ok := vp.disabledRules[rule]
+	if !ok {
+		state = &DisabledRuleState{DisabledRule: rule, DisabledAt: vp.now().UTC()}
+		vp.disabledRules[rule] = state
+	}
+	state.Reason, state.DisabledBy = reason, author
+	return nil
+}
+
+// EnableRule enables a disabled rule again, false when it was not disabled
+func (vp *POCDefaultValidationProvider) EnableRule(rule DisabledRule) bool {
+	rule, err := vp.disabledRuleTenant(rule)
+	if err != nil {
+		return false
+	}
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	_, ok := vp.disabledRules[rule]
+	delete(vp.disabledRules, rule)
+	return ok
+}
+
+// disabledRuleTenant returns the rule with its tenant referenced by ID, it may be given by ID, alias or key
+func (vp *POCDefaultValidationProvider) disabledRuleTenant(rule DisabledRule) (DisabledRule, error) {
+	if len(rule.Tenant) == 0 {
+		return rule, nil
+	}
+	key, err := vp.configuredTenantKey(rule.Tenant)
+	if err != nil {
+		return rule, err
+	}
+	rule.Tenant = vp.tenantIDOf(key)
+	return rule, nil
+}
+
+// DisabledRules returns the disabled rules sorted by tenant, entity, field and tag
+func (vp *POCDefaultValidationProvider) DisabledRules() []DisabledRuleState {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	rules := make([]DisabledRuleState, 0, len(vp.disabledRules))
+	for _, state := range vp.disabledRules {
+		rules = append(rules, *state)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		a, b := rules[i].DisabledRule, rules[j].DisabledRule
+		if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		if a.Entity != b.Entity {
+			return a.Entity < b.Entity
+		}
+		if a.Field != b.Field {
+			return a.Field < b.Field
+		}
+		return a.Tag < b.Tag
+	})
+	return rules
+}
+
+// suppressDisabledRules keeps the violations of disabled rules out of a described validation error,
+// reporting them to the hook. nil is returned when only disabled rules failed.
+func (vp *POCDefaultValidationProvider) suppressDisabledRules(ctx context.Context, tenantID int, entity reflect.Type, err error) error {
+	fieldErrors, ok := fieldErrorsOf(err)
+	if !ok {
+		return err
+	}
+	disabled := vp.disabledRulesOf(vp.tenantChain(tenantID))
+	if len(disabled) == 0 {
+		return err
+	}
+
+	kept := make(ValidationErrors, 0, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		rule, ok := disabledRuleOf(disabled, entity.Name(), fe)
+		if !ok {
+			kept = append(kept, fe)
+			continue
+		}
+		vp.disabledRuleHit(ctx, tenantID, rule, fe)
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+// disabledRuleHit counts a violation of a disabled rule and reports it to the hook
+func (vp *POCDefaultValidationProvider) disabledRuleHit(ctx context.Context, tenantID int, rule DisabledRule, fe validator.FieldError) {
+	vp.mu.Lock()
+	if state, ok := vp.disabledRules[rule]; ok {
+		state.Suppressed++
+	}
+	vp.mu.Unlock()
+	if vp.disabledRuleHook != nil {
+		entityID, _ := ctx.Value("entityID").(string)
+		violations := vp.RedactionPolicy().Violations(ValidationErrors{fe})
+		vp.disabledRuleHook(ctx, DisabledRuleHit{Rule: rule, Tenant: vp.tenantIDOf(tenantID), EntityID: entityID, Violation: violations[0]})
+	}
+}
+
+// disabledRulesOf returns the rules disabled for a tenant chain, the ones disabled for all tenants first
+func (vp *POCDefaultValidationProvider) disabledRulesOf(chain []int) []DisabledRule {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	if len(vp.disabledRules) == 0 {
+		return nil
+	}
+	tenants := []string{""}
+	for _, key := range chain {
+		tenants = append(tenants, vp.tenantIDOf(key))
+	}
+	var disabled []DisabledRule
+	for _, tenant := range tenants {
+		for rule := range vp.disabledRules {
+			if rule.Tenant == tenant {
+				disabled = append(disabled, rule)
+			}
+		}
+	}
+	return disabled
+}
+
+// disabledRuleOf returns the disabled rule a violation of an entity belongs to
+func disabledRuleOf(disabled []DisabledRule, entity string, fe validator.FieldError) (DisabledRule, bool) {
+	path := fieldPath(fe.StructNamespace())
+	for _, rule := range disabled {
+		if rule.Entity != entity || rule.Field != path {
+			continue
+		}
+		for _, tag := range []string{fe.Tag(), fe.ActualTag(), internalErrorRule(fe)} {
+			if tag == rule.Tag {
+				return rule, true
+			}
+		}
+	}
+	return DisabledRule{}, false
+}
+
+// fieldPath returns the path of a struct namespace below its root without indexes,
+// ex: POCUser.Addresses[2].Province is Addresses.Province
+func fieldPath(namespace string) string {
+	if i := strings.Index(namespace, "."); i >= 0 {
+		namespace = namespace[i+1:]
+	} else {
+		namespace = ""
+	}
+	var path strings.Builder
+	depth := 0
+	for _, c := range namespace {
+		switch {
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case depth == 0:
+			path.WriteRune(c)
+		}
+	}
+	return path.String()
+}
+
+// hasFieldPath reports whether a dot path of fields exists below a struct type, through pointers, slices and maps
+func hasFieldPath(t reflect.Type, path string) bool {
+	for _, name := range strings.Split(path, ".") {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return false
+		}
+		f, ok := t.FieldByName(name)
+		if !ok {
+			return false
+		}
+		t = f.Type
+	}
+	return true
+}
+
+// strippedTag is the tag of a disabled rule removed from the map rule of a field, evaluated on its own
+type strippedTag struct {
+	rule DisabledRule
+	tags string // tag with its param, preceded by omitempty when the rule had it
+}
+
+// withoutDisabledTags returns the map rules of an entity without the tags of its disabled rules
+// along with the tags removed, the rules given are left untouched. Only rules of direct fields can be stripped.
+func withoutDisabledTags(entity string, rules map[string]string, disabled []DisabledRule) (map[string]string, []strippedTag) {
+	var stripped []strippedTag
+	copied := false
+	for _, rule := range disabled {
+		fieldRule, ok := rules[rule.Field]
+		if rule.Entity != entity || !ok {
+			continue
+		}
+		tags := strings.Split(fieldRule, ",")
+		kept := make([]string, 0, len(tags))
+		omitEmpty := false
+		for _, tag := range tags {
+			name := strings.SplitN(tag, "=", 2)[0]
+			switch {
+			case name == "omitempty":
+				omitEmpty = true
+			case name == rule.Tag && omitEmpty:
+				stripped = append(stripped, strippedTag{rule: rule, tags: "omitempty," + tag})
+				continue
+			case name == rule.Tag:
+				stripped = append(stripped, strippedTag{rule: rule, tags: tag})
+				continue
+			}
+			kept = append(kept, tag)
+		}
+		if len(kept) == len(tags) {
+			continue
+		}
+		if !copied {
+			rules, copied = copyRules(rules), true
+		}
+		rules[rule.Field] = strings.Join(kept, ",")
+	}
+	return rules, stripped
+}
+
+// evaluateStrippedTags evaluates the tags removed from the map rules of entities against the entities holding them,
+// so that cross-field tags see the other fields, reporting their violations to the hook.
+// Entities of the stripped types nested in the value are evaluated too.
+func (vp *POCDefaultValidationProvider) evaluateStrippedTags(ctx context.Context, tenantID int, guard *panicGuard, value reflect.Value, stripped map[reflect.Type][]strippedTag) {
+	rules := make(map[reflect.Type]map[string]string, len(stripped))
+	for t, tags := range stripped {
+		if len(tags) > 0 {
+			rules[t] = strippedRules(tags)
+		}
+	}
+	if len(rules) == 0 {
+		return
+	}
+	validate, err := vp.strippedTagsValidate(tenantID, rules, guard)
+	if err != nil {
+		// the tags were part of rules a validator was built from
+		return
+	}
+	defer vp.validatorCache.release(validate)
+	walkStructs(value, value.Type().Name(), func(v reflect.Value, ns string) {
+		tags := stripped[v.Type()]
+		if len(tags) == 0 {
+			return
+		}
+		fields := make([]string, len(tags))
+		disabled := make([]DisabledRule, len(tags))
+		for i, s := range tags {
+			fields[i], disabled[i] = s.rule.Field, s.rule
+		}
+		fieldErrors, _ := fieldErrorsOf(guard.convert(validate.validate.StructPartialCtx(ctx, v.Interface(), fields...)))
+		for _, fe := range fieldErrors {
+			rule, ok := disabledRuleOf(disabled, v.Type().Name(), fe)
+			if !ok {
+				continue
+			}
+			pfe := copyFieldError(fe)
+			pfe.ns, pfe.structNs = ns+"."+rule.Field, ns+"."+rule.Field
+			pfe.field, pfe.structField = rule.Field, rule.Field
+			vp.disabledRuleHit(ctx, tenantID, rule, pfe)
+		}
+	})
+}
+
+// strippedTagsValidate returns a validator applying the given map rules of the tags stripped from entities,
+// by entity type, for the validation of a guard. It must be released once the validation is done.
+func (vp *POCDefaultValidationProvider) strippedTagsValidate(tenantID int, rules map[reflect.Type]map[string]string, guard *panicGuard) (*cachedValidator, error) {
+	chain := vp.tenantChain(tenantID)
+	return vp.validatorCache.acquire("stripped", chain, validatorFingerprint(vp.validatorGeneration(), rules, nil), guard, func(slot *guardSlot) (*cachedValidator, error) {
+		validate, err := vp.newValidate(chain, slot)
+		if err != nil {
+			return nil, err
+		}
+		for t, r := range rules {
+			validate.RegisterStructValidationMapRules(r, reflect.Zero(t).Interface())
+		}
+		return &cachedValidator{validate: validate}, nil
+	})
+}
+
+// strippedRules returns the map rules applying the stripped tags of an entity, by field
+func strippedRules(tags []strippedTag) map[string]string {
+	rules := make(map[string]string, len(tags))
+	for _, s := range tags {
+		appendRule(s.rule.Field, s.tags, rules)
+	}
+	return rules
+}
+
+// walkStructs calls visit for every struct reachable from a value with its namespace, ex: POCUser.Addresses[1]
+func walkStructs(v reflect.Value, ns string, visit func(v reflect.Value, ns string)) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			walkStructs(v.Elem(), ns, visit)
+		}
+	case reflect.Struct:
+		visit(v, ns)
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.IsExported() {
+				walkStructs(v.Field(i), ns+"."+f.Name, visit)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkStructs(v.Index(i), fmt.Sprintf("%s[%d]", ns, i), visit)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			walkStructs(iter.Value(), fmt.Sprintf("%s[%v]", ns, iter.Key().Interface()), visit)
+		}
+	}
+}
+
+// internalErrorRule returns the rule of an internal error violation, empty for other violations
+func internalErrorRule(fe validator.FieldError) string {
+	if fe.Tag() != InternalErrorTag {
+		return ""
+	}
+	return fe.Param()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisabledRules(t *testing.T) {
+	vp := newTestProvider()
+	assert.NoError(t, vp.RegisterValidation("boom", func(validator.FieldLevel) bool { panic("broken") }))
+	vp.SetTenantRules("1", map[string]string{"Email": "boom"})
+	var mu sync.Mutex
+	var hits []DisabledRuleHit
+	vp.SetDisabledRuleHook(func(_ context.Context, hit DisabledRuleHit) {
+		mu.Lock()
+		defer mu.Unlock()
+		hits = append(hits, hit)
+	})
+
+	assert.Error(t, vp.DisableRule(DisabledRule{Entity: "POCUser", Field: "Age"}, "", "ops"))
+	assert.ErrorIs(t, vp.DisableRule(DisabledRule{Entity: "Unknown", Field: "Age", Tag: "min"}, "", "ops"), ErrUnregisteredEntity)
+	assert.Error(t, vp.DisableRule(DisabledRule{Entity: "POCUser", Field: "Unknown", Tag: "min"}, "", "ops"))
+
+	user := provideValidUser()
+	user.Age = 12
+	nesto := context.WithValue(context.WithValue(context.Background(), "tenant", 1), "entityID", "app-1")
+	ig := context.WithValue(context.Background(), "tenant", 2)
+	assert.Equal(t, []string{"Age:min", "Email:internal"}, fieldFailures(vp.ValidateUserWithRulesValidation(nesto, user)))
+
+	// disabled rules still run, their violations are reported to the hook instead
+	assert.NoError(t, vp.DisableRule(DisabledRule{Entity: "POCUser", Field: "Age", Tag: "min", Tenant: "1"}, "bad minimum", "ops"))
+	assert.NoError(t, vp.DisableRule(DisabledRule{Entity: "POCUser", Field: "Email", Tag: "boom"}, "broken custom validation", "ops"))
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(nesto, user))
+	assert.Equal(t, []string{"Age:min"}, fieldFailures(vp.ValidateUserWithRulesValidation(ig, user)))
+	assert.Len(t, hits, 2)
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Rule.Field < hits[j].Rule.Field })
+	assert.Equal(t, DisabledRuleHit{
+		Rule:      DisabledRule{Entity: "POCUser", Field: "Age", Tag: "min", Tenant: "1"},
+		Tenant:    "1",
+		EntityID:  "app-1",
+		Violation: hits[0].Violation,
+	}, hits[0])
+	assert.Equal(t, "POCUser.Age", hits[0].Violation.Namespace)
+	assert.Equal(t, "POCUser.Email", hits[1].Violation.Namespace)
+
+	disabled := vp.DisabledRules()
+	assert.Len(t, disabled, 2)
+	assert.Equal(t, "Email", disabled[0].Field)
+	assert.Equal(t, 1, disabled[0].Suppressed)
+	assert.Equal(t, "bad minimum", disabled[1].Reason)
+
+	assert.True(t, vp.EnableRule(DisabledRule{Entity: "POCUser", Field: "Age", Tag: "min", Tenant: "1"}))
+	assert.False(t, vp.EnableRule(DisabledRule{Entity: "POCUser", Field: "Age", Tag: "min", Tenant: "1"}))
+	assert.Equal(t, []string{"Age:min"}, fieldFailures(vp.ValidateUserWithRulesValidation(nesto, user)))
+}
+
+func TestDisabledRuleKeepsOtherTags(t *testing.T) {
+	vp := newTestProvider()
+	nesto := context.WithValue(context.Background(), "tenant", 1)
+	assert.NoError(t, vp.DisableRule(DisabledRule{Entity: "POCUser", Field: "Email", Tag: "required"}, "", "ops"))
+
+	// the disabled required tag no longer hides email
+	user := provideValidUser()
+	user.Email = ""
+	assert.Equal(t, []string{"Email:email"}, fieldFailures(vp.ValidateUserWithRulesValidation(nesto, user)))
+	rules, err := vp.EffectiveUserRules("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "required,email", rules["Email"])
+	assert.Equal(t, 1, vp.DisabledRules()[0].Suppressed)
+}
+
+func TestDisabledNestedRule(t *testing.T) {
+	vp := newTestProvider()
+	assert.NoError(t, vp.DisableRule(DisabledRule{Entity: "POCUser", Field: "Addresses.Province", Tag: "isprovincecode", Tenant: "2"}, "", "ops"))
+	assert.Error(t, vp.DisableRule(DisabledRule{Entity: "POCUser", Field: "Addresses.Unknown", Tag: "min"}, "", "ops"))
+
+	user := provideValidUser()
+	user.Addresses = append(user.Addresses, &Address{ZipCode: "H2X1Y4", Province: "Ontario"})
+	ig := context.WithValue(context.Background(), "tenant", 2)
+	assert.NoError(t, vp.ValidateUserWithStructValidation(ig, user))
+	assert.Equal(t, 2, vp.DisabledRules()[0].Suppressed)
+}
+
+func TestAdminDisabledRules(t *testing.T) {
+	vp := newTestProvider()
+	vp.SetTenantRegistry(newTestTenantRegistry(t))
+	h := NewAdminHandler(vp, "secret")
+	body := `{"entity":"POCUser","field":"FirstName","tag":"startswiths","tenant":"nesto","reason":"misfiring"}`
+	assert.Equal(t, 200, adminRequest(t, h, "PUT", "/disabled-rules", "", body).Code)
+	assert.Equal(t, 422, adminRequest(t, h, "PUT", "/disabled-rules", "", `{"entity":"POCUser","field":"Unknown","tag":"min"}`).Code)
+	assert.Equal(t, 404, adminRequest(t, h, "PUT", "/disabled-rules", "", `{"entity":"POCUser","field":"Age","tag":"min","tenant":"unknown"}`).Code)
+
+	user := provideValidUser()
+	user.FirstName = "Pam"
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(context.WithValue(context.Background(), "tenant", "nesto"), user))
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+	var out bytes.Buffer
+	assert.NoError(t, runCommand("disabled", []string{"-admin", server.URL, "-token", "secret"}, &out))
+	assert.Contains(t, out.String(), "POCUser.FirstName startswiths tenant=nesto suppressed=1")
+	assert.Contains(t, out.String(), "by admin: misfiring")
+
+	assert.Equal(t, 204, adminRequest(t, h, "DELETE", "/disabled-rules", "", body).Code)
+	assert.Equal(t, 404, adminRequest(t, h, "DELETE", "/disabled-rules", "", body).Code)
+	out.Reset()
+	assert.NoError(t, runCommand("disabled", []string{"-admin", server.URL, "-token", "secret"}, &out))
+	assert.Equal(t, "no disabled rule\n", out.String())
+	assert.Error(t, runCommand("disabled", []string{"-token", "secret"}, &out))
+}
+
+func TestDisabledCrossFieldRule(t *testing.T) {
+	vp := newTestProvider()
+	var hits []DisabledRuleHit
+	vp.SetDisabledRuleHook(func(_ context.Context, hit DisabledRuleHit) { hits = append(hits, hit) })
+	ig := context.WithValue(context.Background(), "tenant", 2)
+	vp.SetTenantRules("2", map[string]string{"Phone": "required_if=Email x@y.z", "FirstName": "eqfield=Email"})
+	assert.NoError(t, vp.DisableRule(DisabledRule{Entity: "POCUser", Field: "Phone", Tag: "required_if"}, "", "ops"))
+	assert.NoError(t, vp.DisableRule(DisabledRule{Entity: "POCUser", Field: "FirstName", Tag: "eqfield"}, "", "ops"))
+
+	// disabled cross-field tags are evaluated against the user
+	user := provideValidUser()
+	user.Email, user.Phone = "x@y.z", ""
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(ig, user))
+	assert.Len(t, hits, 2)
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Rule.Field < hits[j].Rule.Field })
+	assert.Equal(t, "POCUser.FirstName", hits[0].Violation.Namespace)
+	assert.Equal(t, "eqfield", hits[0].Violation.Rule)
+	assert.Equal(t, "POCUser.Phone", hits[1].Violation.Namespace)
+	assert.Equal(t, "required_if", hits[1].Violation.Rule)
+
+	user.Phone = "+15145551212"
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(ig, user))
+	assert.Len(t, hits, 3)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// jsonSchemaDraft is the JSON Schema version of the generated schemas
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// defaultDisplayNames are the display names of the entity fields, by locale.
+// Fields are declared by struct field path, ex: FirstName or Account.ID, and match any entity containing them.
+var defaultDisplayNames = map[string]map[string]string{
+	"en_CA": {
+		"POCUser":         "User",
+		"LastName":        "Last name",
+		"FirstName":       "First name",
+		"Age":             "Age",
+		"Email":           "Email",
+		"Phone":           "Phone number",
+		"Addresses":       "Addresses",
+		"ZipCode":         "Postal code",
+		"Province":        "Province",
+		"Account":         "Account",
+		"Account.ID":      "Account number",
+		"Balance":         "Balance",
+		"ApplicationDate": "Application date",
+	},
+	"fr_CA": {
+		"POCUser":         "Utilisateur",
+		"LastName":        "Nom de famille",
+		"FirstName":       "Prénom",
+		"Age":             "Âge",
+		"Email":           "Courriel",
+		"Phone":           "Numéro de téléphone",
+		"Addresses":       "Adresses",
+		"ZipCode":         "Code postal",
+		"Province":        "Province",
+		"Account":         "Compte",
+		"Account.ID":      "Numéro de compte",
+		"Balance":         "Solde",
+		"ApplicationDate": "Date de la demande",
+	},
+}
+
+// SetDisplayName sets the display name of a field in a locale for all tenants
+func (c *MessageCatalog) SetDisplayName(locale, field, name string) error {
+	locale, ok := c.locale(locale)
+	if !ok {
+		return fmt.Errorf("unsupported locale %q", locale)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.displayNames[locale][field] = name
+	return nil
+}
+
+// SetTenantDisplayName overrides the display name of a field in a locale for a tenant
+func (c *MessageCatalog) SetTenantDisplayName(tenantID int, locale, field, name string) error {
+	locale, ok := c.locale(locale)
+	if !ok {
+		return fmt.Errorf("unsupported locale %q", locale)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.tenantNames[tenantID]; !ok {
+		c.tenantNames[tenantID] = make(map[string]map[string]string)
+	}
+	if _, ok := c.tenantNames[tenantID][locale]; !ok {
+		c.tenantNames[tenantID][locale] = make(map[string]string)
+	}
+	c.tenantNames[tenantID][locale][field] = name
+	return nil
+}
+
+// DisplayName returns the display name of a field path for a tenant in a locale, ex: POCUser.Addresses[1].ZipCode.
+// The most specific declaration wins, tenant ones first.
+func (c *MessageCatalog) DisplayName(tenantID int, locale, path string) (string, bool) {
+	locale, ok := c.locale(locale)
+	if !ok {
+		return "", false
+	}
+	path = indexPattern.ReplaceAllString(path, "")
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, names := range []map[string]string{c.tenantNames[tenantID][locale], c.displayNames[locale]} {
+		match := ""
+		for field := range names {
+			if (path == field || strings.HasSuffix(path, "."+field)) && len(field) > len(match) {
+				match = field
+			}
+		}
+		if len(match) > 0 {
+			return names[match], true
+		}
+	}
+	return "", false
+}
+
+// SetDisplayName sets the display name of a field in a locale for all tenants, see MessageCatalog.SetDisplayName
+func (vp *POCDefaultValidationProvider) SetDisplayName(locale, field, name string) error {
+	return vp.messages.SetDisplayName(locale, field, name)
+}
+
+// SetTenantDisplayName overrides the display name of a field for a tenant, see MessageCatalog.SetTenantDisplayName
+func (vp *POCDefaultValidationProvider) SetTenantDisplayName(tenant string, locale, field, name string) error {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return err
+	}
+	return vp.messages.SetTenantDisplayName(tenantID, locale, field, name)
+}
+
+// LintDisplayNames returns a warning for every POCUser field lacking a display name for a tenant in any locale
+func (vp *POCDefaultValidationProvider) LintDisplayNames(tenant string) ([]string, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	collectFieldPaths(reflect.TypeOf(POCUser{}), "POCUser", &paths)
+	locales := make([]string, 0, len(vp.messages.translators))
+	for locale := range vp.messages.translators {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+
+	var warnings []string
+	for _, locale := range locales {
+		for _, path := range paths {
+			if _, ok := vp.messages.DisplayName(tenantID, locale, path); !ok {
+				warnings = append(warnings, fmt.Sprintf("%s: %s has no display name", locale, path))
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// collectFieldPaths appends the path of every exported field of t, nested structs included.
+// Fields of embedded structs are promoted like Go does.
+func collectFieldPaths(t reflect.Type, prefix string, paths *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		nested := structType(f.Type)
+		if f.Anonymous && nested != nil {
+			collectFieldPaths(nested, prefix, paths)
+			continue
+		}
+		path := prefix + "." + f.Name
+		*paths = append(*paths, path)
+		if nested != nil {
+			collectFieldPaths(nested, path, paths)
+		}
+	}
+}
+
+// structType returns the struct type of a field, through pointers, slices and maps.
+// nil is returned for other types and structs without exported field, like time.Time.
+func structType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			return t
+		}
+	}
+	return nil
+}
+
+// UserJSONSchema returns the JSON Schema of a POCUser for a tenant, titled with the display names of a locale.
+// The effective rules of each field are documented under x-rules.
+func (vp *POCDefaultValidationProvider) UserJSONSchema(tenant string, locale string) (map[string]interface{}, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := vp.messages.locale(locale); !ok {
+		locale = DefaultLocale
+	}
+	rules := vp.effectiveUserRulesAt(tenantID, vp.now())
+	schema := vp.jsonSchema(tenantID, locale, reflect.TypeOf(POCUser{}), "POCUser", rules)
+	schema["$schema"] = jsonSchemaDraft
+	return schema, nil
+}
+
+// EntityJSONSchema returns the JSON Schema of a registered entity type for a tenant, see UserJSONSchema.
+// entity is a value of the type.
+func (vp *POCDefaultValidationProvider) EntityJSONSchema(tenant string, entity any, locale string) (map[string]interface{}, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return nil, err
+	}
+	t := entityType(entity)
+	rules, err := vp.effectiveEntityRules(tenantID, t)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := vp.messages.locale(locale); !ok {
+		locale = DefaultLocale
+	}
+	schema := vp.jsonSchema(tenantID, locale, t, t.Name(), rules)
+	schema["$schema"] = jsonSchemaDraft
+	return schema, nil
+}
+
+// jsonSchema returns the JSON Schema of a type found at a field path, rules are the map rules of its fields
+func (vp *POCDefaultValidationProvider) jsonSchema(tenantID int, locale string, t reflect.Type, path string, rules map[string]string) map[string]interface{} {
+	schema := make(map[string]interface{})
+	if name, ok := vp.messages.DisplayName(tenantID, locale, path); ok {
+		schema["title"] = name
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		schema["type"], schema["format"] = "string", "date-time"
+	case t.Kind() == reflect.Struct:
+		schema["type"] = "object"
+		properties := make(map[string]interface{})
+		var required []string
+		vp.jsonSchemaProperties(tenantID, locale, t, path, rules, properties, &required)
+		schema["properties"] = properties
+		if len(required) > 0 {
+			sort.Strings(required)
+			schema["required"] = required
+		}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		schema["type"] = "array"
+		items := vp.jsonSchema(tenantID, locale, t.Elem(), path, nil)
+		delete(items, "title")
+		schema["items"] = items
+	case t.Kind() == reflect.Map:
+		schema["type"] = "object"
+	case t.Kind() == reflect.Bool:
+		schema["type"] = "boolean"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		schema["type"] = "integer"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema["type"] = "number"
+	default:
+		schema["type"] = "string"
+	}
+	return schema
+}
+
+// jsonSchemaProperties adds the properties of the struct fields to a schema, embedded struct fields are promoted
+func (vp *POCDefaultValidationProvider) jsonSchemaProperties(tenantID int, locale string, t reflect.Type, path string, rules map[string]string, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if vp.fieldNames.promoted(f) {
+			vp.jsonSchemaProperties(tenantID, locale, structType(f.Type), path, rules, properties, required)
+			continue
+		}
+		jsonName, ok := vp.fieldNames.Name(f)
+		if !ok {
+			continue
+		}
+		_, options, _ := strings.Cut(f.Tag.Get(vp.fieldNames.tag), ",")
+		property := vp.jsonSchema(tenantID, locale, f.Type, path+"."+f.Name, nil)
+		if options == "string" {
+			property["type"] = "string"
+		}
+		if rule, ok := rules[f.Name]; ok {
+			property["x-rules"] = rule
+			for _, tag := range strings.Split(rule, ",") {
+				if tag == "required" {
+					*required = append(*required, jsonName)
+					break
+				}
+			}
+		}
+		properties[jsonName] = property
+	}
+}
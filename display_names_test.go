@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantDisplayNames(t *testing.T) {
+	vp := newTestProvider()
+	assert.NoError(t, vp.SetTenantDisplayName("2", "en-CA", "FirstName", "Given name"))
+	assert.Error(t, vp.SetTenantDisplayName("2", "de-DE", "FirstName", "Vorname"))
+	user := provideValidUser()
+	user.FirstName = "Sam with a long name"
+
+	ctx := context.WithValue(context.Background(), "tenant", 2)
+	assert.Equal(t, "Given name must be a maximum of 10 characters in length",
+		ErrorMessages(vp.ValidateUserWithRulesValidation(ctx, user))["POCUser.FirstName"])
+	ctx = context.WithValue(ctx, "locale", "fr-CA")
+	assert.Equal(t, "Prénom doit faire une taille maximum de 10 caractères",
+		ErrorMessages(vp.ValidateUserWithRulesValidation(ctx, user))["POCUser.FirstName"])
+	ctx = context.WithValue(context.Background(), "tenant", 1)
+	assert.Equal(t, "First name must be a maximum of 10 characters in length",
+		ErrorMessages(vp.ValidateUserWithRulesValidation(ctx, user))["POCUser.FirstName"])
+
+	// the most specific declaration wins
+	name, ok := vp.messages.DisplayName(1, "en-CA", "POCUser.Account.ID")
+	assert.True(t, ok)
+	assert.Equal(t, "Account number", name)
+	name, _ = vp.messages.DisplayName(1, "fr-CA", "POCUser.Addresses[3].ZipCode")
+	assert.Equal(t, "Code postal", name)
+}
+
+func TestLintDisplayNames(t *testing.T) {
+	vp := newTestProvider()
+	warnings, err := vp.LintDisplayNames("1")
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	delete(vp.messages.displayNames["fr_CA"], "ZipCode")
+	warnings, _ = vp.LintDisplayNames("1")
+	assert.Equal(t, []string{"fr_CA: POCUser.Addresses.ZipCode has no display name"}, warnings)
+	assert.NoError(t, vp.SetTenantDisplayName("1", "fr-CA", "Addresses.ZipCode", "Code postal"))
+	warnings, _ = vp.LintDisplayNames("1")
+	assert.Empty(t, warnings)
+	warnings, _ = vp.LintDisplayNames("2")
+	assert.Len(t, warnings, 1)
+
+	_, err = vp.LintDisplayNames("3")
+	assert.NoError(t, err)
+	_, err = vp.LintDisplayNames("nesto")
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+}
+
+func TestUserJSONSchema(t *testing.T) {
+	vp := newTestProvider()
+	assert.NoError(t, vp.SetTenantDisplayName("2", "en-CA", "FirstName", "Given name"))
+
+	schema, err := vp.UserJSONSchema("2", "en-CA")
+	assert.NoError(t, err)
+	properties := schema["properties"].(map[string]interface{})
+	assert.Equal(t, jsonSchemaDraft, schema["$schema"])
+	assert.Equal(t, "User", schema["title"])
+	assert.Equal(t, []string{"Email"}, schema["required"])
+	assert.Equal(t, map[string]interface{}{"title": "Given name", "type": "string", "x-rules": "max=10"}, properties["FIRSTNAME"])
+	assert.Equal(t, "string", properties["myAge"].(map[string]interface{})["type"])
+	assert.Equal(t, "date-time", properties["applicationDate"].(map[string]interface{})["format"])
+	assert.Contains(t, properties, "LastName")
+	addresses := properties["Addresses"].(map[string]interface{})
+	zipCode := addresses["items"].(map[string]interface{})["properties"].(map[string]interface{})["ZipCode"]
+	assert.Equal(t, "Postal code", zipCode.(map[string]interface{})["title"])
+
+	schema, err = vp.UserJSONSchema("2", "fr-CA")
+	assert.NoError(t, err)
+	properties = schema["properties"].(map[string]interface{})
+	assert.Equal(t, "Prénom", properties["FIRSTNAME"].(map[string]interface{})["title"])
+
+	h := NewAdminHandler(vp, "secret")
+	r := httptest.NewRequest(http.MethodGet, "/tenants/2/schema/POCUser", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("Accept-Language", "fr-CA")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var served map[string]interface{}
+	assert.NoError(t, json.NewDecoder(strings.NewReader(w.Body.String())).Decode(&served))
+	assert.Equal(t, "Utilisateur", served["title"])
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodGet, "/tenants/2/schema/Unknown", "", "").Code)
+}
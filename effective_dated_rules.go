@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// DatedRules are tenant rules only in force for a period, ex: a regulatory change with a known start date.
+// While in force, each of their rules replaces the rule of its field, an empty rule removes it.
+type DatedRules struct {
+	EffectiveFrom  time.Time         `json:"effectiveFrom"`  // inclusive, zero when in force since always
+	EffectiveUntil time.Time         `json:"effectiveUntil"` // exclusive, zero when in force forever
+	Rules          map[string]string `json:"rules"`
+}
+
+// InForce returns whether the rules are in force at the given time
+func (d DatedRules) InForce(asOf time.Time) bool {
+	return !asOf.Before(d.EffectiveFrom) && (d.EffectiveUntil.IsZero() || asOf.Before(d.EffectiveUntil))
+}
+
+// AsOfFunc returns the time the rules applied to an entity are picked at.
+// Returning false falls back on the provider clock.
+type AsOfFunc func(ctx context.Context, entity interface{}) (time.Time, bool)
+
+// AsOfField returns an AsOfFunc reading the time.Time field of an entity with the given name, ex: ApplicationDate.
+// Entities without the field, or with a zero time, are validated against the rules in force now.
+func AsOfField(name string) AsOfFunc {
+	return func(_ context.Context, entity interface{}) (time.Time, bool) {
+		v := reflect.ValueOf(entity)
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return time.Time{}, false
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return time.Time{}, false
+		}
+		f := v.FieldByName(name)
+		if !f.IsValid() {
+			return time.Time{}, false
+		}
+		asOf, ok := f.Interface().(time.Time)
+		return asOf, ok && !asOf.IsZero()
+	}
+}
+
+// SetClock sets the clock giving the current time, used to pick the rules in force when the entity does not tell
+func (vp *POCDefaultValidationProvider) SetClock(now func() time.Time) {
+	vp.clock = now
+}
+
+// SetAsOfFunc sets how the as-of time of an entity is found, nil always uses the provider clock.
+// Entities are untrusted: the time found is clamped between maxAge ago and now, so an entity can neither pick
+// rules not in force yet nor rules retired longer than maxAge ago. A zero maxAge does not limit how old the time found can be.
+func (vp *POCDefaultValidationProvider) SetAsOfFunc(fn AsOfFunc, maxAge time.Duration) {
+	vp.asOfFunc, vp.asOfMaxAge = fn, maxAge
+}
+
+// now returns the current time of the provider clock
+func (vp *POCDefaultValidationProvider) now() time.Time {
+	if vp.clock == nil {
+		return time.Now()
+	}
+	return vp.clock()
+}
+
+// asOf returns the time the rules applied to an entity are picked at
+func (vp *POCDefaultValidationProvider) asOf(ctx context.Context, entity interface{}) time.Time {
+	now := vp.now()
+	if vp.asOfFunc != nil {
+		if asOf, ok := vp.asOfFunc(ctx, entity); ok {
+			if oldest := now.Add(-vp.asOfMaxAge); vp.asOfMaxAge > 0 && asOf.Before(oldest) {
+				return oldest
+			}
+			if asOf.After(now) {
+				return now
+			}
+			return asOf
+		}
+	}
+	return now
+}
+
+// SetTenantDatedRules replaces the dated rules of a tenant, recording a new version of the tenant rules
+// persisted when a rule store is set. Every rule set is linted, nothing is set if any of them is invalid
+// or ends before it starts.
+func (vp *POCDefaultValidationProvider) SetTenantDatedRules(tenant string, author string, rules []DatedRules) error {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return err
+	}
+	for i, r := range rules {
+		if !r.EffectiveUntil.IsZero() && !r.EffectiveFrom.Before(r.EffectiveUntil) {
+			return fmt.Errorf("dated rules %d: effective until %s is not after effective from %s",
+				i, r.EffectiveUntil.Format(time.RFC3339), r.EffectiveFrom.Format(time.RFC3339))
+		}
+		// empty rules remove the rule of their field
+		lint := make(map[string]string, len(r.Rules))
+		for field, rule := range r.Rules {
+			if len(rule) > 0 {
+				lint[field] = rule
+			}
+		}
+		if err := vp.lintTenantRules(tenantID, lint); err != nil {
+			return fmt.Errorf("dated rules %d: %w", i, err)
+		}
+	}
+	dated := copyDatedRules(rules)
+	sort.SliceStable(dated, func(i, j int) bool {
+		return dated[i].EffectiveFrom.Before(dated[j].EffectiveFrom)
+	})
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	set := vp.ruleSetOf(tenantID)
+	set.dated = dated
+	_, err = vp.activateRules(tenantID, set, author, "dated rules")
+	return err
+}
+
+// copyDatedRules returns a copy of dated rules and of their rule maps
+func copyDatedRules(rules []DatedRules) []DatedRules {
+	if len(rules) == 0 {
+		return nil
+	}
+	copied := make([]DatedRules, len(rules))
+	for i, d := range rules {
+		copied[i] = d
+		copied[i].Rules = copyRules(d.Rules)
+	}
+	return copied
+}
+
+// TenantDatedRules returns the dated rules of a tenant, sorted by effective from
+func (vp *POCDefaultValidationProvider) TenantDatedRules(tenant string) ([]DatedRules, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return nil, err
+	}
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	return copyDatedRules(vp.tenantDatedRules[tenantID]), nil
+}
+
+// datedRulesInForce returns the dated rules of a tenant in force at the given time
+func (vp *POCDefaultValidationProvider) datedRulesInForce(tenantID int, asOf time.Time) []DatedRules {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	return datedRulesInForce(vp.tenantDatedRules[tenantID], asOf)
+}
+
+// datedRulesInForce returns the dated rules in force at the given time
+func datedRulesInForce(dated []DatedRules, asOf time.Time) []DatedRules {
+	var rules []DatedRules
+	for _, d := range dated {
+		if d.InForce(asOf) {
+			rules = append(rules, d)
+		}
+	}
+	return rules
+}
+
+// datedUserRulesAt returns the rules of the dated rules of a tenant chain in force at the given time,
+// applied by the struct validation on top of the struct level validators
+func (vp *POCDefaultValidationProvider) datedUserRulesAt(chain []int, asOf time.Time) map[string]string {
+	var layers []ruleLayer
+	for _, key := range chain {
+		for _, d := range vp.datedRulesInForce(key, asOf) {
+			layers = append(layers, ruleLayer{rules: d.Rules, scope: key, replace: true})
+		}
+	}
+	return decorateLayers(layers)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEffectiveDatedRules(t *testing.T) {
+	change := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := change.AddDate(0, 2, 0)
+	vp := newTestProvider()
+	vp.SetClock(func() time.Time { return now })
+	vp.SetAsOfFunc(AsOfField("ApplicationDate"), 365*24*time.Hour)
+	sink := NewMemoryAuditSink()
+	vp.SetAuditSink(sink)
+	assert.NoError(t, vp.SetTenantDatedRules("2", "ops", []DatedRules{
+		{EffectiveFrom: change, Rules: map[string]string{"Age": "min=21", "Email": ""}},
+		{EffectiveUntil: change, Rules: map[string]string{"Phone": "required"}},
+	}))
+	ctx := context.WithValue(context.Background(), "tenant", 2)
+
+	user := provideValidUser()
+	user.Age = 19
+	user.Phone = ""
+	user.Email = ""
+
+	// started under the old rules
+	user.ApplicationDate = change.AddDate(0, -6, 0)
+	err := vp.ValidateUserWithRulesValidation(ctx, user)
+	assert.Equal(t, []string{"Email:required", "Phone:required"}, fieldFailures(err))
+
+	// started once the new rules are in force, they replace the default age rule and remove the email one
+	user.ApplicationDate = change
+	err = vp.ValidateUserWithRulesValidation(ctx, user)
+	assert.Equal(t, []string{"Age:min"}, fieldFailures(err))
+
+	// without application date, the clock tells the rules in force
+	user.ApplicationDate = time.Time{}
+	err = vp.ValidateUserWithRulesValidation(ctx, user)
+	assert.Equal(t, []string{"Age:min"}, fieldFailures(err))
+
+	records := sink.Records()
+	assert.Len(t, records, 3)
+	assert.Equal(t, change.AddDate(0, -6, 0), records[0].AsOf)
+	assert.Equal(t, now, records[2].AsOf)
+	assert.NotEqual(t, records[0].RuleSetVersion, records[1].RuleSetVersion)
+	assert.Equal(t, records[1].RuleSetVersion, records[2].RuleSetVersion)
+
+	rules, err := vp.EffectiveUserRules("2")
+	assert.NoError(t, err)
+	assert.Equal(t, "min=21", rules["Age"])
+	assert.NotContains(t, rules, "Email")
+	rules, err = vp.EffectiveUserRulesAt("2", change.Add(-time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, "min=18", rules["Age"])
+}
+
+func TestAsOfClamped(t *testing.T) {
+	now := time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC)
+	vp := newTestProvider()
+	vp.SetClock(func() time.Time { return now })
+	vp.SetAsOfFunc(AsOfField("ApplicationDate"), 30*24*time.Hour)
+	sink := NewMemoryAuditSink()
+	vp.SetAuditSink(sink)
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+
+	user := provideValidUser()
+	for _, date := range []time.Time{now.AddDate(1, 0, 0), now.AddDate(-1, 0, 0), now.AddDate(0, 0, -10)} {
+		user.ApplicationDate = date
+		_ = vp.ValidateUserWithRulesValidation(ctx, user)
+	}
+	records := sink.Records()
+	assert.Equal(t, now, records[0].AsOf)
+	assert.Equal(t, now.Add(-30*24*time.Hour), records[1].AsOf)
+	assert.Equal(t, now.AddDate(0, 0, -10), records[2].AsOf)
+
+	// without max age only future times are clamped
+	vp.SetAsOfFunc(AsOfField("ApplicationDate"), 0)
+	for _, date := range []time.Time{now.AddDate(1, 0, 0), now.AddDate(-1, 0, 0)} {
+		user.ApplicationDate = date
+		_ = vp.ValidateUserWithRulesValidation(ctx, user)
+	}
+	records = sink.Records()
+	assert.Equal(t, now, records[3].AsOf)
+	assert.Equal(t, now.AddDate(-1, 0, 0), records[4].AsOf)
+}
+
+func TestDatedRulesStructValidation(t *testing.T) {
+	vp := newTestProvider()
+	assert.NoError(t, vp.SetTenantDatedRules("2", "ops", []DatedRules{{Rules: map[string]string{"Phone": "required"}}}))
+	user := provideValidUser()
+	user.Phone = ""
+	user.Addresses[0].Province = "QC"
+	err := vp.ValidateUserWithStructValidation(context.WithValue(context.Background(), "tenant", 2), user)
+	assert.Equal(t, []string{"Phone:required"}, fieldFailures(err))
+}
+
+func TestDatedRulesHistory(t *testing.T) {
+	store := NewFileRuleStore(filepath.Join(t.TempDir(), "rules.json"))
+	vp := newTestProvider()
+	assert.NoError(t, vp.SetRuleStore(store))
+	_, err := vp.UpdateTenantRules("2", 0, "ops", map[string]string{"Age": "max=60"})
+	assert.NoError(t, err)
+	dated := []DatedRules{{Rules: map[string]string{"Phone": "required"}}}
+	assert.NoError(t, vp.SetTenantDatedRules("2", "ops", dated))
+
+	history, err := vp.TenantRuleHistory("2")
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, dated, history[1].Dated)
+	assert.Equal(t, map[string]string{"Age": "max=60"}, history[1].Rules)
+	assert.NotEqual(t, history[0].Hash, history[1].Hash)
+
+	// the store holds the dated rules
+	reloaded := newTestProvider()
+	assert.NoError(t, reloaded.SetRuleStore(store))
+	reloadedDated, err := reloaded.TenantDatedRules("2")
+	assert.NoError(t, err)
+	assert.Equal(t, dated, reloadedDated)
+
+	// rolling back restores the dated rules of the version
+	_, err = vp.RollbackTenantRules("2", 2, 1, "ops")
+	assert.NoError(t, err)
+	dated, err = vp.TenantDatedRules("2")
+	assert.NoError(t, err)
+	assert.Empty(t, dated)
+}
+
+func TestSetTenantDatedRulesInvalid(t *testing.T) {
+	vp := newTestProvider()
+	from := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := vp.SetTenantDatedRules("2", "ops", []DatedRules{{EffectiveFrom: from, EffectiveUntil: from, Rules: map[string]string{"Age": "min=21"}}})
+	assert.Error(t, err)
+	err = vp.SetTenantDatedRules("2", "ops", []DatedRules{{EffectiveFrom: from, Rules: map[string]string{"Unknown": "required"}}})
+	var lintErr *RuleLintError
+	assert.ErrorAs(t, err, &lintErr)
+	dated, err := vp.TenantDatedRules("2")
+	assert.NoError(t, err)
+	assert.Empty(t, dated)
+}
+
+func fieldFailures(err error) []string {
+	var failures []string
+	if fieldErrors, ok := err.(ValidationErrors); ok {
+		for _, fe := range fieldErrors {
+			failures = append(failures, fe.Field()+":"+fe.Tag())
+		}
+	}
+	return failures
+}
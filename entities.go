@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ErrUnregisteredEntity is returned when validating an entity whose type was not registered
+var ErrUnregisteredEntity = errors.New("entity type is not registered")
+
+// EntityRules are the validations of an entity type: map rules by field and a struct level function
+type EntityRules struct {
+	Rules       map[string]string
+	StructLevel validator.StructLevelFunc
+}
+
+// entityRegistration holds the default and tenant validations of a registered entity type
+type entityRegistration struct {
+	defaults EntityRules
+	tenants  map[int]EntityRules
+}
+
+// Register declares an entity type validated by Validate with default rules applied to all tenants
+// and rules contributed by tenants on top of them. Entity types are referenced by name, ex: by disabled rules,
+// a type named like a registered one, or like POCUser, is rejected.
+// Registering POCUser adds its rules and struct level functions to the ones of the user validations,
+// ex: EffectiveUserRules, users are still validated by ValidateUserWithRulesValidation.
+// tenantOverrides are keyed by tenant ID.
+func Register[T any](vp *POCDefaultValidationProvider, defaults EntityRules, tenantOverrides map[string]EntityRules) error {
+	var zero T
+	t := reflect.TypeOf(zero)
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot register %v: entities must be structs", t)
+	}
+	if err := checkEntityRules(t, defaults); err != nil {
+		return err
+	}
+	tenants := make(map[int]EntityRules, len(tenantOverrides))
+	for tenant, rules := range tenantOverrides {
+		tenantID, err := vp.configuredTenantKey(tenant)
+		if err != nil {
+			return err
+		}
+		if err := checkEntityRules(t, rules); err != nil {
+			return fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+		tenants[tenantID] = rules
+	}
+
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	if _, ok := vp.entities[t]; ok {
+		return fmt.Errorf("%s is already registered", t.Name())
+	}
+	// rules, disabled rules and errors reference entities by type name
+	for _, e := range vp.namedEntities() {
+		if other := reflect.TypeOf(e); other != t && other.Name() == t.Name() {
+			return fmt.Errorf("cannot register %v: %v is already named %s", t, other, t.Name())
+		}
+	}
+	vp.entities[t] = &entityRegistration{defaults: defaults, tenants: tenants}
+	vp.validationEntities = composeEntityFieldsMap(vp.fieldNames, vp.namedEntities()...)
+	vp.generation++
+	return nil
+}
+
+// SetTenantEntityRules sets the rules a tenant contributes to a registered entity type, entity is a value of the type.
+// The map rules and the struct level function replace the ones given at registration and are versioned with
+// the tenant rules. Empty map rules restore the ones given at registration, a nil struct level function keeps
+// the current one.
+func (vp *POCDefaultValidationProvider) SetTenantEntityRules(tenant string, entity any, rules EntityRules) error {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return err
+	}
+	t := entityType(entity)
+	if err := checkEntityRules(t, rules); err != nil {
+		return err
+	}
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	if _, ok := vp.entities[t]; !ok {
+		return fmt.Errorf("%v: %w", t, ErrUnregisteredEntity)
+	}
+	set := vp.ruleSetOf(tenantID)
+	set.entities = copyEntityRules(set.entities)
+	if set.entities == nil {
+		set.entities = make(map[string]map[string]string)
+	}
+	if len(rules.Rules) > 0 {
+		set.entities[t.Name()] = rules.Rules
+	} else {
+		delete(set.entities, t.Name())
+	}
+	if rules.StructLevel != nil {
+		set.structLevels = copyStructLevels(set.structLevels)
+		if set.structLevels == nil {
+			set.structLevels = make(map[string]validator.StructLevelFunc)
+		}
+		set.structLevels[t.Name()] = rules.StructLevel
+	}
+	_, err = vp.activateRules(tenantID, set, "", "rules of "+t.Name())
+	return err
+}
+
+// EffectiveEntityRules returns the map rules applied to a registered entity type for a tenant: the default rules,
+// then the rules of the ancestors of the tenant and its own, replacing the ones of the ancestors on their fields.
+// entity is a value of the type.
+func (vp *POCDefaultValidationProvider) EffectiveEntityRules(tenant string, entity any) (map[string]string, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return vp.effectiveEntityRules(tenantID, entityType(entity))
+}
+
+// effectiveEntityRules returns the map rules applied to a registered entity type for a tenant, see EffectiveEntityRules
+func (vp *POCDefaultValidationProvider) effectiveEntityRules(tenantID int, t reflect.Type) (map[string]string, error) {
+	chain := vp.tenantChain(tenantID)
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	registration, ok := vp.entities[t]
+	if !ok {
+		return nil, fmt.Errorf("%v: %w", t, ErrUnregisteredEntity)
+	}
+	return registration.rules(t.Name(), chain, vp.tenantEntityRules), nil
+}
+
+// EntityRuleOrigins returns where each effective map rule of a registered entity type comes from for a tenant,
+// see UserRuleOrigins. entity is a value of the type.
+func (vp *POCDefaultValidationProvider) EntityRuleOrigins(tenant string, entity any) ([]RuleOrigin, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return nil, err
+	}
+	t := entityType(entity)
+	chain := vp.tenantChain(tenantID)
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	registration, ok := vp.entities[t]
+	if !ok {
+		return nil, fmt.Errorf("%v: %w", t, ErrUnregisteredEntity)
+	}
+	return originsOf(registration.layers(t.Name(), chain, vp.tenantEntityRules, vp.tenantLabel)), nil
+}
+
+// entityNamed returns POCUser or the registered entity type of a name, ex: Address
+func (vp *POCDefaultValidationProvider) entityNamed(name string) (reflect.Type, bool) {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	for _, e := range vp.namedEntities() {
+		if t := reflect.TypeOf(e); t.Name() == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// rules returns the map rules of the entity named name for a tenant chain, root first.
+// tenantRules are the versioned rules of the tenants on registered entities, by tenant and type name,
+// they replace the rules given at registration. The rules of a tenant replace the ones of its ancestors on their
+// fields, see composeLayers.
+func (r *entityRegistration) rules(name string, chain []int, tenantRules map[int]map[string]map[string]string) map[string]string {
+	return decorateLayers(r.layers(name, chain, tenantRules, nil))
+}
+
+// layers returns the rule layers of the entity named name for a tenant chain, see rules.
+// Layers are given a source when label names tenants, see tenantLabel.
+func (r *entityRegistration) layers(name string, chain []int, tenantRules map[int]map[string]map[string]string, label func(int) string) []ruleLayer {
+	layers := []ruleLayer{{source: "registration", rules: r.defaults.Rules}}
+	for _, key := range chain {
+		rules, ok := tenantRules[key][name]
+		source := " entity rules"
+		if !ok {
+			rules, source = r.tenants[key].Rules, " registration"
+		}
+		layer := ruleLayer{rules: rules, scope: key}
+		if label != nil {
+			layer.source = label(key) + source
+		}
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+// structLevel returns the default and tenant struct level functions of the entity named name for a tenant chain,
+// root first, guarded through a slot. tenantStructLevels are the versioned struct level functions of the tenants
+// on registered entities, by tenant and type name, they replace the ones given at registration.
+func (r *entityRegistration) structLevel(name string, chain []int, tenantStructLevels map[int]map[string]validator.StructLevelFunc, slot *guardSlot) []validator.StructLevelFunc {
+	var structLevel []validator.StructLevelFunc
+	if f := r.defaults.StructLevel; f != nil {
+		structLevel = append(structLevel, slot.structFunc(name+".StructLevel", f))
+	}
+	for _, key := range chain {
+		f, ok := tenantStructLevels[key][name]
+		if !ok {
+			f = r.tenants[key].StructLevel
+		}
+		if f != nil {
+			structLevel = append(structLevel, slot.structFunc(name+".TenantStructLevel", f))
+		}
+	}
+	return structLevel
+}
+
+// registeredUserLayers returns the rule layers of POCUser when it is registered: the default layer,
+// then the layers of every tenant of a chain, none when it is not registered
+func (vp *POCDefaultValidationProvider) registeredUserLayers(chain []int) (ruleLayer, map[int][]ruleLayer) {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	registration, ok := vp.entities[reflect.TypeOf(POCUser{})]
+	if !ok {
+		return ruleLayer{}, nil
+	}
+	tenants := make(map[int][]ruleLayer, len(chain))
+	for _, key := range chain {
+		label := vp.tenantLabel(key)
+		// rules set by the tenant replace the ones given at registration
+		if rules, ok := vp.tenantEntityRules[key]["POCUser"]; ok {
+			tenants[key] = []ruleLayer{{source: label + " entity rules", rules: rules, scope: key}}
+		} else {
+			tenants[key] = []ruleLayer{{source: label + " registration", rules: registration.tenants[key].Rules, scope: key}}
+		}
+	}
+	return ruleLayer{source: "registration", rules: registration.defaults.Rules}, tenants
+}
+
+// registeredUserStructLevel returns the struct level functions of POCUser for a tenant chain when it is registered,
+// guarded through a slot
+func (vp *POCDefaultValidationProvider) registeredUserStructLevel(chain []int, slot *guardSlot) []validator.StructLevelFunc {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	if registration, ok := vp.entities[reflect.TypeOf(POCUser{})]; ok {
+		return registration.structLevel("POCUser", chain, vp.tenantStructLevels, slot)
+	}
+	return nil
+}
+
+// Validate validates an entity of any registered type, or a POCUser, for the tenant of the context.
+// Pointers to entities are validated as the entity they point to. Asynchronous validators only apply to users.
+func (vp *POCDefaultValidationProvider) Validate(ctx context.Context, entity any) (err error) {
+	value := reflect.ValueOf(entity)
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+	if !value.IsValid() || value.Kind() == reflect.Ptr {
+		return errors.New("cannot validate a nil entity")
+	}
+	entity = value.Interface()
+	// registered or not, users have their dedicated validation
+	if user, ok := entity.(POCUser); ok {
+		return vp.ValidateUserWithRulesValidation(ctx, user)
+	}
+
+	if !vp.entityRegistered(value.Type()) {
+		return fmt.Errorf("%v: %w", value.Type(), ErrUnregisteredEntity)
+	}
+	tenantID, err := vp.tenantFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	entityName := value.Type().Name()
+	guard := vp.newPanicGuard(tenantID, entity)
+	if len(vp.hooks) > 0 {
+		info := vp.validationInfo(ctx, tenantID, entityName)
+		ctx = vp.hooks.BeforeValidate(ctx, info)
+		defer vp.afterValidate(ctx, info, time.Now(), &err)
+		guard.withHooks(ctx, vp.hooks, info)
+	}
+	asOf := vp.asOf(ctx, entity)
+	defer vp.metrics.observe(vp.tenantIDOf(tenantID), entityName, time.Now(), &err)
+	defer vp.recordAudit(ctx, tenantID, value.Type(), asOf, &err)
+	defer vp.redactErrors(&err)
+	defer vp.recoverValidation(ctx, guard, &err)
+	validate, err := vp.entitiesValidate("entities", tenantID, nil, guard)
+	if err != nil {
+		return err
+	}
+	defer vp.validatorCache.release(validate)
+	err = validate.validate.StructCtx(ctx, addressable(entity))
+	vp.evaluateStrippedTags(ctx, tenantID, guard, value, validate.stripped)
+	if err != nil {
+		err = vp.describeErrors(ctx, tenantID, value.Type(), guard.convert(err))
+		return vp.suppressDisabledRules(ctx, tenantID, value.Type(), err)
+	}
+	return nil
+}
+
+// validateEntityRules validates a registered entity for a tenant with the given entity rules of the tenant itself,
+// by type name, in place of its active ones. Unlike Validate, nothing is recorded.
+func (vp *POCDefaultValidationProvider) validateEntityRules(ctx context.Context, tenantID int, entities map[string]map[string]string, entity any) error {
+	guard := vp.newPanicGuard(tenantID, entity)
+	validate, err := vp.entitiesValidate("replay", tenantID, entities, guard)
+	if err != nil {
+		return err
+	}
+	defer vp.validatorCache.release(validate)
+	return guard.convert(validate.validate.StructCtx(ctx, addressable(entity)))
+}
+
+// entitiesValidate returns a validator applying the default and tenant rules of every registered entity type,
+// so that registered entities nested in the validated one are validated too, for the validation of a guard.
+// It must be released once the validation is done. Validators are cached by purpose and rebuilt once the rules
+// or the registrations change, see validatorCache.
+// The tags of disabled rules are removed from the rules and kept by entity type, see evaluateStrippedTags.
+// Entity rules given by type name stand for the ones of the tenant itself, the active ones apply when nil.
+func (vp *POCDefaultValidationProvider) entitiesValidate(purpose string, tenantID int, entities map[string]map[string]string, guard *panicGuard) (*cachedValidator, error) {
+	chain := vp.tenantChain(tenantID)
+	disabled := vp.disabledRulesOf(chain)
+	rules := make(map[string]map[string]string)
+	stripped := make(map[reflect.Type][]strippedTag)
+	vp.mu.RLock()
+	tenantRules := vp.tenantEntityRules
+	if entities != nil {
+		tenantRules = make(map[int]map[string]map[string]string, len(vp.tenantEntityRules)+1)
+		for key, rules := range vp.tenantEntityRules {
+			tenantRules[key] = rules
+		}
+		tenantRules[tenantID] = entities
+	}
+	for t, registration := range vp.entities {
+		r, tags := withoutDisabledTags(t.Name(), registration.rules(t.Name(), chain, tenantRules), disabled)
+		if len(tags) > 0 {
+			stripped[t] = tags
+		}
+		rules[t.Name()] = r
+	}
+	generation := vp.generation
+	vp.mu.RUnlock()
+
+	cached, err := vp.validatorCache.acquire(purpose, chain, validatorFingerprint(generation, rules, nil), guard, func(slot *guardSlot) (*cachedValidator, error) {
+		validate, err := vp.newValidate(chain, slot)
+		if err != nil {
+			return nil, err
+		}
+		vp.mu.RLock()
+		defer vp.mu.RUnlock()
+		for t, registration := range vp.entities {
+			zero := reflect.Zero(t).Interface()
+			if len(rules[t.Name()]) > 0 {
+				validate.RegisterStructValidationMapRules(rules[t.Name()], zero)
+			}
+			if structLevel := registration.structLevel(t.Name(), chain, vp.tenantStructLevels, slot); len(structLevel) > 0 {
+				validate.RegisterStructValidation(decorateStructValidation(structLevel...), zero)
+			}
+		}
+		return &cachedValidator{validate: validate}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the same rules may be left by other disabled rules, the stripped tags are the ones of this validation
+	cached.stripped = stripped
+	return cached, nil
+}
+
+// registeredEntity returns the registered entity type of the given name
+func (vp *POCDefaultValidationProvider) registeredEntity(name string) (reflect.Type, bool) {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	for t := range vp.entities {
+		if t.Name() == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// entityRegistered reports whether an entity type is registered
+func (vp *POCDefaultValidationProvider) entityRegistered(t reflect.Type) bool {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	_, ok := vp.entities[t]
+	return ok
+}
+
+// namedEntities returns a value of POCUser and of every other registered entity type. vp.mu must be held.
+func (vp *POCDefaultValidationProvider) namedEntities() []interface{} {
+	entities := []interface{}{POCUser{}}
+	for t := range vp.entities {
+		if t != reflect.TypeOf(POCUser{}) {
+			entities = append(entities, reflect.Zero(t).Interface())
+		}
+	}
+	return entities
+}
+
+// checkEntityRules returns an error when a map rule targets a field the entity type does not have
+func checkEntityRules(t reflect.Type, rules EntityRules) error {
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("%v is not a struct", t)
+	}
+	for field := range rules.Rules {
+		if _, ok := t.FieldByName(field); !ok {
+			return fmt.Errorf("rule field %s does not exist on %s", field, t.Name())
+		}
+	}
+	return nil
+}
+
+// entityType returns the struct type of an entity, through pointers
+func entityType(entity any) reflect.Type {
+	t := reflect.TypeOf(entity)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
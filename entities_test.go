@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+type testOrder struct {
+	Reference string
+	Shipping  Address
+}
+
+func TestRegisterEntities(t *testing.T) {
+	vp := newTestProvider()
+	assert.NoError(t, Register[Address](vp, EntityRules{Rules: map[string]string{"ZipCode": "required"}},
+		map[string]EntityRules{"2": {Rules: map[string]string{"Province": "isprovincecode"}}}))
+	assert.NoError(t, Register[testOrder](vp, EntityRules{
+		Rules: map[string]string{"Reference": "required"},
+		StructLevel: func(sl validator.StructLevel) {
+			if sl.Current().Interface().(testOrder).Reference == "blocked" {
+				sl.ReportError("blocked", "Reference", "Reference", "blocked", "")
+			}
+		},
+	}, nil))
+	assert.Error(t, Register[Address](vp, EntityRules{}, nil))
+	assert.Error(t, Register[Account](vp, EntityRules{Rules: map[string]string{"Unknown": "required"}}, nil))
+	assert.Error(t, Register[string](vp, EntityRules{}, nil))
+
+	tenantA := context.WithValue(context.Background(), "tenant", 1)
+	tenantB := context.WithValue(context.Background(), "tenant", 2)
+	address := Address{ZipCode: "H2X1Y4", Province: "Quebec"}
+	assert.NoError(t, vp.Validate(tenantA, address))
+	assert.Equal(t, []string{"Province:isprovincecode"}, fieldFailures(vp.Validate(tenantB, &address)))
+	assert.Equal(t, []string{"ZipCode:required"}, fieldFailures(vp.Validate(tenantA, Address{})))
+
+	// registered entities nested in the validated one are validated too
+	order := testOrder{Reference: "blocked", Shipping: Address{Province: "QC"}}
+	assert.ElementsMatch(t, []string{"Reference:blocked", "ZipCode:required"}, fieldFailures(vp.Validate(tenantB, order)))
+
+	// tenants contribute rules at runtime
+	assert.NoError(t, vp.SetTenantEntityRules("1", &Address{}, EntityRules{Rules: map[string]string{"Province": "isprovincename"}}))
+	assert.Equal(t, []string{"Province:isprovincename"}, fieldFailures(vp.Validate(tenantA, Address{ZipCode: "H2X1Y4", Province: "QC"})))
+	rules, err := vp.EffectiveEntityRules("1", Address{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"ZipCode": "required", "Province": "isprovincename"}, rules)
+	assert.True(t, errors.Is(vp.SetTenantEntityRules("1", Account{}, EntityRules{}), ErrUnregisteredEntity))
+
+	// users keep their dedicated validation
+	user := provideValidUser()
+	user.Age = 17
+	assert.Equal(t, fieldFailures(vp.ValidateUserWithRulesValidation(tenantA, user)), fieldFailures(vp.Validate(tenantA, &user)))
+
+	assert.True(t, errors.Is(vp.Validate(tenantA, Account{}), ErrUnregisteredEntity))
+	assert.Error(t, vp.Validate(tenantA, (*Address)(nil)))
+}
+
+func TestRegisterSameNamedEntities(t *testing.T) {
+	vp := newTestProvider()
+	assert.NoError(t, Register[Address](vp, EntityRules{}, nil))
+
+	// types named like a registered one can not be told apart by disabled rules or errors
+	type Address struct{ ZipCode string }
+	type POCUser struct{ Email string }
+	assert.Error(t, Register[Address](vp, EntityRules{}, nil))
+	assert.Error(t, Register[POCUser](vp, EntityRules{}, nil))
+}
+
+func TestRegisterUser(t *testing.T) {
+	vp := newTestProvider()
+	assert.NoError(t, Register[POCUser](vp, EntityRules{
+		Rules: map[string]string{"Phone": "startswith=+1"},
+		StructLevel: func(sl validator.StructLevel) {
+			if sl.Current().Interface().(POCUser).Account.Balance < 0 {
+				sl.ReportError(nil, "Account", "Account", "overdrawn", "")
+			}
+		},
+	}, map[string]EntityRules{"2": {Rules: map[string]string{"Phone": "len=12"}}}))
+	assert.Error(t, Register[POCUser](vp, EntityRules{}, nil))
+
+	tenantA := context.WithValue(context.Background(), "tenant", 1)
+	user := provideValidUser()
+	assert.NoError(t, vp.Validate(tenantA, user))
+	assert.Contains(t, effectiveRules(t, vp, "1")["Phone"], "startswith=+1")
+	assert.NotContains(t, effectiveRules(t, vp, "1")["Phone"], "len=12")
+	assert.Contains(t, effectiveRules(t, vp, "2")["Phone"], "startswith=+1,len=12")
+	user.Phone = "+33155551212"
+	user.Account.Balance = -1
+	assert.ElementsMatch(t, []string{"Phone:startswith", "Account:overdrawn"}, fieldFailures(vp.Validate(tenantA, user)))
+	assert.ElementsMatch(t, []string{"Phone:startswith", "Account:overdrawn"}, fieldFailures(vp.ValidateUserWithRulesValidation(tenantA, user)))
+	assert.Contains(t, fieldFailures(vp.ValidateUserWithStructValidation(tenantA, user)), "Account:overdrawn")
+
+	// tenants contribute user rules like for any registered entity
+	assert.NoError(t, vp.SetTenantEntityRules("1", POCUser{}, EntityRules{Rules: map[string]string{"Phone": "len=13"}}))
+	user.Phone = "+16175551212"
+	assert.ElementsMatch(t, []string{"Phone:len", "Account:overdrawn"}, fieldFailures(vp.Validate(tenantA, user)))
+}
+
+func TestEntityValidatorsCached(t *testing.T) {
+	vp := newTestProvider()
+	assert.NoError(t, Register[Address](vp, EntityRules{Rules: map[string]string{"ZipCode": "required"}}, nil))
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, vp.Validate(ctx, Address{ZipCode: "H2X1Y4", Province: "Quebec"}))
+	}
+	assert.Len(t, vp.validatorCache.pools["entities[1]"].free, 1)
+
+	// rebuilt once the rules or the registrations change
+	assert.NoError(t, vp.SetTenantEntityRules("1", Address{}, EntityRules{Rules: map[string]string{"Province": "isprovincename"}}))
+	assert.Equal(t, []string{"Province:isprovincename"}, fieldFailures(vp.Validate(ctx, Address{ZipCode: "H2X1Y4", Province: "QC"})))
+	assert.NoError(t, Register[testOrder](vp, EntityRules{Rules: map[string]string{"Reference": "required"}}, nil))
+	assert.Equal(t, []string{"Reference:required"}, fieldFailures(vp.Validate(ctx, testOrder{Shipping: Address{ZipCode: "H2X1Y4", Province: "Quebec"}})))
+}
+
+func TestTenantEntityStructLevel(t *testing.T) {
+	vp := newTestProvider()
+	reportOn := func(field, value string) validator.StructLevelFunc {
+		return func(sl validator.StructLevel) {
+			if sl.Current().FieldByName(field).String() == value {
+				sl.ReportError(value, field, field, "blocked", "")
+			}
+		}
+	}
+	assert.NoError(t, Register[Address](vp, EntityRules{}, map[string]EntityRules{"1": {StructLevel: reportOn("Province", "XX")}}))
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+
+	// updating the rules only keeps the struct level function
+	assert.NoError(t, vp.SetTenantEntityRules("1", Address{}, EntityRules{Rules: map[string]string{"Province": "len=2"}}))
+	_, v1, err := vp.TenantRules("1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Province:blocked"}, fieldFailures(vp.Validate(ctx, Address{ZipCode: "H2X1Y4", Province: "XX"})))
+
+	assert.NoError(t, vp.SetTenantEntityRules("1", Address{}, EntityRules{Rules: map[string]string{"Province": "len=2"}, StructLevel: reportOn("ZipCode", "00000")}))
+	_, v2, err := vp.TenantRules("1")
+	assert.NoError(t, err)
+	assert.NoError(t, vp.Validate(ctx, Address{ZipCode: "H2X1Y4", Province: "XX"}))
+	assert.Equal(t, []string{"ZipCode:blocked"}, fieldFailures(vp.Validate(ctx, Address{ZipCode: "00000", Province: "QC"})))
+
+	// struct level functions are versioned with the rules
+	_, err = vp.RollbackTenantRules("1", v2, v1, "ops")
+	assert.NoError(t, err)
+	assert.NoError(t, vp.Validate(ctx, Address{ZipCode: "00000", Province: "QC"}))
+	assert.Equal(t, []string{"Province:blocked"}, fieldFailures(vp.Validate(ctx, Address{ZipCode: "H2X1Y4", Province: "XX"})))
+}
@@ -0,0 +1,728 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+//
+// expression language used by tenants to declare rules without writing Go code, ex:
+//   Age >= 20 && Age <= 40
+//   startsWith(FirstName, "S")
+//   len(Addresses) <= 3
+//
+// Expressions are sandboxed: they can only read exported fields of the entity, call the built-in functions below
+// and have no loops. They are compiled and type-checked against the entity struct once and evaluated with a step
+// and time budget.
+//
+
+const (
+	maxExpressionLength = 1024
+	maxExpressionDepth  = 64
+	// DefaultExpressionMaxSteps is the default number of evaluation steps allowed per expression
+	DefaultExpressionMaxSteps = 10000
+	// DefaultExpressionTimeout is the default time allowed to evaluate an expression
+	DefaultExpressionTimeout = 10 * time.Millisecond
+)
+
+// ErrExpressionBudget is returned when an expression exceeds its step or time budget
+var ErrExpressionBudget = errors.New("expression exceeded its evaluation budget")
+
+type exprType int
+
+const (
+	typeBool exprType = iota
+	typeNumber
+	typeString
+	typeList
+)
+
+func (t exprType) String() string {
+	switch t {
+	case typeBool:
+		return "bool"
+	case typeNumber:
+		return "number"
+	case typeString:
+		return "string"
+	default:
+		return "list"
+	}
+}
+
+// Expression is a compiled expression bound to an entity type
+type Expression struct {
+	source   string
+	entity   reflect.Type
+	root     exprNode
+	MaxSteps int
+	Timeout  time.Duration
+}
+
+// ExpressionRule is a tenant rule written in the expression language
+type ExpressionRule struct {
+	Field      string `json:"field"`         // struct field the violation is reported on
+	Tag        string `json:"tag,omitempty"` // rule name reported on violation, "expr" when empty
+	Expression string `json:"expression"`
+}
+
+// CompileExpression parses the expression and type-checks it against the entity struct.
+// The expression must evaluate to a bool.
+func CompileExpression(expression string, entity any) (*Expression, error) {
+	t := reflect.TypeOf(entity)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expression entity must be a struct, got %T", entity)
+	}
+	if len(expression) > maxExpressionLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", maxExpressionLength)
+	}
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens, entity: t}
+	root, err := p.parseExpression(0)
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %w", expression, err)
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("expression %q: unexpected %q", expression, p.peek().text)
+	}
+	if root.typ() != typeBool {
+		return nil, fmt.Errorf("expression %q: must evaluate to bool, got %s", expression, root.typ())
+	}
+	return &Expression{
+		source:   expression,
+		entity:   t,
+		root:     root,
+		MaxSteps: DefaultExpressionMaxSteps,
+		Timeout:  DefaultExpressionTimeout,
+	}, nil
+}
+
+// String returns the expression source
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression against the given entity, which must be of the type the expression was compiled for.
+func (e *Expression) Eval(ctx context.Context, entity any) (bool, error) {
+	v := reflect.ValueOf(entity)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return false, fmt.Errorf("expression %q: nil entity", e.source)
+		}
+		v = v.Elem()
+	}
+	if v.Type() != e.entity {
+		return false, fmt.Errorf("expression %q: compiled for %s, got %s", e.source, e.entity, v.Type())
+	}
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+	state := &evalState{ctx: ctx, maxSteps: e.MaxSteps}
+	result, err := e.root.eval(state, v)
+	if err != nil {
+		return false, fmt.Errorf("expression %q: %w", e.source, err)
+	}
+	return result.(bool), nil
+}
+
+// evalState tracks the budget of a single evaluation
+type evalState struct {
+	ctx      context.Context
+	steps    int
+	maxSteps int
+}
+
+func (s *evalState) step() error {
+	s.steps++
+	if s.maxSteps > 0 && s.steps > s.maxSteps {
+		return ErrExpressionBudget
+	}
+	// checking the context is more expensive than counting, only do it every few steps
+	if s.steps%64 == 0 && s.ctx.Err() != nil {
+		return ErrExpressionBudget
+	}
+	return nil
+}
+
+//
+// lexer
+//
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokenNumber, src[i:j]})
+			i = j
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			text, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d: %w", i, err)
+			}
+			tokens = append(tokens, token{tokenString, text})
+			i = j + 1
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(src) && (unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j])) || src[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, token{tokenIdent, src[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", ",", "."} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			tokens = append(tokens, token{tokenOperator, op})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+//
+// parser and type checker
+//
+
+type exprParser struct {
+	tokens []token
+	pos    int
+	entity reflect.Type
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) expect(op string) error {
+	if t := p.next(); t.kind != tokenOperator || t.text != op {
+		return fmt.Errorf("expected %q, got %q", op, t.text)
+	}
+	return nil
+}
+
+// binary operators by precedence, lowest first
+var exprPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) parseExpression(depth int) (exprNode, error) {
+	return p.parseBinary(0, depth)
+}
+
+func (p *exprParser) parseBinary(level, depth int) (exprNode, error) {
+	if depth > maxExpressionDepth {
+		return nil, fmt.Errorf("expression is nested too deeply")
+	}
+	if level == len(exprPrecedence) {
+		return p.parseUnary(depth)
+	}
+	left, err := p.parseBinary(level+1, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokenOperator || !containsString(exprPrecedence[level], t.text) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(level+1, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		left, err = newBinaryNode(t.text, left, right)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *exprParser) parseUnary(depth int) (exprNode, error) {
+	t := p.peek()
+	if t.kind == tokenOperator && (t.text == "!" || t.text == "-") {
+		p.next()
+		operand, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		want := typeBool
+		if t.text == "-" {
+			want = typeNumber
+		}
+		if operand.typ() != want {
+			return nil, fmt.Errorf("operator %s expects %s, got %s", t.text, want, operand.typ())
+		}
+		return &unaryNode{op: t.text, operand: operand}, nil
+	}
+	return p.parsePrimary(depth)
+}
+
+func (p *exprParser) parsePrimary(depth int) (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return &literalNode{t: typeNumber, value: n}, nil
+	case tokenString:
+		return &literalNode{t: typeString, value: t.text}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			return &literalNode{t: typeBool, value: t.text == "true"}, nil
+		}
+		if next := p.peek(); next.kind == tokenOperator && next.text == "(" {
+			return p.parseCall(t.text, depth)
+		}
+		path := []string{t.text}
+		for next := p.peek(); next.kind == tokenOperator && next.text == "."; next = p.peek() {
+			p.next()
+			name := p.next()
+			if name.kind != tokenIdent {
+				return nil, fmt.Errorf("expected field name after %q", strings.Join(path, "."))
+			}
+			path = append(path, name.text)
+		}
+		return newFieldNode(p.entity, path)
+	case tokenOperator:
+		if t.text == "(" {
+			node, err := p.parseExpression(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		}
+	}
+	if t.kind == tokenEOF {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+func (p *exprParser) parseCall(name string, depth int) (exprNode, error) {
+	fn, ok := exprFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []exprNode
+	for p.peek().text != ")" || p.peek().kind != tokenOperator {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseExpression(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	if len(args) != len(fn.args) {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", name, len(fn.args), len(args))
+	}
+	for i, arg := range args {
+		if !fn.accepts(i, arg.typ()) {
+			return nil, fmt.Errorf("%s argument %d: unexpected %s", name, i+1, arg.typ())
+		}
+	}
+	return &callNode{name: name, fn: fn, args: args}, nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// nodes
+//
+
+type exprNode interface {
+	typ() exprType
+	eval(s *evalState, entity reflect.Value) (any, error)
+}
+
+type literalNode struct {
+	t     exprType
+	value any
+}
+
+func (n *literalNode) typ() exprType { return n.t }
+
+func (n *literalNode) eval(s *evalState, _ reflect.Value) (any, error) {
+	return n.value, s.step()
+}
+
+// fieldNode reads a (possibly nested) field of the entity.
+// A nil pointer along the path evaluates to the zero value of the field type.
+type fieldNode struct {
+	path  string
+	index [][]int
+	t     exprType
+}
+
+func newFieldNode(entity reflect.Type, path []string) (exprNode, error) {
+	node := &fieldNode{path: strings.Join(path, ".")}
+	current := entity
+	for _, name := range path {
+		for current.Kind() == reflect.Ptr {
+			current = current.Elem()
+		}
+		if current.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("%s: %s is not a struct", node.path, current)
+		}
+		field, ok := current.FieldByName(name)
+		if !ok || !field.IsExported() {
+			return nil, fmt.Errorf("unknown field %s on %s", name, current.Name())
+		}
+		node.index = append(node.index, field.Index)
+		current = field.Type
+	}
+	for current.Kind() == reflect.Ptr {
+		current = current.Elem()
+	}
+	switch current.Kind() {
+	case reflect.String:
+		node.t = typeString
+	case reflect.Bool:
+		node.t = typeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		node.t = typeNumber
+	case reflect.Slice, reflect.Array, reflect.Map:
+		node.t = typeList
+	default:
+		return nil, fmt.Errorf("field %s has unsupported type %s", node.path, current)
+	}
+	return node, nil
+}
+
+func (n *fieldNode) typ() exprType { return n.t }
+
+func (n *fieldNode) eval(s *evalState, entity reflect.Value) (any, error) {
+	if err := s.step(); err != nil {
+		return nil, err
+	}
+	v := entity
+	for _, index := range n.index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return n.zero(), nil
+			}
+			v = v.Elem()
+		}
+		v = v.FieldByIndex(index)
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return n.zero(), nil
+		}
+		v = v.Elem()
+	}
+	switch n.t {
+	case typeString:
+		return v.String(), nil
+	case typeBool:
+		return v.Bool(), nil
+	case typeList:
+		return v, nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	default:
+		return v.Float(), nil
+	}
+}
+
+func (n *fieldNode) zero() any {
+	switch n.t {
+	case typeString:
+		return ""
+	case typeBool:
+		return false
+	case typeNumber:
+		return float64(0)
+	default:
+		return reflect.Value{}
+	}
+}
+
+type unaryNode struct {
+	op      string
+	operand exprNode
+}
+
+func (n *unaryNode) typ() exprType { return n.operand.typ() }
+
+func (n *unaryNode) eval(s *evalState, entity reflect.Value) (any, error) {
+	if err := s.step(); err != nil {
+		return nil, err
+	}
+	v, err := n.operand.eval(s, entity)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !v.(bool), nil
+	}
+	return -v.(float64), nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+	t           exprType
+}
+
+func newBinaryNode(op string, left, right exprNode) (exprNode, error) {
+	lt, rt := left.typ(), right.typ()
+	node := &binaryNode{op: op, left: left, right: right}
+	switch op {
+	case "&&", "||":
+		if lt != typeBool || rt != typeBool {
+			return nil, fmt.Errorf("operator %s expects bool operands, got %s and %s", op, lt, rt)
+		}
+		node.t = typeBool
+	case "==", "!=":
+		if lt != rt || lt == typeList {
+			return nil, fmt.Errorf("cannot compare %s with %s", lt, rt)
+		}
+		node.t = typeBool
+	case "<", "<=", ">", ">=":
+		if lt != rt || (lt != typeNumber && lt != typeString) {
+			return nil, fmt.Errorf("operator %s cannot order %s and %s", op, lt, rt)
+		}
+		node.t = typeBool
+	default:
+		if lt != typeNumber || rt != typeNumber {
+			return nil, fmt.Errorf("operator %s expects number operands, got %s and %s", op, lt, rt)
+		}
+		node.t = typeNumber
+	}
+	return node, nil
+}
+
+func (n *binaryNode) typ() exprType { return n.t }
+
+func (n *binaryNode) eval(s *evalState, entity reflect.Value) (any, error) {
+	if err := s.step(); err != nil {
+		return nil, err
+	}
+	left, err := n.left.eval(s, entity)
+	if err != nil {
+		return nil, err
+	}
+	// short-circuit boolean operators
+	switch n.op {
+	case "&&":
+		if !left.(bool) {
+			return false, nil
+		}
+		return n.right.eval(s, entity)
+	case "||":
+		if left.(bool) {
+			return true, nil
+		}
+		return n.right.eval(s, entity)
+	}
+	right, err := n.right.eval(s, entity)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	}
+	if l, ok := left.(string); ok {
+		r := right.(string)
+		switch n.op {
+		case "<":
+			return l < r, nil
+		case "<=":
+			return l <= r, nil
+		case ">":
+			return l > r, nil
+		default:
+			return l >= r, nil
+		}
+	}
+	l, r := left.(float64), right.(float64)
+	switch n.op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	default:
+		if int64(r) == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return float64(int64(l) % int64(r)), nil
+	}
+}
+
+//
+// built-in functions
+//
+
+type exprFunction struct {
+	args []exprType // accepted argument types, typeList on len also accepts strings
+	ret  exprType
+	call func(args []any) any
+}
+
+func (f exprFunction) accepts(i int, t exprType) bool {
+	if f.args[i] == typeList {
+		return t == typeList || t == typeString
+	}
+	return f.args[i] == t
+}
+
+var exprFunctions = map[string]exprFunction{
+	"len": {args: []exprType{typeList}, ret: typeNumber, call: func(args []any) any {
+		switch v := args[0].(type) {
+		case string:
+			return float64(len([]rune(v)))
+		case reflect.Value:
+			if !v.IsValid() {
+				return float64(0)
+			}
+			return float64(v.Len())
+		}
+		return float64(0)
+	}},
+	"startsWith": {args: []exprType{typeString, typeString}, ret: typeBool, call: func(args []any) any {
+		return strings.HasPrefix(args[0].(string), args[1].(string))
+	}},
+	"endsWith": {args: []exprType{typeString, typeString}, ret: typeBool, call: func(args []any) any {
+		return strings.HasSuffix(args[0].(string), args[1].(string))
+	}},
+	"contains": {args: []exprType{typeString, typeString}, ret: typeBool, call: func(args []any) any {
+		return strings.Contains(args[0].(string), args[1].(string))
+	}},
+	"lower": {args: []exprType{typeString}, ret: typeString, call: func(args []any) any {
+		return strings.ToLower(args[0].(string))
+	}},
+	"upper": {args: []exprType{typeString}, ret: typeString, call: func(args []any) any {
+		return strings.ToUpper(args[0].(string))
+	}},
+}
+
+type callNode struct {
+	name string
+	fn   exprFunction
+	args []exprNode
+}
+
+func (n *callNode) typ() exprType { return n.fn.ret }
+
+func (n *callNode) eval(s *evalState, entity reflect.Value) (any, error) {
+	if err := s.step(); err != nil {
+		return nil, err
+	}
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(s, entity)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return n.fn.call(args), nil
+}
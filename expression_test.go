@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpressionEval(t *testing.T) {
+	user := POCUser{
+		BaseUser:  BaseUser{LastName: "Smith"},
+		FirstName: "Sam",
+		Age:       25,
+		Addresses: []*Address{{ZipCode: "H2X"}, {ZipCode: "T2Y"}},
+	}
+	for _, tc := range []struct {
+		expression string
+		valid      bool
+	}{
+		{`Age >= 20 && Age <= 40`, true},
+		{`Age < 20 || Age > 40`, false},
+		{`startsWith(FirstName, "S")`, true},
+		{`!startsWith(FirstName, "P")`, true},
+		{`len(Addresses) <= 3`, true},
+		{`len(FirstName) == 3 && LastName == "Smith"`, true},
+		{`Account.Balance >= 0`, true}, // nil account reads as zero
+		{`(Age + 5) * 2 == 60`, true},
+		{`lower(FirstName) == "sam"`, true},
+	} {
+		t.Run(tc.expression, func(t *testing.T) {
+			e, err := CompileExpression(tc.expression, POCUser{})
+			assert.NoError(t, err)
+			valid, err := e.Eval(context.Background(), user)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.valid, valid)
+		})
+	}
+}
+
+func TestExpressionTypeCheck(t *testing.T) {
+	for _, expression := range []string{
+		`Age`,                        // not a bool
+		`Age >= "20"`,                // mismatched types
+		`Unknown == 1`,               // unknown field
+		`startsWith(Age, "S")`,       // wrong argument type
+		`startsWith(FirstName)`,      // wrong arity
+		`exec("rm -rf")`,             // unknown function
+		`Account == 1`,               // struct fields cannot be compared
+		`Age >= 20 &&`,               // incomplete
+		`FirstName == "unterminated`, // unterminated string
+	} {
+		t.Run(expression, func(t *testing.T) {
+			_, err := CompileExpression(expression, POCUser{})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestExpressionBudget(t *testing.T) {
+	e, err := CompileExpression(`Age > 1 && Age > 2 && Age > 3 && Age > 4`, POCUser{})
+	assert.NoError(t, err)
+	e.MaxSteps = 5
+	_, err = e.Eval(context.Background(), POCUser{Age: 30})
+	assert.ErrorIs(t, err, ErrExpressionBudget)
+}
+
+func TestProviderExpressionRules(t *testing.T) {
+	vp := NewPOCDefaultValidationProvider()
+	vp.SetTenantValidator("2", NewTenantBUserValidator())
+	_, err := vp.UpdateTenantExpressionRules("2", 0, "ops", []ExpressionRule{{Field: "Age", Expression: `Age >= "20"`}})
+	var lintErr *RuleLintError
+	assert.ErrorAs(t, err, &lintErr)
+	v1, err := vp.UpdateTenantExpressionRules("2", 0, "ops", []ExpressionRule{
+		{Field: "Addresses", Tag: "maxaddresses", Expression: `len(Addresses) <= 1`},
+	})
+	assert.NoError(t, err)
+	_, err = vp.UpdateTenantExpressionRules("2", 0, "ops", nil)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	// expression rules are versioned with the other tenant rules
+	v2, err := vp.UpdateTenantRules("2", v1, "ops", map[string]string{"Phone": "omitempty,e164"})
+	assert.NoError(t, err)
+	history, err := vp.TenantRuleHistory("2")
+	assert.NoError(t, err)
+	assert.Equal(t, history[0].Expressions, history[1].Expressions)
+	expressions, err := vp.TenantExpressionRules("2")
+	assert.NoError(t, err)
+	assert.Equal(t, "maxaddresses", expressions[0].Tag)
+
+	user := POCUser{FirstName: "Sam", Age: 25, Email: "sam@mail.com", Addresses: []*Address{{ZipCode: "a"}, {ZipCode: "b"}}}
+	ctx := context.WithValue(context.Background(), "tenant", 2)
+	err = vp.ValidateUserWithRulesValidation(ctx, user)
+	assert.Error(t, err)
+	fieldErrors := err.(ValidationErrors)
+	assert.Len(t, fieldErrors, 1)
+	assert.Equal(t, "maxaddresses", fieldErrors[0].Tag())
+	assert.Equal(t, "POCUser.Addresses", fieldErrors[0].Namespace())
+
+	_, err = vp.RollbackTenantRules("2", v2, 0, "ops")
+	assert.ErrorIs(t, err, ErrUnknownRuleVersion)
+	v3, err := vp.UpdateTenantExpressionRules("2", v2, "ops", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(ctx, user))
+	_, err = vp.RollbackTenantRules("2", v3, v1, "ops")
+	assert.NoError(t, err)
+	assert.Error(t, vp.ValidateUserWithRulesValidation(ctx, user))
+}
+
+func TestAdminExpressionRules(t *testing.T) {
+	vp := NewPOCDefaultValidationProvider()
+	h := NewAdminHandler(vp, "secret")
+	w := adminRequest(t, h, http.MethodPut, "/tenants/2/expressions", `"0"`, `[{"field":"Age","expression":"Age >= \"20\""}]`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	w = adminRequest(t, h, http.MethodPut, "/tenants/2/expressions", `"0"`, `[{"field":"Addresses","expression":"len(Addresses) <= 1"}]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"version":1,"rules":{},"expressions":[{"field":"Addresses","tag":"expr","expression":"len(Addresses) <= 1"}]}`, w.Body.String())
+	w = adminRequest(t, h, http.MethodGet, "/tenants/2/rules", "", "")
+	assert.Contains(t, w.Body.String(), `"expressions"`)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+)
+
+// providerFieldError implements validator.FieldError for violations reported by the provider itself
+// (ex: asynchronous validators) so they can be returned in the same ValidationErrors as go-playground ones.
+type providerFieldError struct {
+	tag         string
+	actualTag   string
+	ns          string
+	structNs    string
+	field       string
+	structField string
+	value       interface{}
+	param       string
+	redacted    bool   // value already went through the redaction policy
+	message     string // end user message, rendered in the validation locale
+	path        string // tag aware dot path, ex: addresses[1].zipCode
+	pointer     string // RFC 6901 JSON pointer, ex: /addresses/1/zipCode
+}
+
+var _ validator.FieldError = (*providerFieldError)(nil)
+
+// newProviderFieldError returns a field error reported on the given field of the entity
+func newProviderFieldError(entity reflect.Type, field, tag, param string, value interface{}) *providerFieldError {
+	for entity.Kind() == reflect.Ptr {
+		entity = entity.Elem()
+	}
+	return &providerFieldError{
+		tag:         tag,
+		ns:          fmt.Sprintf("%s.%s", entity.Name(), field),
+		structNs:    fmt.Sprintf("%s.%s", entity.Name(), field),
+		field:       field,
+		structField: field,
+		value:       value,
+		param:       param,
+	}
+}
+
+func (fe *providerFieldError) Tag() string {
+	return fe.tag
+}
+
+func (fe *providerFieldError) ActualTag() string {
+	if len(fe.actualTag) == 0 {
+		return fe.tag
+	}
+	return fe.actualTag
+}
+
+func (fe *providerFieldError) Namespace() string {
+	return fe.ns
+}
+
+func (fe *providerFieldError) StructNamespace() string {
+	return fe.structNs
+}
+
+func (fe *providerFieldError) Field() string {
+	return fe.field
+}
+
+func (fe *providerFieldError) StructField() string {
+	return fe.structField
+}
+
+func (fe *providerFieldError) Value() interface{} {
+	return fe.value
+}
+
+func (fe *providerFieldError) Param() string {
+	return fe.param
+}
+
+func (fe *providerFieldError) Kind() reflect.Kind {
+	if fe.value == nil {
+		return reflect.Invalid
+	}
+	return reflect.TypeOf(fe.value).Kind()
+}
+
+func (fe *providerFieldError) Type() reflect.Type {
+	return reflect.TypeOf(fe.value)
+}
+
+// Path returns the dot path of the field named from struct tags, ex: account.anID
+func (fe *providerFieldError) Path() string {
+	return fe.path
+}
+
+// Pointer returns the RFC 6901 JSON pointer of the field named from struct tags, ex: /account/anID
+func (fe *providerFieldError) Pointer() string {
+	return fe.pointer
+}
+
+// Translate returns the end user message rendered in the validation locale, see MessageCatalog.
+// The error message is returned when the violation has not been rendered.
+func (fe *providerFieldError) Translate(_ ut.Translator) string {
+	if len(fe.message) == 0 {
+		return fe.Error()
+	}
+	return fe.message
+}
+
+// Error returns the violation message, formatted like go-playground ones
+func (fe *providerFieldError) Error() string {
+	return fmt.Sprintf("Key: '%s' Error:Field validation for '%s' failed on the '%s' tag", fe.ns, fe.field, fe.tag)
+}
+
+// ValidationErrors are the violations of a failed validation returned by the provider.
+// validator.ValidationErrors can not hold them: its Error method only supports go-playground field errors.
+// Failed validations never return validator.ValidationErrors, callers asserting it must assert ValidationErrors.
+type ValidationErrors []validator.FieldError
+
+// Error returns one violation per line, like go-playground does
+func (ve ValidationErrors) Error() string {
+	lines := make([]string, len(ve))
+	for i, fe := range ve {
+		lines[i] = fe.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fieldErrorsOf returns the field errors of a validation error, returned by the provider or by go-playground
+func fieldErrorsOf(err error) ([]validator.FieldError, bool) {
+	var provider ValidationErrors
+	if errors.As(err, &provider) {
+		return provider, true
+	}
+	var playground validator.ValidationErrors
+	if errors.As(err, &playground) {
+		return playground, true
+	}
+	return nil, false
+}
+
+// copyFieldError returns a providerFieldError holding the details of a field error
+func copyFieldError(fe validator.FieldError) *providerFieldError {
+	if pfe, ok := fe.(*providerFieldError); ok {
+		c := *pfe
+		return &c
+	}
+	return &providerFieldError{
+		tag:         fe.Tag(),
+		actualTag:   fe.ActualTag(),
+		ns:          fe.Namespace(),
+		structNs:    fe.StructNamespace(),
+		field:       fe.Field(),
+		structField: fe.StructField(),
+		value:       fe.Value(),
+		param:       fe.Param(),
+	}
+}
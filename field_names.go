@@ -0,0 +1,153 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+)
+
+// DefaultFieldNameTag is the struct tag field names are read from unless set otherwise
+const DefaultFieldNameTag = "json"
+
+// FieldNamer names struct fields from a struct tag (json, yaml, form or a custom one) like encoders do:
+// tag options are ignored, "-" marks a field without name and fields without tag keep their Go name.
+type FieldNamer struct {
+	tag string
+}
+
+// NewFieldNamer returns a FieldNamer reading names from the given struct tag
+func NewFieldNamer(tag string) *FieldNamer {
+	return &FieldNamer{tag: tag}
+}
+
+// Name returns the name of a struct field, false when the tag excludes the field with "-"
+func (n *FieldNamer) Name(f reflect.StructField) (string, bool) {
+	name, _, _ := strings.Cut(f.Tag.Get(n.tag), ",")
+	if name == "-" {
+		return "", false
+	}
+	if len(name) == 0 {
+		return f.Name, true
+	}
+	return name, true
+}
+
+// promoted reports whether the fields of an embedded struct are promoted to the parent, as encoders do
+// for embedded structs without tag name
+func (n *FieldNamer) promoted(f reflect.StructField) bool {
+	name, _, _ := strings.Cut(f.Tag.Get(n.tag), ",")
+	return f.Anonymous && len(name) == 0 && structType(f.Type) != nil
+}
+
+// Path returns the tag aware dot path and RFC 6901 JSON pointer of a go-playground struct namespace
+// rooted at the given type, ex: POCUser.Addresses[1].ZipCode -> addresses[1].zipCode and /addresses/1/zipCode.
+// Segments not matching a field of the type, like names reported by struct level validations, are kept as is.
+func (n *FieldNamer) Path(root reflect.Type, structNamespace string) (string, string) {
+	_, namespace, _ := strings.Cut(structNamespace, ".")
+	t := root
+	var dot strings.Builder
+	var pointer strings.Builder
+	for _, segment := range splitNamespace(namespace) {
+		for t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if segment.index {
+			dot.WriteString("[" + segment.name + "]")
+			pointer.WriteString("/" + escapeJSONPointer(segment.name))
+			if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map) {
+				t = t.Elem()
+			} else {
+				t = nil
+			}
+			continue
+		}
+
+		name := segment.name
+		var field reflect.StructField
+		found := false
+		if t != nil && t.Kind() == reflect.Struct {
+			field, found = t.FieldByName(segment.name)
+		}
+		if found {
+			t = field.Type
+			if n.promoted(field) {
+				continue
+			}
+			if tagName, ok := n.Name(field); ok {
+				name = tagName
+			}
+		} else {
+			t = nil
+		}
+		if dot.Len() > 0 {
+			dot.WriteString(".")
+		}
+		dot.WriteString(name)
+		pointer.WriteString("/" + escapeJSONPointer(name))
+	}
+	return dot.String(), pointer.String()
+}
+
+// namespaceSegment is a field name or an index ([1], [key]) of a go-playground namespace
+type namespaceSegment struct {
+	name  string
+	index bool
+}
+
+// splitNamespace splits a namespace like Addresses[1].ZipCode into Addresses, 1 and ZipCode
+func splitNamespace(namespace string) []namespaceSegment {
+	var segments []namespaceSegment
+	for len(namespace) > 0 {
+		switch namespace[0] {
+		case '.':
+			namespace = namespace[1:]
+		case '[':
+			end := strings.IndexByte(namespace, ']')
+			if end < 0 {
+				end = len(namespace)
+			}
+			segments = append(segments, namespaceSegment{name: namespace[1:end], index: true})
+			if end < len(namespace) {
+				end++
+			}
+			namespace = namespace[end:]
+		default:
+			end := strings.IndexAny(namespace, ".[")
+			if end < 0 {
+				end = len(namespace)
+			}
+			segments = append(segments, namespaceSegment{name: namespace[:end]})
+			namespace = namespace[end:]
+		}
+	}
+	return segments
+}
+
+// escapeJSONPointer escapes a JSON pointer reference token as required by RFC 6901
+func escapeJSONPointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+// JSONPointers returns the RFC 6901 JSON pointers of the violations of a validation error by namespace,
+// nil when it holds none
+func JSONPointers(err error) map[string]string {
+	fieldErrors, ok := fieldErrorsOf(err)
+	if !ok {
+		return nil
+	}
+	pointers := make(map[string]string, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		if pfe, ok := fe.(*providerFieldError); ok {
+			pointers[fe.Namespace()] = pfe.Pointer()
+		}
+	}
+	return pointers
+}
+
+// SetFieldNameTag sets the struct tag field names are read from, ex: json, yaml or form.
+// It names fields in the paths and pointers of errors and in struct level validations.
+func (vp *POCDefaultValidationProvider) SetFieldNameTag(tag string) {
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	vp.fieldNames = NewFieldNamer(tag)
+	vp.validationEntities = composeEntityFieldsMap(vp.fieldNames, vp.namedEntities()...)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type taggedItem struct {
+	Code  string `json:"code,omitempty" yaml:"item_code" form:"c"`
+	Notes string `json:"-"`
+	Slash string `json:"a/b~c"`
+}
+
+type taggedOrder struct {
+	BaseUser
+	Items  []taggedItem          `json:"items" yaml:"order_items"`
+	ByKey  map[string]taggedItem `json:"byKey"`
+	Secret string                `json:"-"`
+}
+
+func TestFieldNamerPath(t *testing.T) {
+	namer := NewFieldNamer(DefaultFieldNameTag)
+	user := reflect.TypeOf(POCUser{})
+	order := reflect.TypeOf(taggedOrder{})
+
+	for namespace, want := range map[string][2]string{
+		"POCUser.LastName":                 {"LastName", "/LastName"},
+		"POCUser.BaseUser.LastName":        {"LastName", "/LastName"},
+		"POCUser.Age":                      {"myAge", "/myAge"},
+		"POCUser.Account.ID":               {"account.anID", "/account/anID"},
+		"POCUser.Addresses[1].ZipCode":     {"Addresses[1].ZipCode", "/Addresses/1/ZipCode"},
+		"POCUser.zipcode":                  {"zipcode", "/zipcode"},
+		"POCUser.ApplicationDate":          {"applicationDate", "/applicationDate"},
+		"taggedOrder.Items[0].Code":        {"items[0].code", "/items/0/code"},
+		"taggedOrder.ByKey[a/b].Slash":     {"byKey[a/b].a/b~c", "/byKey/a~1b/a~1b~0c"},
+		"taggedOrder.Items[2].Notes":       {"items[2].Notes", "/items/2/Notes"},
+		"taggedOrder.TmpW.tmpB.Unknown[3]": {"TmpW.tmpB.Unknown[3]", "/TmpW/tmpB/Unknown/3"},
+	} {
+		root := user
+		if namespace[0] == 't' {
+			root = order
+		}
+		dot, pointer := namer.Path(root, namespace)
+		assert.Equal(t, want[0], dot, namespace)
+		assert.Equal(t, want[1], pointer, namespace)
+	}
+
+	dot, pointer := NewFieldNamer("yaml").Path(order, "taggedOrder.Items[0].Code")
+	assert.Equal(t, "order_items[0].item_code", dot)
+	assert.Equal(t, "/order_items/0/item_code", pointer)
+	dot, _ = NewFieldNamer("form").Path(order, "taggedOrder.Items[0].Code")
+	assert.Equal(t, "Items[0].c", dot)
+}
+
+func TestComposeEntityFieldsMap(t *testing.T) {
+	entities := ComposeEntityFieldsMap(POCUser{}, taggedOrder{})
+	pkg := reflect.TypeOf(POCUser{}).PkgPath()
+	assert.Equal(t, "myAge", entities[pkg+".POCUser"]["Age"])
+	assert.Equal(t, "LastName", entities[pkg+".POCUser"]["LastName"])
+	assert.Equal(t, "anID", entities[pkg+".Account"]["ID"])
+	assert.Equal(t, "ZipCode", entities[pkg+".Address"]["ZipCode"])
+	assert.Equal(t, "code", entities[pkg+".taggedItem"]["Code"])
+	assert.Equal(t, "Secret", entities[pkg+".taggedOrder"]["Secret"])
+	assert.NotContains(t, entities[pkg+".POCUser"], "BaseUser")
+	assert.Nil(t, ComposeEntityFieldsMap("not a struct"))
+}
+
+func TestErrorPaths(t *testing.T) {
+	vp := newTestProvider()
+	user := provideValidUser()
+	user.FirstName = "Pam"
+	user.Age = 17
+
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+	err := vp.ValidateUserWithRulesValidation(ctx, user)
+	assert.Equal(t, map[string]string{"POCUser.FirstName": "/FIRSTNAME", "POCUser.Age": "/myAge"}, JSONPointers(err))
+	assert.Contains(t, err.Error(), "Key: 'POCUser.Age' Error:Field validation for 'Age' failed on the 'min' tag")
+	violations := vp.RedactionPolicy().Violations(err)
+	assert.Len(t, violations, 2)
+	for _, v := range violations {
+		assert.Contains(t, []string{"FIRSTNAME", "myAge"}, v.Path)
+	}
+
+	vp.SetFieldNameTag("yaml")
+	assert.Equal(t, map[string]string{"POCUser.FirstName": "/FirstName", "POCUser.Age": "/Age"},
+		JSONPointers(vp.ValidateUserWithRulesValidation(ctx, user)))
+	assert.Nil(t, JSONPointers(vp.ValidateUserWithRulesValidation(ctx, provideValidUser())))
+}
+
+func TestFieldNameTagSetWhileValidating(t *testing.T) {
+	vp := newTestProvider()
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			vp.SetFieldNameTag([]string{"json", "yaml", "form"}[i%3])
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			assert.NoError(t, vp.ValidateUserWithStructValidation(ctx, provideValidUser()))
+		}
+	}()
+	wg.Wait()
+}
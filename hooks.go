@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// ValidationInfo identifies a validation passed to hooks
+type ValidationInfo struct {
+	Tenant   string // ID of the tenant
+	Entity   string
+	EntityID string // "entityID" context value, empty when not set
+}
+
+// RuleEvent describes a rule run while validating. Rules are the custom validations, struct level functions
+// and asynchronous validators, built-in go-playground tags are not reported one by one.
+type RuleEvent struct {
+	Rule     string
+	Field    string // struct namespace of the field validated by the rule, ex: POCUser.Email, empty for struct level functions
+	Elapsed  time.Duration
+	Valid    bool // false when a field rule failed, struct level functions report their own violations
+	Panicked bool
+}
+
+// Hooks are called around validations to plug tracing, logging, metrics or side effects without forking
+// the provider. Hooks must be safe for concurrent use, rules may run concurrently.
+// Embed NoopHooks to implement only some of them.
+type Hooks interface {
+	// BeforeValidate is called before validating, the returned context is used for the validation, ex: to start a span
+	BeforeValidate(ctx context.Context, info ValidationInfo) context.Context
+	// AfterRule is called once a rule ran
+	AfterRule(ctx context.Context, info ValidationInfo, event RuleEvent)
+	// OnViolation is called for every violation of a failed validation, values are redacted
+	OnViolation(ctx context.Context, info ValidationInfo, violation Violation)
+	// AfterValidate is called once validation ends with its error, nil when the entity is valid
+	AfterValidate(ctx context.Context, info ValidationInfo, err error, elapsed time.Duration)
+}
+
+// NoopHooks implements Hooks doing nothing
+type NoopHooks struct{}
+
+// BeforeValidate returns the context as is
+func (NoopHooks) BeforeValidate(ctx context.Context, _ ValidationInfo) context.Context { return ctx }
+
+// AfterRule does nothing
+func (NoopHooks) AfterRule(context.Context, ValidationInfo, RuleEvent) {}
+
+// OnViolation does nothing
+func (NoopHooks) OnViolation(context.Context, ValidationInfo, Violation) {}
+
+// AfterValidate does nothing
+func (NoopHooks) AfterValidate(context.Context, ValidationInfo, error, time.Duration) {}
+
+// hookChain calls hooks in the order they were added, AfterValidate in reverse order like deferred calls
+type hookChain []Hooks
+
+func (c hookChain) BeforeValidate(ctx context.Context, info ValidationInfo) context.Context {
+	for _, h := range c {
+		ctx = h.BeforeValidate(ctx, info)
+	}
+	return ctx
+}
+
+func (c hookChain) AfterRule(ctx context.Context, info ValidationInfo, event RuleEvent) {
+	for _, h := range c {
+		h.AfterRule(ctx, info, event)
+	}
+}
+
+func (c hookChain) OnViolation(ctx context.Context, info ValidationInfo, violation Violation) {
+	for _, h := range c {
+		h.OnViolation(ctx, info, violation)
+	}
+}
+
+func (c hookChain) AfterValidate(ctx context.Context, info ValidationInfo, err error, elapsed time.Duration) {
+	for i := len(c) - 1; i >= 0; i-- {
+		c[i].AfterValidate(ctx, info, err, elapsed)
+	}
+}
+
+// AddHooks adds hooks called around every validation.
+// Hooks must be added at startup, before the first validation. Validations cost nothing more without hooks.
+func (vp *POCDefaultValidationProvider) AddHooks(hooks Hooks) {
+	vp.hooks = append(vp.hooks, hooks)
+}
+
+// validationInfo returns the info of a validation passed to hooks
+func (vp *POCDefaultValidationProvider) validationInfo(ctx context.Context, tenantID int, entity string) ValidationInfo {
+	entityID, _ := ctx.Value("entityID").(string)
+	return ValidationInfo{Tenant: vp.tenantIDOf(tenantID), Entity: entity, EntityID: entityID}
+}
+
+// afterValidate is deferred by the validation entry points when hooks are set,
+// once the error is final: violations are reported and then the end of the validation
+func (vp *POCDefaultValidationProvider) afterValidate(ctx context.Context, info ValidationInfo, start time.Time, err *error) {
+	for _, v := range vp.RedactionPolicy().Violations(*err) {
+		vp.hooks.OnViolation(ctx, info, v)
+	}
+	vp.hooks.AfterValidate(ctx, info, *err, time.Since(start))
+}
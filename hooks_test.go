@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type spanKey struct{}
+
+// recordingHooks records the calls of every hook
+type recordingHooks struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (h *recordingHooks) record(call string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls = append(h.calls, call)
+}
+
+func (h *recordingHooks) BeforeValidate(ctx context.Context, info ValidationInfo) context.Context {
+	h.record(fmt.Sprintf("before %s %s %s", info.Tenant, info.Entity, info.EntityID))
+	return context.WithValue(ctx, spanKey{}, "span")
+}
+
+func (h *recordingHooks) AfterRule(ctx context.Context, info ValidationInfo, event RuleEvent) {
+	h.record(fmt.Sprintf("rule %s %s %t %v", event.Rule, event.Field, event.Valid, ctx.Value(spanKey{})))
+}
+
+func (h *recordingHooks) OnViolation(ctx context.Context, info ValidationInfo, violation Violation) {
+	h.record(fmt.Sprintf("violation %s %s %v", violation.Namespace, violation.Rule, violation.Value))
+}
+
+func (h *recordingHooks) AfterValidate(ctx context.Context, info ValidationInfo, err error, elapsed time.Duration) {
+	h.record(fmt.Sprintf("after %t %v", err != nil, ctx.Value(spanKey{})))
+}
+
+// countingHooks only counts validations
+type countingHooks struct {
+	NoopHooks
+	validations int
+}
+
+func (h *countingHooks) AfterValidate(context.Context, ValidationInfo, error, time.Duration) {
+	h.validations++
+}
+
+func TestHooks(t *testing.T) {
+	vp := newTestProvider()
+	hooks := &recordingHooks{}
+	counting := &countingHooks{}
+	vp.AddHooks(hooks)
+	vp.AddHooks(counting)
+	user := provideValidUser()
+	user.FirstName = "Pam"
+	user.Email = "pam@mail"
+
+	ctx := context.WithValue(context.WithValue(context.Background(), "tenant", 1), "entityID", "app-1")
+	assert.Error(t, vp.ValidateUserWithRulesValidation(ctx, user))
+	assert.Equal(t, []string{
+		"before 1 POCUser app-1",
+		"rule startswiths POCUser.FirstName false span",
+		"rule expr  true span",
+		"violation POCUser.FirstName startswiths Pam",
+		"violation POCUser.Email email " + vp.redaction.Redact("Email", "pam@mail").(string),
+		"after true span",
+	}, hooks.calls)
+
+	hooks.calls = nil
+	user.Email = "pam@mail.com"
+	assert.Error(t, vp.ValidateUserWithStructValidation(ctx, user))
+	assert.Equal(t, []string{
+		"before 1 POCUser app-1",
+		"rule DefaultUserValidation  true span",
+		"rule isprovincename  true span", // run by the tenant validator through sl.Validator().Var
+		"rule TenantAUserValidator.UserValidation  true span",
+		"rule expr  true span",
+		"violation POCUser.first name namestartswiths Pam",
+		"after true span",
+	}, hooks.calls)
+	assert.Equal(t, 2, counting.validations)
+}
+
+func TestNoHooks(t *testing.T) {
+	vp := newTestProvider()
+	guard := vp.newPanicGuard(1, POCUser{}).withHooks(context.Background(), vp.hooks, ValidationInfo{})
+	assert.Nil(t, guard.hooks)
+}
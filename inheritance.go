@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SetParent changes the parent of a tenant, an empty parent detaches it.
+// Tenants inherit the rules and struct level validators of their ancestors, cycles are rejected.
+func (r *TenantRegistry) SetParent(id, parent string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tenants[id]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownTenant, id)
+	}
+	if len(parent) > 0 {
+		p, ok := r.tenants[parent]
+		if !ok {
+			return fmt.Errorf("tenant %s: unknown parent %s", t.ID, parent)
+		}
+		for a := p; a != nil; a = r.tenants[a.Parent] {
+			if a == t {
+				return fmt.Errorf("tenant %s: parent %s would create a cycle", t.ID, p.ID)
+			}
+			if len(a.Parent) == 0 {
+				break
+			}
+		}
+		parent = p.ID
+	}
+	t.Parent = parent
+	return nil
+}
+
+// ancestors returns the keys of the ancestors of a tenant and its own, root first
+func (r *TenantRegistry) ancestors(key int) []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.byKey[key]
+	if !ok {
+		return []int{key}
+	}
+	chain := []int{t.key}
+	// parents are registered first and SetParent rejects cycles, the bound only guards against bugs
+	for len(t.Parent) > 0 && len(chain) <= len(r.byKey) {
+		t = r.tenants[t.Parent]
+		chain = append([]int{t.key}, chain...)
+	}
+	return chain
+}
+
+// tenantChain returns the keys of a tenant and of the ancestors it inherits from, root first
+func (vp *POCDefaultValidationProvider) tenantChain(tenantID int) []int {
+	if vp.tenants == nil || tenantID == globalScope {
+		return []int{tenantID}
+	}
+	return vp.tenants.ancestors(tenantID)
+}
+
+// tenantLabel names a tenant in rule origins, by ID when registered
+func (vp *POCDefaultValidationProvider) tenantLabel(tenantID int) string {
+	if vp.tenants != nil {
+		if t, ok := vp.tenants.byKeyOf(tenantID); ok {
+			return t.ID
+		}
+	}
+	return "tenant " + strconv.Itoa(tenantID)
+}
+
+// ruleLayer is a rule map of the effective rules of a tenant with where it comes from
+type ruleLayer struct {
+	source  string
+	rules   map[string]string
+	scope   int  // tenant the rules belong to, globalScope for default and environment rules
+	replace bool // rules replace the ones of their field instead of being added to them
+}
+
+// layerRule is a rule of a field with the layer it comes from
+type layerRule struct {
+	rule  string
+	layer *ruleLayer
+}
+
+// composeLayers applies layers in order and returns the rules of every field with the layer each comes from.
+// The rules of a tenant are added to the default rules of their field and replace the ones of its ancestors,
+// replace layers replace every rule of their field and an empty rule removes them.
+func composeLayers(layers []ruleLayer) map[string][]layerRule {
+	rules := make(map[string][]layerRule)
+	for i := range layers {
+		layer := &layers[i]
+		for field, rule := range layer.rules {
+			switch {
+			case layer.replace:
+				delete(rules, field)
+			case layer.scope != globalScope:
+				// layers are ordered root first, the other tenants having rules on the field are ancestors
+				kept := make([]layerRule, 0, len(rules[field]))
+				for _, r := range rules[field] {
+					if r.layer.scope == globalScope || r.layer.scope == layer.scope {
+						kept = append(kept, r)
+					}
+				}
+				rules[field] = kept
+			}
+			if len(rule) > 0 {
+				rules[field] = append(rules[field], layerRule{rule: rule, layer: layer})
+			} else if len(rules[field]) == 0 {
+				delete(rules, field)
+			}
+		}
+	}
+	return rules
+}
+
+// decorateLayers returns the rules of layers applied in order, see composeLayers
+func decorateLayers(layers []ruleLayer) map[string]string {
+	rules := make(map[string]string)
+	for field, fieldRules := range composeLayers(layers) {
+		for _, r := range fieldRules {
+			appendRule(field, r.rule, rules)
+		}
+	}
+	return rules
+}
+
+// userRuleLayers returns the layers of the user rules of a tenant at the given time, in the order they apply:
+// default rules, then for every tenant of the chain, root first, its validator rules, tenant rules and dated rules
+// in force, then the environment overlays. The rules and dated rules of own stand for the ones of the tenant itself,
+// its ancestors apply their active rules. The rules of a tenant replace the ones of its ancestors on their fields.
+func (vp *POCDefaultValidationProvider) userRuleLayers(tenantID int, own ruleSet, asOf time.Time) []ruleLayer {
+	chain := vp.tenantChain(tenantID)
+	layers := []ruleLayer{{source: "default", rules: ComposeDefaultUserRules()}}
+	registration, registrations := vp.registeredUserLayers(chain)
+	if registrations != nil {
+		layers = append(layers, registration)
+	}
+	for _, key := range chain {
+		label := vp.tenantLabel(key)
+		if v, ok := vp.tenantValidator(key); ok {
+			layers = append(layers, ruleLayer{source: label + " validator", rules: v.UserValidationRules(), scope: key})
+		}
+		layers = append(layers, registrations[key]...)
+		rules, version := vp.tenantRulesOf(key)
+		dated := vp.datedRulesInForce(key, asOf)
+		if key == tenantID {
+			rules, dated = own.rules, datedRulesInForce(own.dated, asOf)
+		}
+		if len(rules) > 0 {
+			layers = append(layers, ruleLayer{source: fmt.Sprintf("%s rules v%d", label, version), rules: rules, scope: key})
+		}
+		for _, d := range dated {
+			source := label + " dated rules"
+			if !d.EffectiveFrom.IsZero() {
+				source += " from " + d.EffectiveFrom.Format(time.RFC3339)
+			}
+			layers = append(layers, ruleLayer{source: source, rules: d.Rules, scope: key, replace: true})
+		}
+	}
+	return append(layers, vp.overlayLayers(chain)...)
+}
+
+// RuleOrigin is a rule of the effective rules of a tenant with where it comes from
+type RuleOrigin struct {
+	Field  string `json:"field"`
+	Rule   string `json:"rule"`
+	Source string `json:"source"` // ex: default, nesto validator, ig rules v3
+}
+
+// UserRuleOrigins returns where each effective user rule of a tenant comes from, sorted by field
+// in the order the rules apply
+func (vp *POCDefaultValidationProvider) UserRuleOrigins(tenant string) ([]RuleOrigin, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return originsOf(vp.userRuleLayers(tenantID, vp.activeRuleSet(tenantID), vp.now())), nil
+}
+
+// originsOf returns where each rule composed from layers comes from, sorted by field in the order the rules apply
+func originsOf(layers []ruleLayer) []RuleOrigin {
+	rules := composeLayers(layers)
+	fields := make([]string, 0, len(rules))
+	for field := range rules {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	var origins []RuleOrigin
+	for _, field := range fields {
+		for _, r := range rules[field] {
+			origins = append(origins, RuleOrigin{Field: field, Rule: r.rule, Source: r.layer.source})
+		}
+	}
+	return origins
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+// seniorUserValidator is the validator of a sub-brand only accepting users up to 65 with a .ca email
+type seniorUserValidator struct{}
+
+func (seniorUserValidator) UserValidationRules() map[string]string {
+	return map[string]string{"Email": "endswith=.ca"}
+}
+
+func (seniorUserValidator) UserValidation(sl validator.StructLevel) {
+	if user := sl.Current().Interface().(POCUser); user.Age > 65 {
+		sl.ReportError(user.Age, "age", "Age", "max", "65")
+	}
+}
+
+// newTestTenantChain registers nesto, ig, the sub-brand prime of nesto and the sub-brand of prime for Quebec
+func newTestTenantChain(t *testing.T) *POCDefaultValidationProvider {
+	vp := newTestProvider()
+	tenants := NewTenantRegistry()
+	assert.NoError(t, tenants.Register(Tenant{ID: "nesto", Enabled: true}))
+	assert.NoError(t, tenants.Register(Tenant{ID: "ig", Enabled: true}))
+	assert.NoError(t, tenants.Register(Tenant{ID: "prime", Parent: "nesto", Enabled: true}))
+	assert.NoError(t, tenants.Register(Tenant{ID: "prime-qc", Parent: "prime", Enabled: true}))
+	vp.SetTenantRegistry(tenants)
+	assert.NoError(t, vp.SetTenantValidator("prime", seniorUserValidator{}))
+	assert.NoError(t, vp.SetTenantRules("prime-qc", map[string]string{"Age": "max=60"}))
+	return vp
+}
+
+// effectiveRules returns the effective user rules of a tenant
+func effectiveRules(t *testing.T, vp *POCDefaultValidationProvider, tenant string) map[string]string {
+	rules, err := vp.EffectiveUserRules(tenant)
+	assert.NoError(t, err)
+	return rules
+}
+
+// ruleOrigins returns the origins of the effective user rules of a tenant
+func ruleOrigins(t *testing.T, vp *POCDefaultValidationProvider, tenant string) []RuleOrigin {
+	origins, err := vp.UserRuleOrigins(tenant)
+	assert.NoError(t, err)
+	return origins
+}
+
+func TestTenantInheritance(t *testing.T) {
+	vp := newTestTenantChain(t)
+	assert.Equal(t, []int{1, 3, 4}, vp.tenantChain(4))
+	assert.Equal(t, []int{9}, vp.tenantChain(9))
+	assert.Equal(t, map[string]string{
+		"FirstName": "max=10,startswiths",
+		"Age":       "min=18,max=60",
+		"Email":     "required,email,endswith=.ca",
+		"Phone":     "e164",
+	}, effectiveRules(t, vp, "prime-qc"))
+
+	// rules and custom validations of the ancestors apply, overrides of the tenant after them
+	user := provideValidUser()
+	user.FirstName, user.Age = "Pam", 62
+	ctx := context.WithValue(context.Background(), "tenant", "prime-qc")
+	assert.Equal(t, []string{"FirstName:startswiths", "Age:max", "Email:endswith"},
+		fieldFailures(vp.ValidateUserWithRulesValidation(ctx, user)))
+	assert.Equal(t, []string{"FirstName:startswiths"},
+		fieldFailures(vp.ValidateUserWithRulesValidation(context.WithValue(context.Background(), "tenant", "nesto"), user)))
+
+	// struct level validators of the ancestors run root first
+	user.Age = 70
+	assert.Equal(t, []string{"first name:namestartswiths", "age:max"},
+		fieldFailures(vp.ValidateUserWithStructValidation(ctx, user)))
+	prime, err := vp.RuleSetVersion("prime")
+	assert.NoError(t, err)
+	primeQC, err := vp.RuleSetVersion("prime-qc")
+	assert.NoError(t, err)
+	assert.NotEqual(t, prime, primeQC)
+}
+
+func TestTenantParentCycles(t *testing.T) {
+	vp := newTestTenantChain(t)
+	tenants := vp.TenantRegistry()
+	assert.Error(t, tenants.SetParent("nesto", "prime-qc"))
+	assert.Error(t, tenants.SetParent("prime", "prime"))
+	assert.Error(t, tenants.SetParent("prime", "unknown"))
+	assert.ErrorIs(t, tenants.SetParent("unknown", "nesto"), ErrUnknownTenant)
+	assert.Equal(t, []int{1, 3, 4}, vp.tenantChain(4))
+
+	assert.NoError(t, tenants.SetParent("prime-qc", "nesto"))
+	assert.Equal(t, []int{1, 4}, vp.tenantChain(4))
+	assert.NoError(t, tenants.SetParent("prime", ""))
+	assert.NoError(t, tenants.SetParent("nesto", "prime"))
+	assert.Equal(t, []int{3, 1, 4}, vp.tenantChain(4))
+}
+
+func TestUserRuleOrigins(t *testing.T) {
+	vp := newTestTenantChain(t)
+	assert.Equal(t, []RuleOrigin{
+		{Field: "Age", Rule: "min=18", Source: "default"},
+		{Field: "Age", Rule: "max=60", Source: "prime-qc rules v1"},
+		{Field: "Email", Rule: "required,email", Source: "default"},
+		{Field: "Email", Rule: "endswith=.ca", Source: "prime validator"},
+		{Field: "FirstName", Rule: "max=10", Source: "default"},
+		{Field: "FirstName", Rule: "startswiths", Source: "nesto validator"},
+		{Field: "Phone", Rule: "e164", Source: "nesto validator"},
+	}, ruleOrigins(t, vp, "prime-qc"))
+
+	h := NewAdminHandler(vp, "secret")
+	w := adminRequest(t, h, "GET", "/tenants/prime/rules/POCUser/origins", "", "")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `{"field":"Email","rule":"endswith=.ca","source":"prime validator"}`)
+}
+
+func TestInheritedRulesReplacedByDescendants(t *testing.T) {
+	vp := newTestTenantChain(t)
+	vp.SetTenantRules("nesto", map[string]string{"Addresses": "max=1"})
+	vp.SetTenantRules("prime", map[string]string{"Addresses": "max=2"})
+	assert.Equal(t, "max=2", effectiveRules(t, vp, "prime-qc")["Addresses"])
+	assert.Contains(t, ruleOrigins(t, vp, "prime-qc"), RuleOrigin{Field: "Addresses", Rule: "max=2", Source: "prime rules v1"})
+	assert.NotContains(t, ruleOrigins(t, vp, "prime-qc"), RuleOrigin{Field: "Addresses", Rule: "max=1", Source: "nesto rules v1"})
+
+	user := provideValidUser()
+	user.Email = "sam@mail.ca"
+	user.Addresses = []*Address{{ZipCode: "H0H", Province: "QC"}, {ZipCode: "H0H", Province: "QC"}}
+	prime := context.WithValue(context.Background(), "tenant", "prime-qc")
+	nesto := context.WithValue(context.Background(), "tenant", "nesto")
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(prime, user))
+	assert.Equal(t, []string{"Addresses:max"}, fieldFailures(vp.ValidateUserWithRulesValidation(nesto, user)))
+
+	// expression rules and asynchronous validators are inherited, a descendant replaces the ones of the same tag
+	_, err := vp.UpdateTenantExpressionRules("nesto", 1, "ops", []ExpressionRule{{Field: "Age", Tag: "adult", Expression: `Age >= 21`}})
+	assert.NoError(t, err)
+	user.Age = 20
+	assert.Equal(t, []string{"Age:adult"}, fieldFailures(vp.ValidateUserWithRulesValidation(prime, user)))
+	_, err = vp.UpdateTenantExpressionRules("prime", 1, "ops", []ExpressionRule{{Field: "Age", Tag: "adult", Expression: `Age >= 19`}})
+	assert.NoError(t, err)
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(prime, user))
+
+	rejectAll := NewAsyncValidator("blocked", "Email", nil, func(context.Context, any) (bool, error) { return false, nil })
+	acceptAll := NewAsyncValidator("blocked", "Email", nil, func(context.Context, any) (bool, error) { return true, nil })
+	vp.AddTenantAsyncValidator("nesto", rejectAll, 0)
+	assert.Equal(t, []string{"Email:blocked"}, fieldFailures(vp.ValidateUserWithRulesValidation(prime, user)))
+	vp.AddTenantAsyncValidator("prime-qc", acceptAll, 0)
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(prime, user))
+
+	assert.NoError(t, Register[Address](vp, EntityRules{Rules: map[string]string{"ZipCode": "required"}},
+		map[string]EntityRules{"nesto": {Rules: map[string]string{"Province": "len=2"}}}))
+	assert.NoError(t, vp.SetTenantEntityRules("prime", Address{}, EntityRules{Rules: map[string]string{"Province": "len=3"}}))
+	rules, err := vp.EffectiveEntityRules("prime-qc", Address{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"ZipCode": "required", "Province": "len=3"}, rules)
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
+	"time"
 )
 
 // POCUser contains POC user information
@@ -24,6 +26,8 @@ type POCUser struct {
 	Phone     string
 	Addresses []*Address
 	Account   *Account `json:"account"`
+	// ApplicationDate is when the user started the application, rules in force at that date apply
+	ApplicationDate time.Time `json:"applicationDate"`
 }
 
 type BaseUser struct {
@@ -43,13 +47,20 @@ type Account struct {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	vp := NewPOCDefaultValidationProvider()
-	tav := NewTenantAUserValidator()
-	tbv := NewTenantBUserValidator()
-
-	vp.SetTenantValidator(1, tav) // tenant 1
-	vp.SetTenantValidator(2, tbv) // tenant 2
+	// the demo validates sample users, it does not need the redaction key of production
+	vp, err := newTenantProvider(Development)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	pocUser := POCUser{
 		BaseUser: BaseUser{
@@ -75,11 +86,8 @@ func main() {
 		},
 	}
 
-	// test entity map composition
-	vp.validationEntities = ComposeEntityFieldsMap(POCUser{})
-
-	ctx := context.WithValue(context.Background(), "tenant", 1) // 1 - nesto | 2 - ig
-	err := vp.ValidateUserWithStructValidation(ctx, pocUser)
+	ctx := context.WithValue(context.Background(), "tenant", "nesto")
+	err = vp.ValidateUserWithStructValidation(ctx, pocUser)
 	if err != nil {
 		fmt.Println("[ValidateUserWithStructValidation] Validation Provider failed...")
 		fmt.Println(err)
@@ -91,3 +99,67 @@ func main() {
 		fmt.Println(err)
 	}
 }
+
+// newTenantProvider returns a provider set up with the validators and custom validations of every tenant.
+// env is the environment of the provider when VALIDATION_ENVIRONMENT is not set.
+func newTenantProvider(env Environment) (*POCDefaultValidationProvider, error) {
+	vp := NewPOCDefaultValidationProvider()
+	tav := NewTenantAUserValidator()
+	tbv := NewTenantBUserValidator()
+
+	tenants := NewTenantRegistry()
+	for _, t := range []Tenant{
+		{ID: "nesto", DisplayName: "nesto", DefaultLocale: "en-CA", Country: "CA", Enabled: true},
+		{ID: "ig", Aliases: []string{"ig-wealth"}, DisplayName: "IG Wealth Management", DefaultLocale: "en-CA", Country: "CA", Enabled: true},
+		// sub-brands inherit the rules and validators of their parent
+		{ID: "ig-mortgages", DisplayName: "IG Mortgages", Parent: "ig", DefaultLocale: "en-CA", Country: "CA", Enabled: true},
+	} {
+		if err := tenants.Register(t); err != nil {
+			return nil, err
+		}
+	}
+	vp.SetTenantRegistry(tenants)
+
+	if err := vp.SetTenantValidator("nesto", tav); err != nil {
+		return nil, err
+	}
+	if err := vp.SetTenantValidator("ig", tbv); err != nil {
+		return nil, err
+	}
+	// an application is validated against the rules in force when it was started
+	// applications older than 90 days are validated against the rules in force 90 days ago
+	vp.SetAsOfFunc(AsOfField("ApplicationDate"), 90*24*time.Hour)
+
+	// custom validations are declared once at startup, scoped to the tenant using them
+	if err := registerCustomValidations(vp); err != nil {
+		return nil, err
+	}
+	// violations of rules disabled at runtime are kept out of results but logged
+	vp.SetDisabledRuleHook(func(_ context.Context, hit DisabledRuleHit) {
+		fmt.Fprintf(os.Stderr, "disabled rule %s.%s %s failed for tenant %s on %s\n",
+			hit.Rule.Entity, hit.Rule.Field, hit.Rule.Tag, hit.Tenant, hit.Violation.Namespace)
+	})
+	// QA and staging may loosen rules with overlays, ex: VALIDATION_ENVIRONMENT=qa VALIDATION_OVERLAYS=test-phones
+	cfg := ProviderConfigFromEnv()
+	if len(cfg.Environment) == 0 {
+		cfg.Environment = env
+	}
+	if err := vp.ApplyConfig(cfg, EnvironmentOverlays()...); err != nil {
+		return nil, err
+	}
+	if err := vp.SetTenantDisplayName("ig", "en-CA", "FirstName", "Given name"); err != nil {
+		return nil, err
+	}
+	return vp, nil
+}
+
+// registerCustomValidations declares the custom validation tags used by each tenant
+func registerCustomValidations(vp *POCDefaultValidationProvider) error {
+	if err := vp.RegisterTenantValidation("nesto", "startswiths", ValidateFieldStartsWithS); err != nil {
+		return err
+	}
+	if err := vp.RegisterTenantValidation("nesto", "isprovincename", isProvinceName); err != nil {
+		return err
+	}
+	return vp.RegisterTenantValidation("ig", "isprovincecode", isProvinceCode)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en_CA"
+	"github.com/go-playground/locales/fr_CA"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	fr_translations "github.com/go-playground/validator/v10/translations/fr"
+)
+
+const (
+	// DefaultLocale is the locale of the messages when the context does not tell
+	DefaultLocale = "en_CA"
+	// fallbackMessageKey is the translation key used for tags without a message
+	fallbackMessageKey = "invalid"
+	// fieldPlaceholder stands for the field in the messages rendered by catalog translators,
+	// replaced by its display name once rendered
+	fieldPlaceholder = "\x00field\x00"
+)
+
+// customMessages are the messages of the custom tags, by locale. {0} is the field, {1} the tag parameter.
+var customMessages = map[string]map[string]string{
+	"en_CA": {
+		"startswiths":            "{0} must start with S",
+		"namestartswiths":        "{0} must start with S",
+		"isprovincename":         "{0} must be a Canadian province name",
+		"isprovincecode":         "{0} must be a Canadian province code",
+		"canadian_postal_code":   "{0} must be a valid Canadian postal code",
+		"phone":                  "{0} must be a valid phone number",
+		"agenotinbetween20and40": "{0} must be between 20 and 40",
+		"expr":                   "{0} does not satisfy {1}",
+		"decode":                 "{0} has an invalid format",
+		InternalErrorTag:         "{0} could not be validated, please try again later",
+		fallbackMessageKey:       "{0} is invalid",
+	},
+	"fr_CA": {
+		"startswiths":            "{0} doit commencer par S",
+		"namestartswiths":        "{0} doit commencer par S",
+		"isprovincename":         "{0} doit être un nom de province canadienne",
+		"isprovincecode":         "{0} doit être un code de province canadienne",
+		"canadian_postal_code":   "{0} doit être un code postal canadien valide",
+		"phone":                  "{0} doit être un numéro de téléphone valide",
+		"agenotinbetween20and40": "{0} doit être entre 20 et 40",
+		"expr":                   "{0} ne respecte pas {1}",
+		"decode":                 "{0} a un format invalide",
+		InternalErrorTag:         "{0} n'a pas pu être validé, veuillez réessayer plus tard",
+		fallbackMessageKey:       "{0} n'est pas valide",
+	},
+}
+
+// catalogTranslator is a translator of the message catalog, one per locale shared by all renderings.
+// go-playground translations are registered on every validator, which adds the same keys again:
+// those conflicts are ignored since the catalog already holds them, so translators are never written to after creation.
+type catalogTranslator struct {
+	ut.Translator
+}
+
+// T renders a translation with fieldPlaceholder in place of the field,
+// go-playground translations always pass the field as first parameter
+func (t *catalogTranslator) T(key interface{}, params ...string) (string, error) {
+	if len(params) > 0 {
+		params = append([]string{fieldPlaceholder}, params[1:]...)
+	}
+	return t.Translator.T(key, params...)
+}
+
+func (t *catalogTranslator) Add(key interface{}, text string, override bool) error {
+	return ignoreConflict(t.Translator.Add(key, text, override))
+}
+
+func (t *catalogTranslator) AddCardinal(key interface{}, text string, rule locales.PluralRule, override bool) error {
+	return ignoreConflict(t.Translator.AddCardinal(key, text, rule, override))
+}
+
+func (t *catalogTranslator) AddOrdinal(key interface{}, text string, rule locales.PluralRule, override bool) error {
+	return ignoreConflict(t.Translator.AddOrdinal(key, text, rule, override))
+}
+
+func (t *catalogTranslator) AddRange(key interface{}, text string, rule locales.PluralRule, override bool) error {
+	return ignoreConflict(t.Translator.AddRange(key, text, rule, override))
+}
+
+func ignoreConflict(err error) error {
+	var conflict *ut.ErrConflictingTranslation
+	if errors.As(err, &conflict) {
+		return nil
+	}
+	return err
+}
+
+// MessageCatalog renders violations as end user messages in en_CA and fr_CA, using go-playground
+// translations for built-in tags and the catalog ones for custom tags.
+// Tenants can override the message of any tag.
+type MessageCatalog struct {
+	mu           sync.RWMutex // guards tenant templates and display names
+	translators  map[string]*catalogTranslator
+	tenants      map[int]map[string]map[string]string // tenant -> locale -> tag -> template
+	displayNames map[string]map[string]string         // locale -> field -> display name
+	tenantNames  map[int]map[string]map[string]string // tenant -> locale -> field -> display name
+}
+
+// NewMessageCatalog returns a catalog holding the en_CA and fr_CA messages
+func NewMessageCatalog() (*MessageCatalog, error) {
+	c := &MessageCatalog{
+		translators:  make(map[string]*catalogTranslator),
+		tenants:      make(map[int]map[string]map[string]string),
+		displayNames: make(map[string]map[string]string),
+		tenantNames:  make(map[int]map[string]map[string]string),
+	}
+	for locale, names := range defaultDisplayNames {
+		c.displayNames[locale] = make(map[string]string, len(names))
+		for field, name := range names {
+			c.displayNames[locale][field] = name
+		}
+	}
+	uni := ut.New(en_CA.New(), fr_CA.New())
+	for locale, messages := range customMessages {
+		trans, _ := uni.GetTranslator(locale)
+		t := &catalogTranslator{Translator: trans}
+		for tag, message := range messages {
+			if err := t.Add(tag, message, false); err != nil {
+				return nil, err
+			}
+		}
+		c.translators[locale] = t
+	}
+	// go-playground translations are added to the translators once, later registrations only find conflicts
+	if err := c.registerAll(validator.New()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// register registers go-playground translations of built-in tags on a validator
+func (c *MessageCatalog) register(validate *validator.Validate, trans *catalogTranslator) error {
+	if trans.Locale() == "fr_CA" {
+		return fr_translations.RegisterDefaultTranslations(validate, trans)
+	}
+	return en_translations.RegisterDefaultTranslations(validate, trans)
+}
+
+// registerAll registers go-playground translations of built-in tags on a validator for every locale
+func (c *MessageCatalog) registerAll(validate *validator.Validate) error {
+	for _, trans := range c.translators {
+		if err := c.register(validate, trans); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetTenantMessage overrides the message of a tag for a tenant in a locale.
+// {0} stands for the field and {1} for the tag parameter.
+func (c *MessageCatalog) SetTenantMessage(tenantID int, locale, tag, template string) error {
+	locale, ok := c.locale(locale)
+	if !ok {
+		return fmt.Errorf("unsupported locale %q", locale)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.tenants[tenantID]; !ok {
+		c.tenants[tenantID] = make(map[string]map[string]string)
+	}
+	if _, ok := c.tenants[tenantID][locale]; !ok {
+		c.tenants[tenantID][locale] = make(map[string]string)
+	}
+	c.tenants[tenantID][locale][tag] = template
+	return nil
+}
+
+// locale returns the catalog locale matching a requested one, ex: fr-CA, fr_ca or fr
+func (c *MessageCatalog) locale(requested string) (string, bool) {
+	return supportedLocale(requested)
+}
+
+// supportedLocale normalizes a requested locale (ex: fr-CA or fr) to a locale messages are rendered in
+func supportedLocale(requested string) (string, bool) {
+	requested = strings.ReplaceAll(requested, "-", "_")
+	for locale := range customMessages {
+		if strings.EqualFold(locale, requested) {
+			return locale, true
+		}
+	}
+	for locale := range customMessages {
+		language, _, _ := strings.Cut(locale, "_")
+		if strings.EqualFold(language, requested) {
+			return locale, true
+		}
+	}
+	return requested, false
+}
+
+// contextLocale returns the catalog locale read from the "locale" context value, fallback when not supported
+func (c *MessageCatalog) contextLocale(ctx context.Context, fallback string) string {
+	requested, _ := ctx.Value("locale").(string)
+	if locale, ok := c.locale(requested); ok {
+		return locale
+	}
+	return fallback
+}
+
+// message renders a violation for a tenant with the given translator, the field is named by its display name
+func (c *MessageCatalog) message(trans *catalogTranslator, tenantID int, fe validator.FieldError) string {
+	locale := trans.Locale()
+	display := fe.Field()
+	if name, ok := c.DisplayName(tenantID, locale, fe.StructNamespace()); ok {
+		display = name
+	}
+	c.mu.RLock()
+	template, ok := c.tenants[tenantID][locale][fe.Tag()]
+	c.mu.RUnlock()
+	if ok {
+		return strings.NewReplacer("{0}", display, "{1}", fe.Param()).Replace(template)
+	}
+	if _, ok := fe.(*providerFieldError); !ok {
+		// translated by the go-playground translation registered on the validator, the raw error when there is none
+		if message := fe.Translate(trans); message != fe.Error() {
+			return strings.ReplaceAll(message, fieldPlaceholder, display)
+		}
+	}
+	message, err := trans.T(fe.Tag(), fe.Field(), fe.Param())
+	if err != nil {
+		message, _ = trans.T(fallbackMessageKey, fe.Field(), fe.Param())
+	}
+	return strings.ReplaceAll(message, fieldPlaceholder, display)
+}
+
+// ErrorMessages returns the messages of the violations of a validation error by namespace, nil when it holds none
+func ErrorMessages(err error) map[string]string {
+	fieldErrors, ok := fieldErrorsOf(err)
+	if !ok {
+		return nil
+	}
+	messages := make(map[string]string, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		messages[fe.Namespace()] = fe.Translate(nil)
+	}
+	return messages
+}
+
+// SetTenantMessage overrides the message of a tag for a tenant in a locale, see MessageCatalog.SetTenantMessage
+func (vp *POCDefaultValidationProvider) SetTenantMessage(tenant string, locale, tag, template string) error {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return err
+	}
+	return vp.messages.SetTenantMessage(tenantID, locale, tag, template)
+}
+
+// describeErrors renders the messages of a validation error in the context locale and names its fields
+// from struct tags, entity is the validated type.
+// Translations of built-in tags are the ones registered on the validator the error comes from when it was built.
+func (vp *POCDefaultValidationProvider) describeErrors(ctx context.Context, tenantID int, entity reflect.Type, err error) error {
+	fieldErrors, ok := fieldErrorsOf(err)
+	if !ok {
+		return err
+	}
+	trans := vp.messages.translators[vp.messages.contextLocale(ctx, vp.tenantLocale(tenantID))]
+	localized := make(ValidationErrors, len(fieldErrors))
+	for i, fe := range fieldErrors {
+		pfe := copyFieldError(fe)
+		pfe.message = vp.messages.message(trans, tenantID, fe)
+		pfe.path, pfe.pointer = vp.fieldNames.Path(entity, fe.StructNamespace())
+		localized[i] = pfe
+	}
+	return localized
+}
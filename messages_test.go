@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorMessages(t *testing.T) {
+	vp := newTestProvider()
+	user := provideValidUser()
+	user.FirstName = "Pam"
+	user.Email = "not an email"
+	user.Age = 17
+
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+	assert.Equal(t, map[string]string{
+		"POCUser.FirstName": "First name must start with S",
+		"POCUser.Email":     "Email must be a valid email address",
+		"POCUser.Age":       "Age must be 18 or greater",
+	}, ErrorMessages(vp.ValidateUserWithRulesValidation(ctx, user)))
+
+	ctx = context.WithValue(ctx, "locale", "fr-CA")
+	assert.Equal(t, map[string]string{
+		"POCUser.FirstName": "Prénom doit commencer par S",
+		"POCUser.Email":     "Courriel doit être une adresse email valide",
+		"POCUser.Age":       "Âge doit être égal à 18 ou plus",
+	}, ErrorMessages(vp.ValidateUserWithRulesValidation(ctx, user)))
+
+	// custom tags of the struct level validations
+	user = provideValidUser()
+	user.Addresses[0].Province = "QC"
+	user.Addresses[0].ZipCode = ""
+	messages := ErrorMessages(vp.ValidateUserWithStructValidation(ctx, user))
+	assert.Equal(t, "Code postal est un champ obligatoire", messages["POCUser.Addresses[0].ZipCode"])
+	assert.Equal(t, "Province doit être un nom de province canadienne", messages["POCUser.Addresses[0].Province"])
+
+	user = provideValidUser()
+	user.Age = 45
+	ctx = context.WithValue(context.Background(), "tenant", 2)
+	assert.Equal(t, "Age must be between 20 and 40", ErrorMessages(vp.ValidateUserWithStructValidation(ctx, user))["POCUser.age"])
+	ctx = context.WithValue(ctx, "locale", "fr-CA")
+	assert.Equal(t, "Âge doit être entre 20 et 40", ErrorMessages(vp.ValidateUserWithStructValidation(ctx, user))["POCUser.age"])
+
+	assert.Nil(t, ErrorMessages(vp.ValidateUserWithRulesValidation(ctx, provideValidUser())))
+}
+
+func TestTenantMessages(t *testing.T) {
+	vp := newTestProvider()
+	assert.NoError(t, vp.SetTenantMessage("2", "fr-CA", "email", "Le courriel {0} est invalide"))
+	assert.Error(t, vp.SetTenantMessage("2", "de-DE", "email", "{0}"))
+	user := provideValidUser()
+	user.Email = "not an email"
+
+	ctx := context.WithValue(context.WithValue(context.Background(), "tenant", 2), "locale", "fr")
+	err := vp.ValidateUserWithRulesValidation(ctx, user)
+	assert.Equal(t, map[string]string{"POCUser.Email": "Le courriel Courriel est invalide"}, ErrorMessages(err))
+	// messages are kept through redaction
+	assert.Equal(t, "Le courriel Courriel est invalide", vp.RedactionPolicy().Violations(err)[0].Message)
+
+	// other tenants and locales are not affected
+	ctx = context.WithValue(context.WithValue(context.Background(), "tenant", 1), "locale", "fr")
+	assert.Equal(t, "Courriel doit être une adresse email valide", ErrorMessages(vp.ValidateUserWithRulesValidation(ctx, user))["POCUser.Email"])
+	ctx = context.WithValue(context.WithValue(context.Background(), "tenant", 2), "locale", "en-CA")
+	assert.Equal(t, "Email must be a valid email address", ErrorMessages(vp.ValidateUserWithRulesValidation(ctx, user))["POCUser.Email"])
+}
+
+func TestProviderViolationMessages(t *testing.T) {
+	vp := newTestProvider()
+	vp.AddTenantAsyncValidator("2", NewAsyncValidator("uniqueemail", "Email",
+		func(entity any) string { return entity.(POCUser).Email },
+		func(ctx context.Context, entity any) (bool, error) { return false, nil }), time.Second)
+	ctx := context.WithValue(context.WithValue(context.Background(), "tenant", 2), "locale", "fr-CA")
+	err := vp.ValidateUserWithRulesValidation(ctx, provideValidUser())
+	assert.Equal(t, map[string]string{"POCUser.Email": "Courriel n'est pas valide"}, ErrorMessages(err))
+}
+
+func TestAdminValidateMessages(t *testing.T) {
+	h := NewAdminHandler(newTestProvider(), "secret")
+	r := httptest.NewRequest(http.MethodPost, "/tenants/2/validate", strings.NewReader(`{"FirstName":"Sam","myAge":"25","Email":"bad"}`))
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("Accept-Language", "fr-CA,fr;q=0.9,en;q=0.8")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"message":"Courriel doit être une adresse email valide"`)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// openMetricsContentType is the content type of the OpenMetrics text exposition format
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	// maxFailureSeries bounds the number of failure series, failures past it are counted under the "other" field
+	maxFailureSeries = 10000
+	// overflowLabel is the field label used once maxFailureSeries is reached
+	overflowLabel = "other"
+)
+
+// validationDurationBuckets are the upper bounds, in seconds, of the validation latency histogram
+var validationDurationBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+type validationKey struct {
+	tenant  string
+	entity  string
+	outcome string
+}
+
+type failureKey struct {
+	tenant string
+	entity string
+	field  string
+	rule   string
+}
+
+type durationKey struct {
+	tenant string
+	entity string
+}
+
+type histogram struct {
+	buckets []uint64 // cumulative counts are computed at exposition
+	count   uint64
+	sum     float64
+}
+
+// ValidationMetrics counts validations, failures per tenant/entity/field/rule and validation latency.
+// Field labels have their slice indexes and map keys collapsed (Applicants[123456] -> Applicants[*])
+// to keep label cardinality bounded.
+type ValidationMetrics struct {
+	mu          sync.Mutex
+	validations map[validationKey]uint64
+	failures    map[failureKey]uint64
+	durations   map[durationKey]*histogram
+}
+
+// NewValidationMetrics returns empty validation metrics
+func NewValidationMetrics() *ValidationMetrics {
+	return &ValidationMetrics{
+		validations: make(map[validationKey]uint64),
+		failures:    make(map[failureKey]uint64),
+		durations:   make(map[durationKey]*histogram),
+	}
+}
+
+// observe records a validation started at start with its result.
+// It is meant to be deferred, err is read once the validation returned.
+func (m *ValidationMetrics) observe(tenant, entity string, start time.Time, err *error) {
+	if m == nil {
+		return
+	}
+	elapsed := time.Since(start).Seconds()
+	outcome := validationOutcome(*err)
+	fieldErrors, _ := fieldErrorsOf(*err)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.validations[validationKey{tenant: tenant, entity: entity, outcome: outcome}]++
+	for _, fe := range fieldErrors {
+		key := failureKey{tenant: tenant, entity: entity, field: collapseIndexes(fe.Namespace()), rule: fe.Tag()}
+		if _, ok := m.failures[key]; !ok && len(m.failures) >= maxFailureSeries {
+			key.field, key.rule = overflowLabel, overflowLabel
+		}
+		m.failures[key]++
+	}
+	h, ok := m.durations[durationKey{tenant: tenant, entity: entity}]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(validationDurationBuckets))}
+		m.durations[durationKey{tenant: tenant, entity: entity}] = h
+	}
+	for i, bound := range validationDurationBuckets {
+		if elapsed <= bound {
+			h.buckets[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += elapsed
+}
+
+// WriteOpenMetrics writes the metrics in the OpenMetrics text exposition format, also readable by Prometheus
+func (m *ValidationMetrics) WriteOpenMetrics(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# TYPE validations counter\n# HELP validations Number of validations by outcome.\n")
+	validations := make([]string, 0, len(m.validations))
+	for k, v := range m.validations {
+		validations = append(validations, fmt.Sprintf("validations_total{%s} %d\n",
+			formatLabels("tenant", k.tenant, "entity", k.entity, "outcome", k.outcome), v))
+	}
+	sort.Strings(validations)
+	b.WriteString(strings.Join(validations, ""))
+
+	b.WriteString("# TYPE validation_failures counter\n# HELP validation_failures Number of rule violations.\n")
+	failures := make([]string, 0, len(m.failures))
+	for k, v := range m.failures {
+		failures = append(failures, fmt.Sprintf("validation_failures_total{%s} %d\n",
+			formatLabels("tenant", k.tenant, "entity", k.entity, "field", k.field, "rule", k.rule), v))
+	}
+	sort.Strings(failures)
+	b.WriteString(strings.Join(failures, ""))
+
+	b.WriteString("# TYPE validation_duration_seconds histogram\n# HELP validation_duration_seconds Validation latency.\n")
+	keys := make([]durationKey, 0, len(m.durations))
+	for k := range m.durations {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].tenant+"/"+keys[i].entity < keys[j].tenant+"/"+keys[j].entity
+	})
+	for _, k := range keys {
+		h := m.durations[k]
+		var cumulative uint64
+		for i, bound := range validationDurationBuckets {
+			cumulative += h.buckets[i]
+			fmt.Fprintf(&b, "validation_duration_seconds_bucket{%s} %d\n",
+				formatLabels("tenant", k.tenant, "entity", k.entity, "le", strconv.FormatFloat(bound, 'g', -1, 64)), cumulative)
+		}
+		labels := formatLabels("tenant", k.tenant, "entity", k.entity)
+		fmt.Fprintf(&b, "validation_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(&b, "validation_duration_seconds_count{%s} %d\n", labels, h.count)
+		fmt.Fprintf(&b, "validation_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	}
+	b.WriteString("# EOF\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP exposes the metrics in the OpenMetrics text exposition format
+func (m *ValidationMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", openMetricsContentType)
+	_ = m.WriteOpenMetrics(w)
+}
+
+// Snapshot returns the counters keyed by their labels, used by expvar
+func (m *ValidationMetrics) Snapshot() map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	validations := make(map[string]uint64, len(m.validations))
+	for k, v := range m.validations {
+		validations[fmt.Sprintf("%s/%s/%s", k.tenant, k.entity, k.outcome)] = v
+	}
+	failures := make(map[string]uint64, len(m.failures))
+	for k, v := range m.failures {
+		failures[fmt.Sprintf("%s/%s/%s/%s", k.tenant, k.entity, k.field, k.rule)] = v
+	}
+	durations := make(map[string]map[string]interface{}, len(m.durations))
+	for k, h := range m.durations {
+		durations[fmt.Sprintf("%s/%s", k.tenant, k.entity)] = map[string]interface{}{"count": h.count, "sum": h.sum}
+	}
+	return map[string]interface{}{
+		"validations": validations,
+		"failures":    failures,
+		"durations":   durations,
+	}
+}
+
+// PublishExpvar publishes the metrics snapshot under the given expvar name.
+// Like expvar.Publish, it panics when the name is already used.
+func (m *ValidationMetrics) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return m.Snapshot()
+	}))
+}
+
+// formatLabels formats label name/value pairs, escaping values as required by the exposition format
+func formatLabels(pairs ...string) string {
+	labels := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i+1])
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, pairs[i], value))
+	}
+	return strings.Join(labels, ",")
+}
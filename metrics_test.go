@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidationMetrics(t *testing.T) {
+	vp := newTestProvider()
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+	user := provideValidUser()
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(ctx, user))
+	user.Age = 10
+	assert.Error(t, vp.ValidateUserWithRulesValidation(ctx, user))
+
+	recorder := httptest.NewRecorder()
+	vp.Metrics().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	assert.Equal(t, openMetricsContentType, recorder.Header().Get("Content-Type"))
+	assert.Contains(t, body, `validations_total{tenant="1",entity="POCUser",outcome="valid"} 1`)
+	assert.Contains(t, body, `validations_total{tenant="1",entity="POCUser",outcome="invalid"} 1`)
+	assert.Contains(t, body, `validation_failures_total{tenant="1",entity="POCUser",field="POCUser.Age",rule="min"} 1`)
+	assert.Contains(t, body, `validation_duration_seconds_count{tenant="1",entity="POCUser"} 2`)
+	assert.Contains(t, body, `validation_duration_seconds_bucket{tenant="1",entity="POCUser",le="+Inf"} 2`)
+	assert.True(t, strings.HasSuffix(body, "# EOF\n"))
+}
+
+func TestValidationMetricsCollapsesIndexes(t *testing.T) {
+	m := NewValidationMetrics()
+	for _, ns := range []string{"Application.Applicants[123456].Email", "Application.Applicants[42].Email"} {
+		var err error = ValidationErrors{&providerFieldError{tag: "required", ns: ns}}
+		m.observe("1", "Application", time.Now(), &err)
+	}
+	var b strings.Builder
+	assert.NoError(t, m.WriteOpenMetrics(&b))
+	assert.Contains(t, b.String(), `field="Application.Applicants[*].Email",rule="required"} 2`)
+	assert.Len(t, m.failures, 1)
+}
+
+func TestServeMetrics(t *testing.T) {
+	vp := newTestProvider()
+	vp.Metrics().PublishExpvar("validation_test")
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(ctx, provideValidUser()))
+	mux := newServeMux(vp, "")
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, openMetricsContentType, recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), `validations_total{tenant="1",entity="POCUser",outcome="valid"} 1`)
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/vars", nil))
+	var vars struct {
+		Validation struct {
+			Validations map[string]uint64 `json:"validations"`
+		} `json:"validation_test"`
+	}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &vars))
+	assert.Equal(t, map[string]uint64{"1/POCUser/valid": 1}, vars.Validation.Validations)
+	assert.Panics(t, func() { vp.Metrics().PublishExpvar("validation_test") })
+}
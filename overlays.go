@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrNonProductionOverlay is returned when a provider in production mode would load an overlay
+// that is not meant for production
+var ErrNonProductionOverlay = errors.New("overlay is not allowed in production")
+
+// Environment is the environment a provider runs in
+type Environment string
+
+// Production providers refuse non-production overlays, see RuleOverlay
+const (
+	Production  Environment = "production"
+	Staging     Environment = "staging"
+	QA          Environment = "qa"
+	Development Environment = "development"
+)
+
+// RuleOverlay adjusts the user rules of an environment, ex: accepting test phone numbers in QA.
+// Rules of an overlay replace the effective rule of their field after every tenant rule, an empty rule removes it.
+// Overlays only cover map rules, the checks of struct level validators still apply.
+// Rules under the empty tenant apply to all tenants, the ones of a tenant to its sub-brands too.
+type RuleOverlay struct {
+	Name          string                       `json:"name"`
+	NonProduction bool                         `json:"nonProduction"` // the overlay can not be loaded in production
+	Rules         map[string]map[string]string `json:"rules"`         // by tenant ID or alias
+}
+
+// ProviderConfig selects the environment of a provider, the overlays it loads and the secret PII is hashed with
+type ProviderConfig struct {
+	Environment  Environment `json:"environment"` // Production when empty
+	Overlays     []string    `json:"overlays"`    // names of the overlays loaded, applied in order
+	RedactionKey []byte      `json:"-"`           // secret key of the hashes of redacted values, see RedactHash
+}
+
+// ProviderConfigFromEnv reads the provider config from the VALIDATION_ENVIRONMENT, VALIDATION_OVERLAYS
+// (comma separated names) and VALIDATION_REDACTION_KEY environment variables
+func ProviderConfigFromEnv() ProviderConfig {
+	cfg := ProviderConfig{
+		Environment:  Environment(os.Getenv("VALIDATION_ENVIRONMENT")),
+		RedactionKey: []byte(os.Getenv("VALIDATION_REDACTION_KEY")),
+	}
+	for _, name := range strings.Split(os.Getenv("VALIDATION_OVERLAYS"), ",") {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			cfg.Overlays = append(cfg.Overlays, name)
+		}
+	}
+	return cfg
+}
+
+// ApplyConfig sets the environment of the provider, keys its redaction policy and loads the overlays the config
+// selects among the available ones. The redaction key is required in production, other environments drop
+// the values to hash without it. It must be called at startup, before the first validation.
+func (vp *POCDefaultValidationProvider) ApplyConfig(cfg ProviderConfig, available ...RuleOverlay) error {
+	if len(cfg.Environment) == 0 {
+		cfg.Environment = Production
+	}
+	redaction := defaultRedactionPolicy(nil)
+	if cfg.Environment == Production || len(cfg.RedactionKey) > 0 {
+		var err error
+		if redaction, err = DefaultRedactionPolicy(cfg.RedactionKey); err != nil {
+			return err
+		}
+	}
+	byName := make(map[string]RuleOverlay, len(available))
+	for _, o := range available {
+		byName[o.Name] = o
+	}
+	overlays := make([]RuleOverlay, 0, len(cfg.Overlays))
+	for _, name := range cfg.Overlays {
+		o, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("unknown overlay %q", name)
+		}
+		overlays = append(overlays, o)
+	}
+	if err := vp.SetEnvironment(cfg.Environment); err != nil {
+		return err
+	}
+	if err := vp.LoadOverlays(overlays...); err != nil {
+		return err
+	}
+	vp.SetRedactionPolicy(redaction)
+	return nil
+}
+
+// SetEnvironment sets the environment of the provider, production when never set.
+// A provider can not switch to production once it loaded a non-production overlay.
+func (vp *POCDefaultValidationProvider) SetEnvironment(env Environment) error {
+	switch env {
+	case Production, Staging, QA, Development:
+	default:
+		return fmt.Errorf("unknown environment %q", env)
+	}
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	if env == Production {
+		for _, o := range vp.overlays {
+			if o.NonProduction {
+				return fmt.Errorf("overlay %s: %w", o.Name, ErrNonProductionOverlay)
+			}
+		}
+	}
+	vp.environment = env
+	return nil
+}
+
+// Environment returns the environment of the provider
+func (vp *POCDefaultValidationProvider) Environment() Environment {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	if len(vp.environment) == 0 {
+		return Production
+	}
+	return vp.environment
+}
+
+// LoadOverlays adds overlays applied after the ones already loaded.
+// Every overlay is linted, nothing is loaded if any of them is invalid or not allowed in the environment.
+func (vp *POCDefaultValidationProvider) LoadOverlays(overlays ...RuleOverlay) error {
+	loaded := make([]RuleOverlay, 0, len(overlays))
+	for _, o := range overlays {
+		// tenants are referenced by ID once loaded
+		byID := make(map[string]map[string]string, len(o.Rules))
+		for tenant, rules := range o.Rules {
+			tenantID := globalScope
+			if len(tenant) > 0 {
+				key, err := vp.configuredTenantKey(tenant)
+				if err != nil {
+					return fmt.Errorf("overlay %s: %w", o.Name, err)
+				}
+				tenantID, tenant = key, vp.tenantIDOf(key)
+			}
+			// empty rules remove the rule of their field
+			lint := make(map[string]string, len(rules))
+			for field, rule := range rules {
+				if len(rule) > 0 {
+					lint[field] = rule
+				}
+			}
+			if err := vp.lintTenantRules(tenantID, lint); err != nil {
+				return fmt.Errorf("overlay %s, tenant %q: %w", o.Name, tenant, err)
+			}
+			byID[tenant] = copyRules(rules)
+		}
+		o.Rules = byID
+		loaded = append(loaded, o)
+	}
+	// the environment is checked with the overlays appended, SetEnvironment can not switch to production in between
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	for _, o := range loaded {
+		if o.NonProduction && (vp.environment == Production || len(vp.environment) == 0) {
+			return fmt.Errorf("overlay %s: %w", o.Name, ErrNonProductionOverlay)
+		}
+	}
+	vp.overlays = append(vp.overlays, loaded...)
+	return nil
+}
+
+// Overlays returns the names of the loaded overlays, in the order they apply
+func (vp *POCDefaultValidationProvider) Overlays() []string {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	names := make([]string, 0, len(vp.overlays))
+	for _, o := range vp.overlays {
+		names = append(names, o.Name)
+	}
+	return names
+}
+
+// overlayLayers returns the layers of the loaded overlays for a tenant chain, root first
+func (vp *POCDefaultValidationProvider) overlayLayers(chain []int) []ruleLayer {
+	vp.mu.RLock()
+	overlays := vp.overlays
+	vp.mu.RUnlock()
+	var layers []ruleLayer
+	for _, o := range overlays {
+		for _, key := range chainScopes(chain) {
+			tenant := ""
+			if key != globalScope {
+				tenant = vp.tenantIDOf(key)
+			}
+			if rules := o.Rules[tenant]; len(rules) > 0 {
+				layers = append(layers, ruleLayer{source: "overlay " + o.Name, rules: rules, replace: true})
+			}
+		}
+	}
+	return layers
+}
+
+// EnvironmentOverlays returns the overlays environments can select, see ProviderConfig.
+// Like every overlay they replace map rules, validations running struct level validators are not affected:
+// test-phones users are accepted by ValidateUserWithRulesValidation, not by ValidateUserWithStructValidation
+// where the nesto validator checks phones itself.
+func EnvironmentOverlays() []RuleOverlay {
+	return []RuleOverlay{
+		{
+			Name:          "test-phones",
+			NonProduction: true,
+			// test phone numbers like 555-555-555, see isTestPhone
+			Rules: map[string]map[string]string{"nesto": {"Phone": "e164|testphone"}},
+		},
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvironmentOverlays(t *testing.T) {
+	vp := newTestTenantChain(t)
+	assert.Equal(t, Production, vp.Environment())
+	skipAge := RuleOverlay{Name: "skip-age", NonProduction: true, Rules: map[string]map[string]string{"": {"Age": ""}}}
+	assert.ErrorIs(t, vp.LoadOverlays(skipAge), ErrNonProductionOverlay)
+	assert.ErrorIs(t, vp.ApplyConfig(ProviderConfig{RedactionKey: testRedactionKey, Overlays: []string{"test-phones"}}, EnvironmentOverlays()...), ErrNonProductionOverlay)
+	assert.Empty(t, vp.Overlays())
+
+	assert.Error(t, vp.ApplyConfig(ProviderConfig{RedactionKey: testRedactionKey, Environment: "moon"}))
+	assert.ErrorIs(t, vp.ApplyConfig(ProviderConfig{}), ErrWeakRedactionKey)
+	assert.ErrorIs(t, vp.ApplyConfig(ProviderConfig{Environment: QA, RedactionKey: []byte("short")}), ErrWeakRedactionKey)
+	// outside production the key is optional
+	assert.NoError(t, vp.ApplyConfig(ProviderConfig{Environment: Development}))
+	assert.Equal(t, Development, vp.Environment())
+	assert.Error(t, vp.ApplyConfig(ProviderConfig{RedactionKey: testRedactionKey, Environment: QA, Overlays: []string{"unknown"}}, EnvironmentOverlays()...))
+	assert.Error(t, vp.LoadOverlays(RuleOverlay{Name: "invalid", Rules: map[string]map[string]string{"1": {"Phone": "unknowntag"}}}))
+	assert.NoError(t, vp.ApplyConfig(ProviderConfig{RedactionKey: testRedactionKey, Environment: QA, Overlays: []string{"test-phones"}}, EnvironmentOverlays()...))
+	assert.NoError(t, vp.LoadOverlays(skipAge))
+	assert.Equal(t, []string{"test-phones", "skip-age"}, vp.Overlays())
+	// non-production overlays keep the provider out of production
+	assert.ErrorIs(t, vp.SetEnvironment(Production), ErrNonProductionOverlay)
+	assert.Equal(t, QA, vp.Environment())
+
+	// overlays replace the rules of tenants and of their sub-brands, empty rules remove them
+	assert.Equal(t, map[string]string{
+		"FirstName": "max=10,startswiths",
+		"Email":     "required,email,endswith=.ca",
+		"Phone":     "e164|testphone",
+	}, effectiveRules(t, vp, "prime-qc"))
+	user := provideValidUser()
+	user.Phone, user.Age, user.Email = "555-555-555", 12, "sam@mail.ca"
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(context.WithValue(context.Background(), "tenant", "prime-qc"), user))
+	user.Phone = "555-1234"
+	assert.Error(t, vp.ValidateUserWithRulesValidation(context.WithValue(context.Background(), "tenant", "prime-qc"), user))
+	assert.Contains(t, ruleOrigins(t, vp, "prime-qc"), RuleOrigin{Field: "Phone", Rule: "e164|testphone", Source: "overlay test-phones"})
+	assert.NotContains(t, ruleOrigins(t, vp, "prime-qc"), RuleOrigin{Field: "Phone", Rule: "e164", Source: "nesto validator"})
+}
+
+func TestOverlaysLoadedWhileValidating(t *testing.T) {
+	vp := newTestTenantChain(t)
+	ctx := context.WithValue(context.Background(), "tenant", "nesto")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = vp.ValidateUserWithRulesValidation(ctx, provideValidUser())
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, vp.ApplyConfig(ProviderConfig{RedactionKey: testRedactionKey, Environment: QA, Overlays: []string{"test-phones"}}, EnvironmentOverlays()...))
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, vp.Overlays(), 4)
+}
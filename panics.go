@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// InternalErrorTag is the tag of the violation reported in place of a rule whose function panicked,
+// its param names the rule. An entity is never accepted when one of its rules could not run.
+const InternalErrorTag = "internal"
+
+// validationRule names the rule of violations reported for panics outside of any validation function
+const validationRule = "validation"
+
+// ErrMissingTenant is returned when the context of a validation does not hold a "tenant" value
+var ErrMissingTenant = errors.New(`validation context has no "tenant" value`)
+
+// PanicIncident describes a panic recovered while validating an entity
+type PanicIncident struct {
+	Tenant string // ID of the tenant
+	Entity string
+	Rule   string // tag or struct level function that panicked
+	Field  string // struct namespace of the field validated by the rule, ex: POCUser.Email, empty for struct level functions
+	Panic  string // panic value, PII values of the entity it quotes are redacted, see RedactionPolicy.RedactText
+	Stack  []byte // redacted like Panic
+}
+
+// PanicHook is called for every panic recovered while validating, ex: to log or page on it.
+// It must be safe for concurrent use.
+type PanicHook func(PanicIncident)
+
+// SetPanicHook sets the hook called for every panic recovered while validating
+func (vp *POCDefaultValidationProvider) SetPanicHook(hook PanicHook) {
+	vp.panicHook = hook
+}
+
+// panicGuard recovers the panics of the functions run while validating an entity.
+// Panics of field level functions are turned into a failure of their rule while validating,
+// then into internal error violations by convert once validation ends.
+// It also reports the rules it runs to the AfterRule hooks when set.
+type panicGuard struct {
+	tenantID  int
+	tenant    string // ID of the tenant, reported to the hook
+	entity    reflect.Type
+	value     interface{}      // entity validated, its PII values are redacted from incidents
+	redaction *RedactionPolicy // policy incidents are redacted with
+	hook      PanicHook
+	mu        sync.Mutex
+	fields    []PanicIncident
+	ctx       context.Context // context of the validation passed to hooks
+	hooks     Hooks           // nil when rules are not reported
+	info      ValidationInfo
+}
+
+// newPanicGuard returns a guard for the validation of an entity of a tenant
+func (vp *POCDefaultValidationProvider) newPanicGuard(tenantID int, value interface{}) *panicGuard {
+	entity := reflect.TypeOf(value)
+	for entity.Kind() == reflect.Ptr {
+		entity = entity.Elem()
+	}
+	return &panicGuard{
+		tenantID:  tenantID,
+		tenant:    vp.tenantIDOf(tenantID),
+		entity:    entity,
+		value:     value,
+		redaction: vp.RedactionPolicy(),
+		hook:      vp.panicHook,
+	}
+}
+
+// withHooks reports the rules run through the guard to hooks, nil hooks report none
+func (g *panicGuard) withHooks(ctx context.Context, hooks hookChain, info ValidationInfo) *panicGuard {
+	if len(hooks) > 0 {
+		g.ctx, g.hooks, g.info = ctx, hooks, info
+	}
+	return g
+}
+
+// afterRule reports a rule run to the hooks
+func (g *panicGuard) afterRule(rule, field string, start time.Time, valid, panicked bool) {
+	g.hooks.AfterRule(g.ctx, g.info, RuleEvent{Rule: rule, Field: field, Elapsed: time.Since(start), Valid: valid, Panicked: panicked})
+}
+
+// recovered reports a recovered panic to the hook, the panic value and stack redacted
+func (g *panicGuard) recovered(rule, field string, r interface{}) PanicIncident {
+	incident := PanicIncident{
+		Tenant: g.tenant,
+		Entity: g.entity.Name(),
+		Rule:   rule,
+		Field:  field,
+		Panic:  g.redaction.RedactText(g.value, fmt.Sprint(r)),
+		Stack:  []byte(g.redaction.RedactText(g.value, string(debug.Stack()))),
+	}
+	if g.hook != nil {
+		g.hook(incident)
+	}
+	return incident
+}
+
+// fieldNamespace returns the struct namespace of the field validated by a field level function, ex: POCUser.Email.
+// Functions are only given the field name, its parent is searched by address among the structs of the validated entity,
+// entities are validated through pointers for it, see addressable. The field name is returned when it is not found.
+func fieldNamespace(fl validator.FieldLevel) string {
+	parent := fl.Parent()
+	for parent.Kind() == reflect.Ptr && !parent.IsNil() {
+		parent = parent.Elem()
+	}
+	if parent.Kind() != reflect.Struct || !parent.CanAddr() {
+		return fl.StructFieldName()
+	}
+	top := fl.Top()
+	for top.Kind() == reflect.Ptr && !top.IsNil() {
+		top = top.Elem()
+	}
+	namespace := ""
+	walkStructs(top, top.Type().Name(), func(v reflect.Value, ns string) {
+		if len(namespace) == 0 && v.Type() == parent.Type() && v.CanAddr() && v.Addr().Pointer() == parent.Addr().Pointer() {
+			namespace = ns
+		}
+	})
+	if len(namespace) == 0 {
+		return fl.StructFieldName()
+	}
+	return namespace + "." + fl.StructFieldName()
+}
+
+// addressable returns an entity to validate through a pointer, a copy of it when it is not one, see fieldNamespace
+func addressable(entity any) any {
+	v := reflect.ValueOf(entity)
+	if v.Kind() == reflect.Ptr {
+		return entity
+	}
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	return ptr.Interface()
+}
+
+// guardSlot holds the guard of the validation a validator is used for, the validator is used by one validation
+// at a time, see validatorCache. The functions registered on the validator recover their panics through
+// the guard in the slot, none are recovered while it is empty.
+type guardSlot struct {
+	guard *panicGuard
+}
+
+// fieldFunc returns a field level function failing instead of panicking, a nil slot returns fn
+func (s *guardSlot) fieldFunc(tag string, fn validator.Func) validator.Func {
+	if s == nil {
+		return fn
+	}
+	return func(fl validator.FieldLevel) bool {
+		return s.guard.runField(tag, fn, fl)
+	}
+}
+
+// structFunc returns a struct level function reporting an internal error instead of panicking,
+// violations it reported before panicking are kept
+func (s *guardSlot) structFunc(rule string, fn validator.StructLevelFunc) validator.StructLevelFunc {
+	guarded := s.structFuncCtx(rule, func(_ context.Context, sl validator.StructLevel) { fn(sl) })
+	return func(sl validator.StructLevel) {
+		guarded(context.Background(), sl)
+	}
+}
+
+// structFuncCtx is structFunc for struct level functions taking a context
+func (s *guardSlot) structFuncCtx(rule string, fn validator.StructLevelFuncCtx) validator.StructLevelFuncCtx {
+	return func(ctx context.Context, sl validator.StructLevel) {
+		s.guard.runStruct(ctx, rule, fn, sl)
+	}
+}
+
+// runField runs a field level function, failing instead of panicking
+func (g *panicGuard) runField(tag string, fn validator.Func, fl validator.FieldLevel) (valid bool) {
+	if g == nil {
+		return fn(fl)
+	}
+	var start time.Time
+	if g.hooks != nil {
+		start = time.Now()
+	}
+	defer func() {
+		r := recover()
+		if r == nil && g.hooks == nil {
+			return
+		}
+		field := fieldNamespace(fl)
+		if r != nil {
+			incident := g.recovered(tag, field, r)
+			g.mu.Lock()
+			g.fields = append(g.fields, incident)
+			g.mu.Unlock()
+			valid = false
+		}
+		if g.hooks != nil {
+			g.afterRule(tag, field, start, valid, r != nil)
+		}
+	}()
+	return fn(fl)
+}
+
+// runStruct runs a struct level function, reporting an internal error instead of panicking
+func (g *panicGuard) runStruct(ctx context.Context, rule string, fn validator.StructLevelFuncCtx, sl validator.StructLevel) {
+	if g == nil {
+		fn(ctx, sl)
+		return
+	}
+	var start time.Time
+	if g.hooks != nil {
+		start = time.Now()
+	}
+	defer func() {
+		r := recover()
+		if r != nil {
+			g.recovered(rule, "", r)
+			sl.ReportError(nil, rule, rule, InternalErrorTag, rule)
+		}
+		if g.hooks != nil {
+			g.afterRule(rule, "", start, r == nil, r != nil)
+		}
+	}()
+	fn(ctx, sl)
+}
+
+// convert turns the failures of field level functions that panicked into internal error violations
+func (g *panicGuard) convert(err error) error {
+	if g == nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fieldErrors, ok := fieldErrorsOf(err)
+	if len(g.fields) == 0 || !ok {
+		return err
+	}
+	converted := make(ValidationErrors, len(fieldErrors))
+	for i, fe := range fieldErrors {
+		converted[i] = fe
+		for _, incident := range g.fields {
+			if fe.ActualTag() == incident.Rule && fe.StructNamespace() == incident.Field {
+				internal := copyFieldError(fe)
+				internal.tag, internal.actualTag, internal.param = InternalErrorTag, InternalErrorTag, incident.Rule
+				converted[i] = internal
+				break
+			}
+		}
+	}
+	return converted
+}
+
+// recoverValidation is deferred by the validation entry points: a panic outside of the guarded functions
+// is reported to the hook and returned as an internal error violation of the entity
+func (vp *POCDefaultValidationProvider) recoverValidation(ctx context.Context, g *panicGuard, err *error) {
+	if r := recover(); r != nil {
+		g.recovered(validationRule, "", r)
+		internal := ValidationErrors{newProviderFieldError(g.entity, validationRule, InternalErrorTag, validationRule, nil)}
+		*err = vp.describeErrors(ctx, g.tenantID, g.entity, internal)
+	}
+}
+
+// ruleName names the struct level function of a value, ex: TenantAUserValidator.UserValidation
+func ruleName(v interface{}, function string) string {
+	return reflect.Indirect(reflect.ValueOf(v)).Type().Name() + "." + function
+}
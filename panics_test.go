@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+// panickingUserValidator is a tenant validator panicking after reporting a violation
+type panickingUserValidator struct{}
+
+func (v *panickingUserValidator) UserValidation(sl validator.StructLevel) {
+	v.UserValidationWithReporter(sl, NewStructReporter(sl, false))
+}
+
+func (v *panickingUserValidator) UserValidationWithReporter(sl validator.StructLevel, r *StructReporter) {
+	r.Field("Phone").Report("e164", "")
+	var addresses []*Address
+	_ = addresses[3].ZipCode
+}
+
+func (v *panickingUserValidator) UserValidationRules() map[string]string {
+	return map[string]string{"Phone": "boom"}
+}
+
+// incidentRecorder records the incidents reported to a panic hook
+type incidentRecorder struct {
+	mu        sync.Mutex
+	incidents []PanicIncident
+}
+
+func (r *incidentRecorder) hook(incident PanicIncident) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.incidents = append(r.incidents, incident)
+}
+
+func newPanickingProvider(recorder *incidentRecorder) *POCDefaultValidationProvider {
+	vp := newTestProvider()
+	vp.SetTenantValidator("3", &panickingUserValidator{})
+	_ = vp.RegisterTenantValidation("3", "boom", func(fl validator.FieldLevel) bool { panic("boom") })
+	vp.SetPanicHook(recorder.hook)
+	return vp
+}
+
+func TestPanicsBecomeInternalErrors(t *testing.T) {
+	recorder := &incidentRecorder{}
+	vp := newPanickingProvider(recorder)
+	user := provideValidUser()
+	user.Age = 17
+	ctx := context.WithValue(context.Background(), "tenant", 3)
+
+	// the panicking custom validation is reported, the remaining rules still run
+	err := vp.ValidateUserWithRulesValidation(ctx, user)
+	assert.ElementsMatch(t, []string{"Phone:internal", "Age:min"}, fieldFailures(err))
+	violations := vp.RedactionPolicy().Violations(err)
+	for _, v := range violations {
+		if v.Rule == InternalErrorTag {
+			assert.Equal(t, "boom", v.Param)
+			assert.Equal(t, "Phone number could not be validated, please try again later", v.Message)
+		}
+	}
+	assert.Len(t, recorder.incidents, 1)
+	assert.Equal(t, PanicIncident{Tenant: "3", Entity: "POCUser", Rule: "boom", Field: "POCUser.Phone", Panic: "boom"},
+		PanicIncident{Tenant: recorder.incidents[0].Tenant, Entity: recorder.incidents[0].Entity, Rule: recorder.incidents[0].Rule,
+			Field: recorder.incidents[0].Field, Panic: recorder.incidents[0].Panic})
+	assert.NotEmpty(t, recorder.incidents[0].Stack)
+
+	// struct level validations report what they could before panicking, the default ones still run
+	err = vp.ValidateUserWithStructValidation(ctx, user)
+	assert.ElementsMatch(t, []string{"age:min=18", "Phone:e164", "panickingUserValidator.UserValidation:internal"}, fieldFailures(err))
+	assert.Equal(t, "panickingUserValidator.UserValidation", recorder.incidents[1].Rule)
+}
+
+type panickingOrder struct {
+	Billing  Address
+	Shipping Address
+}
+
+func TestPanicsAreMatchedByNamespace(t *testing.T) {
+	recorder := &incidentRecorder{}
+	vp := newTestProvider()
+	vp.SetPanicHook(recorder.hook)
+	assert.NoError(t, vp.validators.RegisterValidation("zipboom", func(fl validator.FieldLevel) bool {
+		if fl.Field().String() == "panic" {
+			panic("boom")
+		}
+		return fl.Field().String() != "bad"
+	}))
+	assert.NoError(t, Register[Address](vp, EntityRules{Rules: map[string]string{"ZipCode": "zipboom"}}, nil))
+	assert.NoError(t, Register[panickingOrder](vp, EntityRules{}, nil))
+
+	// the same rule failing on the same field name elsewhere in the entity is not an internal error
+	err := vp.Validate(context.WithValue(context.Background(), "tenant", 1), panickingOrder{Billing: Address{ZipCode: "bad"}, Shipping: Address{ZipCode: "panic"}})
+	fieldErrors, _ := fieldErrorsOf(err)
+	failures := make([]string, 0, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		failures = append(failures, fe.StructNamespace()+":"+fe.Tag())
+	}
+	assert.ElementsMatch(t, []string{"panickingOrder.Billing.ZipCode:zipboom", "panickingOrder.Shipping.ZipCode:internal"}, failures)
+	assert.Len(t, recorder.incidents, 1)
+	assert.Equal(t, "panickingOrder.Shipping.ZipCode", recorder.incidents[0].Field)
+}
+
+func TestPanicIncidentsAreRedacted(t *testing.T) {
+	recorder := &incidentRecorder{}
+	vp := newTestProvider()
+	vp.SetPanicHook(recorder.hook)
+	assert.NoError(t, vp.RegisterTenantValidation("1", "quote", func(fl validator.FieldLevel) bool {
+		panic("no MX record for " + fl.Field().String())
+	}))
+	assert.NoError(t, vp.SetTenantRules("1", map[string]string{"Email": "quote"}))
+	user := provideValidUser()
+
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+	assert.Contains(t, fieldFailures(vp.ValidateUserWithRulesValidation(ctx, user)), "Email:internal")
+	assert.Len(t, recorder.incidents, 1)
+	assert.Contains(t, recorder.incidents[0].Panic, "no MX record for ")
+	assert.NotContains(t, recorder.incidents[0].Panic, user.Email)
+	assert.NotContains(t, string(recorder.incidents[0].Stack), user.Email)
+}
+
+func TestAsyncValidatorPanics(t *testing.T) {
+	recorder := &incidentRecorder{}
+	vp := newPanickingProvider(recorder)
+	vp.AddTenantAsyncValidator("1", NewAsyncValidator("uniqueemail", "Email", nil,
+		func(ctx context.Context, entity any) (bool, error) { panic("lookup") }), time.Second)
+
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+	assert.Equal(t, []string{"Email:internal"}, fieldFailures(vp.ValidateUserWithRulesValidation(ctx, provideValidUser())))
+	assert.Len(t, recorder.incidents, 1)
+	assert.Equal(t, "uniqueemail", recorder.incidents[0].Rule)
+}
+
+func TestOrdinaryInputsDoNotPanic(t *testing.T) {
+	recorder := &incidentRecorder{}
+	vp := newPanickingProvider(recorder)
+	user := provideValidUser()
+	user.FirstName = ""
+	user.Account = nil
+
+	assert.ErrorIs(t, vp.ValidateUserWithRulesValidation(context.Background(), user), ErrMissingTenant)
+	assert.ErrorIs(t, vp.Validate(context.WithValue(context.Background(), "tenant", 1.5), user), ErrMissingTenant)
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+	assert.Contains(t, fieldFailures(vp.ValidateUserWithStructValidation(ctx, user)), "first name:namestartswiths")
+	assert.Contains(t, fieldFailures(vp.ValidateUserWithStructValidation(ctx, user)), "account:required")
+	assert.Contains(t, fieldFailures(vp.ValidateUserWithRulesValidation(ctx, user)), "FirstName:startswiths")
+	assert.Empty(t, recorder.incidents)
+}
+
+func FuzzValidateUser(f *testing.F) {
+	f.Add("Sam", "Smith", "sam@mail.com", "+16175551212", "H2X1Y4", "Quebec", uint8(25), true, 1)
+	f.Add("", "", "", "", "", "", uint8(0), false, 2)
+	recorder := &incidentRecorder{}
+	vp := newTestProvider()
+	vp.SetPanicHook(recorder.hook)
+	f.Fuzz(func(t *testing.T, firstName, lastName, email, phone, zipCode, province string, age uint8, hasAccount bool, tenantID int) {
+		user := POCUser{
+			BaseUser:  BaseUser{LastName: lastName},
+			FirstName: firstName,
+			Age:       age,
+			Email:     email,
+			Phone:     phone,
+			Addresses: []*Address{{ZipCode: zipCode, Province: province}},
+		}
+		if hasAccount {
+			user.Account = &Account{ID: firstName}
+		}
+		ctx := context.WithValue(context.Background(), "tenant", tenantID)
+		_ = vp.ValidateUserWithStructValidation(ctx, user)
+		_ = vp.ValidateUserWithRulesValidation(ctx, user)
+		_ = vp.Validate(ctx, &user)
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		assert.Empty(t, recorder.incidents)
+	})
+}
+
+// testApplicant and testApplication are an application with applicants keyed by ID, some of them missing
+type testApplicant struct {
+	Email   string
+	Phone   string
+	Address *Address
+}
+
+type testApplication struct {
+	Applicants map[int]*testApplicant
+}
+
+func FuzzValidateApplication(f *testing.F) {
+	f.Add("sam@mail.com", "+16175551212", "H2X1Y4", "Quebec", true, false, 1)
+	f.Add("", "", "", "", false, true, 2)
+	recorder := &incidentRecorder{}
+	vp := newTestProvider()
+	vp.SetPanicHook(recorder.hook)
+	assert.NoError(f, Register[Address](vp, EntityRules{Rules: map[string]string{"ZipCode": "required,postcode_iso3166_alpha2=CA"}}, map[string]EntityRules{
+		"1": {Rules: map[string]string{"Province": "isprovincename"}},
+		"2": {Rules: map[string]string{"Province": "isprovincecode"}},
+	}))
+	assert.NoError(f, Register[testApplicant](vp, EntityRules{Rules: map[string]string{"Email": "required,email", "Phone": "e164"}}, nil))
+	assert.NoError(f, Register[testApplication](vp, EntityRules{
+		Rules: map[string]string{"Applicants": "required,dive,required"},
+		StructLevel: func(sl validator.StructLevel) {
+			for id, applicant := range sl.Current().Interface().(testApplication).Applicants {
+				if applicant != nil && applicant.Address == nil {
+					sl.ReportError(nil, fmt.Sprintf("Applicants[%d].Address", id), "Address", "required", "")
+				}
+			}
+		},
+	}, nil))
+	f.Fuzz(func(t *testing.T, email, phone, zipCode, province string, hasAddress, missingApplicant bool, tenantID int) {
+		applicant := &testApplicant{Email: email, Phone: phone}
+		if hasAddress {
+			applicant.Address = &Address{ZipCode: zipCode, Province: province}
+		}
+		app := testApplication{Applicants: map[int]*testApplicant{123456: applicant}}
+		if missingApplicant {
+			app.Applicants[654321] = nil
+		}
+		ctx := context.WithValue(context.Background(), "tenant", tenantID)
+		assert.NotPanics(t, func() { _ = vp.Validate(ctx, app) })
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		assert.Empty(t, recorder.incidents)
+	})
+}
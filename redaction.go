@@ -0,0 +1,346 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// RedactionAction defines how a PII value is redacted
+type RedactionAction int
+
+const (
+	// RedactMask replaces all but the last characters of the value by '*'
+	RedactMask RedactionAction = iota
+	// RedactHash replaces the value by a keyed hash, so equal values can still be correlated
+	RedactHash
+	// RedactDrop removes the value
+	RedactDrop
+)
+
+const (
+	// minRedactionKeyLength is the minimum length of the secret key values are hashed with
+	minRedactionKeyLength = 32
+	// maskVisibleChars is the number of trailing characters left visible by RedactMask
+	maskVisibleChars = 2
+	// maskMinLength is the minimum length for trailing characters to be left visible
+	maskMinLength = 6
+)
+
+// ErrWeakRedactionKey is returned when a redaction policy is given a key too short to keep hashed values secret
+var ErrWeakRedactionKey = fmt.Errorf("redaction key must be a secret of at least %d bytes", minRedactionKeyLength)
+
+// Violation is a redacted rule violation, safe to log, trace or return as JSON
+type Violation struct {
+	Namespace string      `json:"namespace"`
+	Field     string      `json:"field"`
+	Rule      string      `json:"rule"`
+	Param     string      `json:"param,omitempty"`
+	Value     interface{} `json:"value,omitempty"`
+	Message   string      `json:"message,omitempty"` // end user message, in the validation locale
+	Path      string      `json:"path,omitempty"`    // dot path named from struct tags
+	Pointer   string      `json:"pointer,omitempty"` // RFC 6901 JSON pointer
+}
+
+// RedactionPolicy declares which fields hold PII and how their values are redacted.
+// Fields are declared by struct field path, ex: Email or Account.ID, and match any entity
+// containing them: Email matches POCUser.Email as well as Application.Applicants[1].Email.
+type RedactionPolicy struct {
+	mu     sync.RWMutex
+	fields map[string]RedactionAction
+	key    []byte
+}
+
+// NewRedactionPolicy returns a policy without any PII field, key is the secret values are hashed with
+func NewRedactionPolicy(key []byte) (*RedactionPolicy, error) {
+	if len(key) < minRedactionKeyLength {
+		return nil, ErrWeakRedactionKey
+	}
+	return newRedactionPolicy(key), nil
+}
+
+func newRedactionPolicy(key []byte) *RedactionPolicy {
+	return &RedactionPolicy{
+		fields: make(map[string]RedactionAction),
+		key:    key,
+	}
+}
+
+// DefaultRedactionPolicy returns the policy of the PII fields of the provider entities, see NewRedactionPolicy
+func DefaultRedactionPolicy(key []byte) (*RedactionPolicy, error) {
+	if len(key) < minRedactionKeyLength {
+		return nil, ErrWeakRedactionKey
+	}
+	return defaultRedactionPolicy(key), nil
+}
+
+// defaultRedactionPolicy returns the default policy, values to hash are dropped when key is empty
+func defaultRedactionPolicy(key []byte) *RedactionPolicy {
+	p := newRedactionPolicy(key)
+	p.SetField("SocialInsuranceNUmber", RedactHash)
+	p.SetField("Email", RedactMask)
+	p.SetField("Phone", RedactMask)
+	p.SetField("Account.ID", RedactHash)
+	return p
+}
+
+// SetField declares a PII field and how it is redacted
+func (p *RedactionPolicy) SetField(path string, action RedactionAction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fields[path] = action
+}
+
+// action returns the redaction action of a field path, ex: POCUser.Addresses[1].ZipCode
+func (p *RedactionPolicy) action(path string) (RedactionAction, bool) {
+	path = indexPattern.ReplaceAllString(path, "")
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for field, action := range p.fields {
+		if path == field || strings.HasSuffix(path, "."+field) {
+			return action, true
+		}
+	}
+	return 0, false
+}
+
+// IsPII reports whether the field path holds PII
+func (p *RedactionPolicy) IsPII(path string) bool {
+	_, ok := p.action(path)
+	return ok
+}
+
+// Redact returns the value of the field path with PII redacted.
+// Struct, slice and map values are returned as a redacted generic representation since any of their fields may be PII.
+func (p *RedactionPolicy) Redact(path string, value interface{}) interface{} {
+	if p == nil || value == nil {
+		return value
+	}
+	return p.redactValue(path, reflect.ValueOf(value))
+}
+
+func (p *RedactionPolicy) redactValue(path string, v reflect.Value) interface{} {
+	if action, ok := p.action(path); ok {
+		return p.apply(action, v)
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if _, ok := v.Interface().(driver.Valuer); ok {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		// fields are matched with the type name as prefix, so a reported *Account still has its Account.ID redacted
+		if !strings.HasSuffix(path, "."+v.Type().Name()) && path != v.Type().Name() {
+			path = joinPath(path, v.Type().Name())
+		}
+		result := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			if f.Anonymous {
+				if embedded, ok := p.redactValue(path, v.Field(i)).(map[string]interface{}); ok {
+					for k, e := range embedded {
+						result[k] = e
+					}
+				}
+				continue
+			}
+			if redacted := p.redactValue(joinPath(path, f.Name), v.Field(i)); redacted != nil {
+				result[f.Name] = redacted
+			}
+		}
+		return result
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		result := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			result[i] = p.redactValue(path, v.Index(i))
+		}
+		return result
+	case reflect.Map:
+		result := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			result[fmt.Sprint(iter.Key().Interface())] = p.redactValue(path, iter.Value())
+		}
+		return result
+	}
+	return v.Interface()
+}
+
+func joinPath(path, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+	return path + "." + name
+}
+
+// plainText returns the text of a value redacted by actions, false when it is nil
+func plainText(v reflect.Value) (string, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	var value interface{} = v.Interface()
+	if valuer, ok := value.(driver.Valuer); ok {
+		var err error
+		if value, err = valuer.Value(); err != nil || value == nil {
+			return "", false
+		}
+	}
+	return fmt.Sprint(value), true
+}
+
+// apply redacts a PII value
+func (p *RedactionPolicy) apply(action RedactionAction, v reflect.Value) interface{} {
+	s, ok := plainText(v)
+	if !ok {
+		return nil
+	}
+	if len(s) == 0 {
+		return ""
+	}
+	switch action {
+	case RedactMask:
+		runes := []rune(s)
+		visible := 0
+		if len(runes) >= maskMinLength {
+			visible = maskVisibleChars
+		}
+		return strings.Repeat("*", len(runes)-visible) + string(runes[len(runes)-visible:])
+	case RedactHash:
+		if len(p.key) == 0 {
+			// no secret to hash with, see POCDefaultValidationProvider.ApplyConfig
+			return nil
+		}
+		mac := hmac.New(sha256.New, p.key)
+		mac.Write([]byte(s))
+		return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+	default:
+		return nil
+	}
+}
+
+// RedactText replaces the values of the PII fields of an entity quoted in a text by their redaction,
+// ex: a panic message quoting the email of the user validated. Dropped values are replaced by [redacted].
+func (p *RedactionPolicy) RedactText(entity interface{}, text string) string {
+	v := reflect.ValueOf(entity)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if p == nil || v.Kind() != reflect.Struct || len(text) == 0 {
+		return text
+	}
+	var replacements []string
+	walkStructs(v, v.Type().Name(), func(s reflect.Value, ns string) {
+		for i := 0; i < s.NumField(); i++ {
+			f := s.Type().Field(i)
+			action, ok := p.action(ns + "." + f.Name)
+			if !f.IsExported() || !ok {
+				continue
+			}
+			value, ok := plainText(s.Field(i))
+			if !ok || len(value) == 0 {
+				continue
+			}
+			redacted, _ := p.apply(action, s.Field(i)).(string)
+			if len(redacted) == 0 {
+				redacted = "[redacted]"
+			}
+			replacements = append(replacements, value, redacted)
+		}
+	})
+	if len(replacements) == 0 {
+		return text
+	}
+	return strings.NewReplacer(replacements...).Replace(text)
+}
+
+// RedactFieldError returns a copy of the field error with its value redacted
+func (p *RedactionPolicy) RedactFieldError(fe validator.FieldError) validator.FieldError {
+	redacted := copyFieldError(fe)
+	redacted.value = p.Redact(fe.StructNamespace(), fe.Value())
+	redacted.redacted = true
+	return redacted
+}
+
+// RedactErrors returns the error with the values of its field errors redacted, other errors are returned as is
+func (p *RedactionPolicy) RedactErrors(err error) error {
+	fieldErrors, ok := fieldErrorsOf(err)
+	if p == nil || !ok {
+		return err
+	}
+	redacted := make(ValidationErrors, len(fieldErrors))
+	for i, fe := range fieldErrors {
+		if pfe, ok := fe.(*providerFieldError); ok && pfe.redacted {
+			redacted[i] = fe
+			continue
+		}
+		redacted[i] = p.RedactFieldError(fe)
+	}
+	return redacted
+}
+
+// Violations returns the redacted violations of a validation error, nil when it holds no field error
+func (p *RedactionPolicy) Violations(err error) []Violation {
+	fieldErrors, ok := fieldErrorsOf(err)
+	if !ok {
+		return nil
+	}
+	violations := make([]Violation, len(fieldErrors))
+	for i, fe := range fieldErrors {
+		pfe, ok := fe.(*providerFieldError)
+		if !ok || !pfe.redacted {
+			pfe = copyFieldError(fe)
+			pfe.value = p.Redact(fe.StructNamespace(), fe.Value())
+		}
+		violations[i] = Violation{
+			Namespace: fe.Namespace(),
+			Field:     fe.Field(),
+			Rule:      fe.Tag(),
+			Param:     fe.Param(),
+			Value:     pfe.value,
+			Message:   pfe.message,
+			Path:      pfe.path,
+			Pointer:   pfe.pointer,
+		}
+	}
+	return violations
+}
+
+// SetRedactionPolicy sets the policy applied to the values of every error returned by the provider
+func (vp *POCDefaultValidationProvider) SetRedactionPolicy(policy *RedactionPolicy) {
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	vp.redaction = policy
+}
+
+// RedactionPolicy returns the policy applied to the values of every error returned by the provider
+func (vp *POCDefaultValidationProvider) RedactionPolicy() *RedactionPolicy {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	return vp.redaction
+}
+
+// redactErrors redacts the values of a returned error, it is meant to be deferred
+func (vp *POCDefaultValidationProvider) redactErrors(err *error) {
+	*err = vp.RedactionPolicy().RedactErrors(*err)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertNoPII fails the test when any of the PII values appears in the outputs,
+// rendered as they would be printed, logged or returned as JSON.
+func assertNoPII(t testing.TB, pii []string, outputs ...interface{}) {
+	t.Helper()
+	for _, output := range outputs {
+		rendered := []string{fmt.Sprintf("%v", output), fmt.Sprintf("%+v", output)}
+		if b, err := json.Marshal(output); err == nil {
+			rendered = append(rendered, string(b))
+		}
+		if fieldErrors, ok := output.(ValidationErrors); ok {
+			for _, fe := range fieldErrors {
+				rendered = append(rendered, fmt.Sprintf("%+v", fe.Value()))
+			}
+		}
+		for _, r := range rendered {
+			for _, value := range pii {
+				if strings.Contains(r, value) {
+					t.Errorf("PII value %q escaped in %q", value, r)
+				}
+			}
+		}
+	}
+}
+
+// testRedactionKey is the secret the test providers hash PII with
+var testRedactionKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestRedactionPolicy(t *testing.T) {
+	_, err := DefaultRedactionPolicy([]byte("validation-provider"))
+	assert.ErrorIs(t, err, ErrWeakRedactionKey)
+	p, err := DefaultRedactionPolicy(testRedactionKey)
+	assert.NoError(t, err)
+	p.SetField("LastName", RedactDrop)
+	assert.Equal(t, "**********om", p.Redact("POCUser.Email", "sam@mail.com"))
+	assert.Equal(t, "****", p.Redact("POCUser.Phone", "5555"))
+	assert.Equal(t, p.Redact("Applicants[1].SocialInsuranceNUmber", "666-666-666"), p.Redact("SocialInsuranceNUmber", "666-666-666"))
+	assert.Nil(t, p.Redact("POCUser.LastName", "Smith"))
+	assert.Equal(t, "Quebec", p.Redact("POCUser.Addresses[0].Province", "Quebec"))
+
+	// composite values have their nested PII redacted
+	redacted := p.Redact("POCUser.ID", &Account{ID: "anuuid", Balance: 1})
+	assert.Equal(t, map[string]interface{}{"ID": p.Redact("Account.ID", "anuuid"), "Balance": float64(1)}, redacted)
+	user := provideValidUser()
+	assertNoPII(t, []string{user.Email, user.Phone, user.Account.ID, user.LastName}, p.Redact("POCUser", user))
+}
+
+func TestProviderRedactsErrors(t *testing.T) {
+	vp := newTestProvider()
+	user := provideValidUser()
+	user.Email = "not-an-email"
+	user.Account.ID = ""
+	user.Account.Balance = 10
+	user.Age = 10
+	pii := []string{user.Email}
+
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+	for _, validate := range []func(context.Context, POCUser) error{vp.ValidateUserWithStructValidation, vp.ValidateUserWithRulesValidation} {
+		err := validate(ctx, user)
+		assert.Error(t, err)
+		assertNoPII(t, pii, err, vp.RedactionPolicy().Violations(err))
+	}
+
+	var annotated bytes.Buffer
+	input := "FIRSTNAME,myAge,email,Phone,account.anID\nSam,10,not-an-email,+16175551212,secret-account\n"
+	_, err := vp.ValidateCSV(context.Background(), "1", POCUser{}, strings.NewReader(input), &annotated)
+	assert.NoError(t, err)
+	assertNoPII(t, []string{"not-an-email", "+16175551212", "secret-account"}, annotated.String())
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// DefaultReplayMaxExamples is the number of example records kept by a replay report unless set otherwise
+const DefaultReplayMaxExamples = 5
+
+// ReplayOptions tune a replay
+type ReplayOptions struct {
+	MaxExamples int // example records kept in the report, DefaultReplayMaxExamples when 0, none when negative
+}
+
+// ReplayExample is a record whose outcome changed between the two rule versions.
+// The record and its violations are redacted.
+type ReplayExample struct {
+	Line         int         `json:"line"`
+	EntityID     string      `json:"entityID,omitempty"`
+	FromOutcome  string      `json:"fromOutcome"`
+	ToOutcome    string      `json:"toOutcome"`
+	NewlyFailing []Violation `json:"newlyFailing,omitempty"`
+	NewlyPassing []Violation `json:"newlyPassing,omitempty"`
+	Record       interface{} `json:"record"`
+}
+
+// ReplayReport summarizes the impact of a rule change on previously submitted payloads
+type ReplayReport struct {
+	Tenant         string          `json:"tenant"` // ID of the tenant
+	FromVersion    int             `json:"fromVersion"`
+	ToVersion      int             `json:"toVersion"`
+	Total          int             `json:"total"`   // records replayed
+	Changed        int             `json:"changed"` // records whose outcome or violations changed
+	NewlyInvalid   int             `json:"newlyInvalid"`
+	NewlyValid     int             `json:"newlyValid"`
+	Skipped        int             `json:"skipped"`        // records of other tenants
+	Malformed      []ReplayError   `json:"malformed"`      // lines that could not be replayed, not counted in Total
+	ChangesByField map[string]int  `json:"changesByField"` // violations added or removed, by field with indexes collapsed
+	ChangesByRule  map[string]int  `json:"changesByRule"`  // violations added or removed, by rule
+	Examples       []ReplayExample `json:"examples,omitempty"`
+}
+
+// ReplayError is a line of a replay corpus that could not be replayed
+type ReplayError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// replayLine is a line of a replay corpus. It is either a bare POCUser payload or a payload envelope
+// ({"tenant": "ig", "entityType": "Application", "entityID": "app-1", "payload": {...}}) whose tenant is
+// an ID, an alias or a key. Audit records hold no payload and can not be replayed.
+type replayLine struct {
+	Tenant         json.RawMessage `json:"tenant"`
+	EntityType     string          `json:"entityType"`
+	EntityID       string          `json:"entityID"`
+	Payload        json.RawMessage `json:"payload"`
+	RuleSetVersion string          `json:"ruleSetVersion"`
+}
+
+// tenantKey returns the key of the tenant of the line, ok is false when the line has no tenant
+func (l replayLine) tenantKey(vp *POCDefaultValidationProvider) (key int, ok bool, err error) {
+	if len(l.Tenant) == 0 || string(l.Tenant) == "null" {
+		return 0, false, nil
+	}
+	var ref interface{}
+	if err := json.Unmarshal(l.Tenant, &ref); err != nil {
+		return 0, false, err
+	}
+	switch ref := ref.(type) {
+	case string:
+		key, err = vp.tenantKey(ref)
+	case float64:
+		key, err = vp.tenantKey(strconv.FormatFloat(ref, 'f', -1, 64))
+	default:
+		err = fmt.Errorf("tenant %s is neither an ID nor a key", l.Tenant)
+	}
+	return key, err == nil, err
+}
+
+// ReplayTenantRules re-validates the NDJSON payloads read from r against two versions of the tenant rules
+// and reports the records changing outcome. Version 0 stands for the empty tenant rules.
+// Payloads are users unless their envelope names a registered entity type. Lines that cannot be replayed
+// are reported as malformed and do not stop the replay.
+func (vp *POCDefaultValidationProvider) ReplayTenantRules(ctx context.Context, tenant string, from, to int, r io.Reader, opts ReplayOptions) (*ReplayReport, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return nil, err
+	}
+	fromRules, err := vp.tenantRuleSetAt(tenantID, from)
+	if err != nil {
+		return nil, err
+	}
+	toRules, err := vp.tenantRuleSetAt(tenantID, to)
+	if err != nil {
+		return nil, err
+	}
+	fromExpressions, err := compileExpressionRules(fromRules.expressions)
+	if err != nil {
+		return nil, err
+	}
+	toExpressions, err := compileExpressionRules(toRules.expressions)
+	if err != nil {
+		return nil, err
+	}
+	fromExpressions, toExpressions = vp.inheritExpressionRules(tenantID, fromExpressions), vp.inheritExpressionRules(tenantID, toExpressions)
+	if opts.MaxExamples == 0 {
+		opts.MaxExamples = DefaultReplayMaxExamples
+	}
+
+	report := &ReplayReport{
+		Tenant:         vp.tenantIDOf(tenantID),
+		FromVersion:    from,
+		ToVersion:      to,
+		Malformed:      make([]ReplayError, 0),
+		ChangesByField: make(map[string]int),
+		ChangesByRule:  make(map[string]int),
+	}
+	ctx = context.WithValue(ctx, "tenant", tenantID)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		envelope, entity, err := vp.replayRecord(scanner.Bytes())
+		if err != nil {
+			report.Malformed = append(report.Malformed, ReplayError{Line: line, Error: err.Error()})
+			continue
+		}
+		key, ok, err := envelope.tenantKey(vp)
+		switch {
+		case err != nil:
+			report.Malformed = append(report.Malformed, ReplayError{Line: line, Error: err.Error()})
+			continue
+		case ok && key != tenantID:
+			report.Skipped++
+			continue
+		}
+
+		report.Total++
+		fromErr := vp.replayValidate(ctx, tenantID, fromRules, fromExpressions, entity)
+		toErr := vp.replayValidate(ctx, tenantID, toRules, toExpressions, entity)
+		newlyFailing, newlyPassing := diffViolations(vp.RedactionPolicy().Violations(fromErr), vp.RedactionPolicy().Violations(toErr))
+		fromOutcome, toOutcome := validationOutcome(fromErr), validationOutcome(toErr)
+		if fromOutcome == toOutcome && len(newlyFailing) == 0 && len(newlyPassing) == 0 {
+			continue
+		}
+
+		report.Changed++
+		switch {
+		case fromOutcome == outcomeValid && toOutcome == outcomeInvalid:
+			report.NewlyInvalid++
+		case fromOutcome == outcomeInvalid && toOutcome == outcomeValid:
+			report.NewlyValid++
+		}
+		for _, v := range append(append([]Violation{}, newlyFailing...), newlyPassing...) {
+			report.ChangesByField[collapseIndexes(v.Namespace)]++
+			report.ChangesByRule[v.Rule]++
+		}
+		if len(report.Examples) < opts.MaxExamples {
+			report.Examples = append(report.Examples, ReplayExample{
+				Line:         line,
+				EntityID:     envelope.EntityID,
+				FromOutcome:  fromOutcome,
+				ToOutcome:    toOutcome,
+				NewlyFailing: newlyFailing,
+				NewlyPassing: newlyPassing,
+				Record:       vp.RedactionPolicy().Redact(reflect.TypeOf(entity).Name(), entity),
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// replayRecord decodes a line of a replay corpus and its payload
+func (vp *POCDefaultValidationProvider) replayRecord(b []byte) (replayLine, interface{}, error) {
+	var envelope replayLine
+	if err := json.Unmarshal(b, &envelope); err != nil {
+		return envelope, nil, err
+	}
+	payload := json.RawMessage(b)
+	switch {
+	case len(envelope.RuleSetVersion) > 0 && len(envelope.Payload) == 0:
+		return envelope, nil, errors.New("audit records hold no payload, replay payloads or payload envelopes")
+	case len(envelope.Payload) > 0:
+		payload = envelope.Payload
+	}
+	t := reflect.TypeOf(POCUser{})
+	if len(envelope.EntityType) > 0 && envelope.EntityType != t.Name() {
+		var ok bool
+		if t, ok = vp.registeredEntity(envelope.EntityType); !ok {
+			return envelope, nil, fmt.Errorf("%s: %w", envelope.EntityType, ErrUnregisteredEntity)
+		}
+	}
+	entity := reflect.New(t)
+	if err := json.Unmarshal(payload, entity.Interface()); err != nil {
+		return envelope, nil, err
+	}
+	return envelope, entity.Elem().Interface(), nil
+}
+
+// replayValidate validates a replayed entity with a rule set of the tenant
+func (vp *POCDefaultValidationProvider) replayValidate(ctx context.Context, tenantID int, set ruleSet, expressions []compiledExpressionRule, entity interface{}) error {
+	if user, ok := entity.(POCUser); ok {
+		return vp.validateUserRules(ctx, "replay", tenantID, vp.composeUserRules(tenantID, set, vp.asOf(ctx, user)), expressions, user)
+	}
+	entities := set.entities
+	if entities == nil {
+		entities = map[string]map[string]string{}
+	}
+	return vp.validateEntityRules(ctx, tenantID, entities, entity)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayTenantRules(t *testing.T) {
+	t.Setenv("VALIDATION_REDACTION_KEY", string(testRedactionKey))
+	dir := t.TempDir()
+	rulesPath := filepath.Join(dir, "rules.json")
+	vp := newTestProvider()
+	assert.NoError(t, vp.SetRuleStore(NewFileRuleStore(rulesPath)))
+	v1, err := vp.UpdateTenantRules("2", 0, "alice", map[string]string{"Phone": "required"})
+	assert.NoError(t, err)
+	v2, err := vp.UpdateTenantRules("2", v1, "bob", map[string]string{"FirstName": "max=3"})
+	assert.NoError(t, err)
+
+	short := provideValidUser()
+	long := provideValidUser()
+	long.FirstName = "Samantha"
+	noPhone := provideValidUser()
+	noPhone.Phone = ""
+	var corpus strings.Builder
+	for _, line := range []interface{}{
+		short,
+		map[string]interface{}{"tenant": "2", "entityID": "app-2", "payload": long},
+		map[string]interface{}{"tenant": 1, "entityID": "app-3", "payload": long},
+		AuditRecord{Tenant: "2", EntityID: "app-4", RuleSetVersion: "abc", Outcome: outcomeValid},
+		noPhone,
+	} {
+		b, err := json.Marshal(line)
+		assert.NoError(t, err)
+		corpus.Write(append(b, '\n'))
+	}
+	corpus.WriteString("{\"tenant\": 2, \"payload\": {\"Addresses\": 3}}\n{not json\n")
+
+	report, err := vp.ReplayTenantRules(context.Background(), "2", v1, v2, strings.NewReader(corpus.String()), ReplayOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Total)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, 2, report.Changed)
+	assert.Equal(t, []int{4, 6, 7}, []int{report.Malformed[0].Line, report.Malformed[1].Line, report.Malformed[2].Line})
+	assert.Contains(t, report.Malformed[0].Error, "audit records hold no payload")
+	assert.Equal(t, 1, report.NewlyInvalid)
+	assert.Equal(t, 1, report.NewlyValid)
+	assert.Equal(t, map[string]int{"POCUser.FirstName": 1, "POCUser.Phone": 1}, report.ChangesByField)
+	assert.Equal(t, map[string]int{"max": 1, "required": 1}, report.ChangesByRule)
+	assert.Len(t, report.Examples, 2)
+	assert.Equal(t, "app-2", report.Examples[0].EntityID)
+	assert.Equal(t, "max", report.Examples[0].NewlyFailing[0].Rule)
+	assertNoPII(t, []string{long.Email, long.Phone}, report)
+
+	_, err = vp.ReplayTenantRules(context.Background(), "2", v1, 42, strings.NewReader(""), ReplayOptions{})
+	assert.ErrorIs(t, err, ErrUnknownRuleVersion)
+
+	input := filepath.Join(dir, "payloads.ndjson")
+	assert.NoError(t, os.WriteFile(input, []byte(corpus.String()), 0o600))
+	var out strings.Builder
+	assert.NoError(t, runCommand("replay", []string{"-rules", rulesPath, "-input", input, "-tenant", "2", "-from", "1", "-to", "2"}, &out))
+	assert.Contains(t, out.String(), "replayed 3, changed 2 (newly invalid 1, newly valid 1), skipped 1, malformed 3")
+	assert.Contains(t, out.String(), "now fails POCUser.FirstName on max")
+	assert.NotContains(t, out.String(), long.Email)
+}
+
+func TestReplayEntityRules(t *testing.T) {
+	vp := newTestProvider()
+	assert.NoError(t, Register[Address](vp, EntityRules{Rules: map[string]string{"ZipCode": "required"}}, nil))
+	v1, err := vp.UpdateTenantRules("2", 0, "alice", map[string]string{"Phone": "required"})
+	assert.NoError(t, err)
+	assert.NoError(t, vp.SetTenantEntityRules("2", Address{}, EntityRules{Rules: map[string]string{"Province": "len=2"}}))
+	_, v2, err := vp.TenantRules("2")
+	assert.NoError(t, err)
+	history, err := vp.TenantRuleHistory("2")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]string{"Address": {"Province": "len=2"}}, history[1].Entities)
+
+	var corpus strings.Builder
+	for _, line := range []interface{}{
+		map[string]interface{}{"entityType": "Address", "payload": Address{Province: "Quebec", ZipCode: "H0H"}},
+		map[string]interface{}{"entityType": "Address", "payload": Address{Province: "QC", ZipCode: "H0H"}},
+		map[string]interface{}{"entityType": "Account", "payload": map[string]string{}},
+	} {
+		b, err := json.Marshal(line)
+		assert.NoError(t, err)
+		corpus.Write(append(b, '\n'))
+	}
+	report, err := vp.ReplayTenantRules(context.Background(), "2", v1, v2, strings.NewReader(corpus.String()), ReplayOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Total)
+	assert.Equal(t, 1, report.NewlyInvalid)
+	assert.Equal(t, map[string]int{"Address.Province": 1}, report.ChangesByField)
+	assert.Len(t, report.Malformed, 1)
+	assert.Contains(t, report.Malformed[0].Error, ErrUnregisteredEntity.Error())
+
+	_, err = vp.RollbackTenantRules("2", v2, v1, "bob")
+	assert.NoError(t, err)
+	rules, err := vp.EffectiveEntityRules("2", Address{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"ZipCode": "required"}, rules)
+}
+
+func TestReplayDatedRules(t *testing.T) {
+	vp := newTestProvider()
+	v1, err := vp.UpdateTenantRules("2", 0, "alice", map[string]string{"Phone": "required"})
+	assert.NoError(t, err)
+	assert.NoError(t, vp.SetTenantDatedRules("2", "bob", []DatedRules{{Rules: map[string]string{"FirstName": "max=3"}}}))
+	_, v2, err := vp.TenantRules("2")
+	assert.NoError(t, err)
+	long := provideValidUser()
+	long.FirstName = "Samantha"
+	b, err := json.Marshal(long)
+	assert.NoError(t, err)
+
+	// the dated rules of each version apply, not the active ones
+	report, err := vp.ReplayTenantRules(context.Background(), "2", v1, v2, strings.NewReader(string(b)), ReplayOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.NewlyInvalid)
+	assert.Equal(t, map[string]int{"max": 1}, report.ChangesByRule)
+	report, err = vp.ReplayTenantRules(context.Background(), "2", v2, v1, strings.NewReader(string(b)), ReplayOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.NewlyValid)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// RuleBuilder builds the map rules of an entity type with fields selected by pointer instead of by name,
+// so that renaming a field breaks the build instead of silently disabling its rules:
+//
+//	Rules[POCUser]().Field(func(u *POCUser) any { return &u.FirstName }).Required().Max(10).Build()
+//
+// Errors are reported by Build, a rule added before selecting a field or a selector not returning
+// a pointer to a field of the entity fails it.
+type RuleBuilder[T any] struct {
+	rules map[string]string
+	field string
+	err   error
+}
+
+// Rules returns a builder of the map rules of T
+func Rules[T any]() *RuleBuilder[T] {
+	return &RuleBuilder[T]{rules: make(map[string]string)}
+}
+
+// Field selects the field the next rules apply to. selector must return a pointer to a field of the entity,
+// ex: func(u *POCUser) any { return &u.Email }. Only fields of T itself can be selected, map rules do not
+// apply to the fields of nested or embedded structs.
+func (b *RuleBuilder[T]) Field(selector func(*T) any) *RuleBuilder[T] {
+	if b.err != nil {
+		return b
+	}
+	field, err := selectField(selector)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.field = field.Name
+	return b
+}
+
+// Rule adds a validation tag to the selected field, ex: Rule("startswiths") or Rule("oneof=QC ON")
+func (b *RuleBuilder[T]) Rule(tag string) *RuleBuilder[T] {
+	if b.err != nil {
+		return b
+	}
+	if len(b.field) == 0 {
+		var zero T
+		b.err = fmt.Errorf("rule %q added to %T before selecting a field", tag, zero)
+		return b
+	}
+	appendRule(b.field, tag, b.rules)
+	return b
+}
+
+// Required adds the required rule to the selected field
+func (b *RuleBuilder[T]) Required() *RuleBuilder[T] {
+	return b.Rule("required")
+}
+
+// Omitempty skips the following rules of the selected field when it is empty
+func (b *RuleBuilder[T]) Omitempty() *RuleBuilder[T] {
+	return b.Rule("omitempty")
+}
+
+// Min adds the min rule to the selected field: the minimum value, length or number of items
+func (b *RuleBuilder[T]) Min(n int) *RuleBuilder[T] {
+	return b.Rule(fmt.Sprintf("min=%d", n))
+}
+
+// Max adds the max rule to the selected field: the maximum value, length or number of items
+func (b *RuleBuilder[T]) Max(n int) *RuleBuilder[T] {
+	return b.Rule(fmt.Sprintf("max=%d", n))
+}
+
+// Email adds the email rule to the selected field
+func (b *RuleBuilder[T]) Email() *RuleBuilder[T] {
+	return b.Rule("email")
+}
+
+// OneOf adds the oneof rule to the selected field, values cannot contain spaces
+func (b *RuleBuilder[T]) OneOf(values ...string) *RuleBuilder[T] {
+	return b.Rule("oneof=" + strings.Join(values, " "))
+}
+
+// Build returns the rule map go-playground expects, keyed by field name
+func (b *RuleBuilder[T]) Build() (map[string]string, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	rules := make(map[string]string, len(b.rules))
+	for field, rule := range b.rules {
+		rules[field] = rule
+	}
+	return rules, nil
+}
+
+// MustBuild returns the rule map like Build and panics if a selector or rule is invalid.
+// It is meant for rules declared in code, where an invalid selector is a programming error.
+func (b *RuleBuilder[T]) MustBuild() map[string]string {
+	rules, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
+
+// RegisterRules registers T like Register with rules built by builders, a nil tenant builder contributes no rules.
+// Registration fails if any builder has an invalid selector or rule.
+func RegisterRules[T any](vp *POCDefaultValidationProvider, defaults *RuleBuilder[T], tenantOverrides map[string]*RuleBuilder[T]) error {
+	defaultRules, err := defaults.Build()
+	if err != nil {
+		return err
+	}
+	tenants := make(map[string]EntityRules, len(tenantOverrides))
+	for tenant, b := range tenantOverrides {
+		if b == nil {
+			continue
+		}
+		rules, err := b.Build()
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+		tenants[tenant] = EntityRules{Rules: rules}
+	}
+	return Register[T](vp, EntityRules{Rules: defaultRules}, tenants)
+}
+
+// selectField returns the field of T a selector returns a pointer to, matched by address and type
+// on a zero T. Selectors dereferencing nil pointers of the zero value are reported as errors.
+func selectField[T any](selector func(*T) any) (field reflect.StructField, err error) {
+	entity := new(T)
+	structValue := reflect.ValueOf(entity).Elem()
+	if structValue.Kind() != reflect.Struct {
+		return field, fmt.Errorf("cannot select fields of %s: not a struct", structValue.Type())
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("selector of %s does not point at one of its fields: %v", structValue.Type().Name(), r)
+		}
+	}()
+	fieldValue := reflect.ValueOf(selector(entity))
+	if fieldValue.Kind() != reflect.Ptr || fieldValue.IsNil() {
+		return field, fmt.Errorf("selector of %s must return a pointer to a field, got %s", structValue.Type().Name(), fieldValue.Kind())
+	}
+	for i := 0; i < structValue.NumField(); i++ {
+		// fields sharing an address (ex: zero sized ones) are told apart by type
+		if fieldValue.Pointer() == structValue.Field(i).Addr().Pointer() && fieldValue.Elem().Type() == structValue.Field(i).Type() {
+			return structValue.Type().Field(i), nil
+		}
+	}
+	return field, fmt.Errorf("selector of %s does not point at one of its fields", structValue.Type().Name())
+}
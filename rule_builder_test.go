@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleBuilder(t *testing.T) {
+	rules, err := Rules[POCUser]().
+		Field(func(u *POCUser) any { return &u.FirstName }).Required().Max(10).
+		Field(func(u *POCUser) any { return &u.Age }).Min(18).
+		Field(func(u *POCUser) any { return &u.Account }).Required().
+		Field(func(u *POCUser) any { return &u.FirstName }).Rule("startswiths").
+		Build()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"FirstName": "required,max=10,startswiths", "Age": "min=18", "Account": "required"}, rules)
+	assert.Equal(t, map[string]string{"FirstName": "max=10", "Age": "min=18", "Email": "required,email"}, ComposeDefaultUserRules())
+
+	// selectors must point at a field of the entity itself
+	for name, selector := range map[string]func(u *POCUser) any{
+		"value":          func(u *POCUser) any { return u.FirstName },
+		"entity":         func(u *POCUser) any { return u },
+		"local variable": func(u *POCUser) any { s := u.Email; return &s },
+		"embedded field": func(u *POCUser) any { return &u.LastName },
+		"nil pointer":    func(u *POCUser) any { return &u.Account.ID },
+		"nil":            func(u *POCUser) any { return nil },
+	} {
+		_, err := Rules[POCUser]().Field(selector).Required().Build()
+		assert.Error(t, err, name)
+	}
+	_, err = Rules[POCUser]().Required().Build()
+	assert.Error(t, err)
+	_, err = Rules[string]().Field(func(s *string) any { return s }).Build()
+	assert.Error(t, err)
+	assert.Panics(t, func() { Rules[POCUser]().Field(func(u *POCUser) any { return nil }).MustBuild() })
+}
+
+func TestRegisterRules(t *testing.T) {
+	vp := newTestProvider()
+	assert.Error(t, RegisterRules[Address](vp, Rules[Address]().Field(func(a *Address) any { return nil }).Required(), nil))
+	assert.NoError(t, RegisterRules[Address](vp,
+		Rules[Address]().Field(func(a *Address) any { return &a.ZipCode }).Required(),
+		map[string]*RuleBuilder[Address]{"2": Rules[Address]().Field(func(a *Address) any { return &a.Province }).OneOf("QC", "ON")}))
+
+	ctx := context.WithValue(context.Background(), "tenant", 2)
+	assert.Equal(t, []string{"ZipCode:required", "Province:oneof"}, fieldFailures(vp.Validate(ctx, Address{Province: "Quebec"})))
+}
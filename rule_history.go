@@ -0,0 +1,298 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ErrUnknownRuleVersion is returned when a tenant has no rules version with the requested number
+var ErrUnknownRuleVersion = errors.New("unknown rules version")
+
+// RuleVersion is an immutable version of the rules of a tenant
+type RuleVersion struct {
+	Number    int               `json:"number"`
+	Hash      string            `json:"hash"` // content hash of the rules, equal rules have equal hashes
+	Author    string            `json:"author,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+	Comment   string            `json:"comment,omitempty"`
+	Rules     map[string]string `json:"rules"`
+	Dated     []DatedRules      `json:"dated,omitempty"`
+	// map rules set by the tenant on registered entities, by entity type name
+	Entities    map[string]map[string]string `json:"entities,omitempty"`
+	Expressions []ExpressionRule             `json:"expressions,omitempty"`
+	// struct level functions set by the tenant on registered entities, not persisted:
+	// nil for versions loaded from the rule store
+	structLevels map[string]validator.StructLevelFunc
+}
+
+// RuleChange is the change of the rule of a field between two versions, From or To is empty when the rule was
+// added or removed
+type RuleChange struct {
+	Field string `json:"field"`
+	From  string `json:"from,omitempty"`
+	To    string `json:"to,omitempty"`
+}
+
+func newRuleVersion(number int, set ruleSet, author, comment string) RuleVersion {
+	hash := contentHash(set.rules)
+	if len(set.dated) > 0 || len(set.entities) > 0 || len(set.expressions) > 0 {
+		hash = contentHash(StoredRules{Rules: set.rules, Dated: set.dated, Entities: set.entities, Expressions: set.expressions})
+	}
+	return RuleVersion{
+		Number:       number,
+		Hash:         hash,
+		Author:       author,
+		Timestamp:    time.Now().UTC(),
+		Comment:      comment,
+		Rules:        set.rules,
+		Dated:        set.dated,
+		Entities:     set.entities,
+		Expressions:  set.expressions,
+		structLevels: set.structLevels,
+	}
+}
+
+// contentHash returns a short hash of the JSON representation of v, maps are marshalled with sorted keys
+func contentHash(v interface{}) string {
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// TenantRuleHistory returns every accepted version of the rules of a tenant, oldest first
+func (vp *POCDefaultValidationProvider) TenantRuleHistory(tenant string) ([]RuleVersion, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return nil, err
+	}
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	history := make([]RuleVersion, len(vp.tenantRuleHistory[tenantID]))
+	for i, v := range vp.tenantRuleHistory[tenantID] {
+		history[i] = v.copy()
+	}
+	return history, nil
+}
+
+// copy returns a copy of the version and of its maps to hand out, without its struct level functions
+func (v RuleVersion) copy() RuleVersion {
+	v.Rules, v.Dated, v.Entities = copyRules(v.Rules), copyDatedRules(v.Dated), copyEntityRules(v.Entities)
+	v.Expressions = append([]ExpressionRule(nil), v.Expressions...)
+	v.structLevels = nil
+	return v
+}
+
+// tenantRuleVersion returns a version of the rules of a tenant, the caller must hold vp.mu
+func (vp *POCDefaultValidationProvider) tenantRuleVersion(tenantID, number int) (RuleVersion, error) {
+	for _, v := range vp.tenantRuleHistory[tenantID] {
+		if v.Number == number {
+			return v, nil
+		}
+	}
+	return RuleVersion{}, fmt.Errorf("tenant %s, version %d: %w", vp.tenantIDOf(tenantID), number, ErrUnknownRuleVersion)
+}
+
+// RuleSetDiff is the changes between two versions of the rules of a tenant, by kind of rules
+type RuleSetDiff struct {
+	Rules       []RuleChange            `json:"rules"`
+	Dated       []DatedRulesChange      `json:"dated,omitempty"`
+	Entities    map[string][]RuleChange `json:"entities,omitempty"` // by entity type name
+	Expressions []ExpressionRuleChange  `json:"expressions,omitempty"`
+}
+
+// DatedRulesChange is the rule changes of the dated rules in force for a period,
+// every rule of a period added or removed is added or removed
+type DatedRulesChange struct {
+	EffectiveFrom  time.Time    `json:"effectiveFrom"`
+	EffectiveUntil time.Time    `json:"effectiveUntil"`
+	Changes        []RuleChange `json:"changes"`
+}
+
+// ExpressionRuleChange is the change of the expression of a field and tag between two versions, From or To
+// is empty when the expression rule was added or removed
+type ExpressionRuleChange struct {
+	Field string `json:"field"`
+	Tag   string `json:"tag"`
+	From  string `json:"from,omitempty"`
+	To    string `json:"to,omitempty"`
+}
+
+// DiffTenantRules returns the changes between two versions of the rules of a tenant: its rules, dated rules,
+// rules on registered entities and expression rules. Version 0 stands for the empty rules in place before
+// the first version.
+func (vp *POCDefaultValidationProvider) DiffTenantRules(tenant string, from, to int) (RuleSetDiff, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return RuleSetDiff{}, err
+	}
+	fromSet, err := vp.tenantRuleSetAt(tenantID, from)
+	if err != nil {
+		return RuleSetDiff{}, err
+	}
+	toSet, err := vp.tenantRuleSetAt(tenantID, to)
+	if err != nil {
+		return RuleSetDiff{}, err
+	}
+	diff := RuleSetDiff{
+		Rules:       diffRules(fromSet.rules, toSet.rules),
+		Dated:       diffDatedRules(fromSet.dated, toSet.dated),
+		Expressions: diffExpressionRules(fromSet.expressions, toSet.expressions),
+	}
+	for name := range fromSet.entities {
+		if changes := diffRules(fromSet.entities[name], toSet.entities[name]); len(changes) > 0 {
+			if diff.Entities == nil {
+				diff.Entities = make(map[string][]RuleChange)
+			}
+			diff.Entities[name] = changes
+		}
+	}
+	for name := range toSet.entities {
+		if _, ok := fromSet.entities[name]; !ok {
+			if diff.Entities == nil {
+				diff.Entities = make(map[string][]RuleChange)
+			}
+			diff.Entities[name] = diffRules(nil, toSet.entities[name])
+		}
+	}
+	return diff, nil
+}
+
+// tenantRuleSetAt returns a copy of the rule set of a version of the tenant rules, version 0 being the empty rules
+func (vp *POCDefaultValidationProvider) tenantRuleSetAt(tenantID, number int) (ruleSet, error) {
+	if number == 0 {
+		return ruleSet{rules: map[string]string{}}, nil
+	}
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	version, err := vp.tenantRuleVersion(tenantID, number)
+	if err != nil {
+		return ruleSet{}, err
+	}
+	return version.ruleSet().copy(), nil
+}
+
+// ruleSet returns the rule set of the version, sharing its maps
+func (v RuleVersion) ruleSet() ruleSet {
+	return ruleSet{rules: v.Rules, dated: v.Dated, entities: v.Entities, expressions: v.Expressions, structLevels: v.structLevels}
+}
+
+// diffRules returns the rule changes between two rule maps, sorted by field
+func diffRules(from, to map[string]string) []RuleChange {
+	changes := make([]RuleChange, 0)
+	for field, rule := range from {
+		if to[field] != rule {
+			changes = append(changes, RuleChange{Field: field, From: rule, To: to[field]})
+		}
+	}
+	for field, rule := range to {
+		if _, ok := from[field]; !ok {
+			changes = append(changes, RuleChange{Field: field, To: rule})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+// diffDatedRules returns the rule changes of dated rules by period, sorted by period.
+// Dated rules of the same period are merged, the later ones replacing the rules of their fields.
+func diffDatedRules(from, to []DatedRules) []DatedRulesChange {
+	type period struct{ from, until time.Time }
+	byPeriod := func(dated []DatedRules) map[period]map[string]string {
+		rules := make(map[period]map[string]string, len(dated))
+		for _, d := range dated {
+			p := period{d.EffectiveFrom.UTC(), d.EffectiveUntil.UTC()}
+			if rules[p] == nil {
+				rules[p] = make(map[string]string, len(d.Rules))
+			}
+			for field, rule := range d.Rules {
+				rules[p][field] = rule
+			}
+		}
+		return rules
+	}
+	fromRules, toRules := byPeriod(from), byPeriod(to)
+	periods := make(map[period]bool, len(fromRules)+len(toRules))
+	for p := range fromRules {
+		periods[p] = true
+	}
+	for p := range toRules {
+		periods[p] = true
+	}
+	var changes []DatedRulesChange
+	for p := range periods {
+		if c := diffRules(fromRules[p], toRules[p]); len(c) > 0 {
+			changes = append(changes, DatedRulesChange{EffectiveFrom: p.from, EffectiveUntil: p.until, Changes: c})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if !changes[i].EffectiveFrom.Equal(changes[j].EffectiveFrom) {
+			return changes[i].EffectiveFrom.Before(changes[j].EffectiveFrom)
+		}
+		return changes[i].EffectiveUntil.Before(changes[j].EffectiveUntil)
+	})
+	return changes
+}
+
+// diffExpressionRules returns the changes of expression rules identified by field and tag, sorted by field and tag
+func diffExpressionRules(from, to []ExpressionRule) []ExpressionRuleChange {
+	key := func(r ExpressionRule) [2]string { return [2]string{r.Field, r.Tag} }
+	fromRules := make(map[[2]string]string, len(from))
+	for _, r := range from {
+		fromRules[key(r)] = r.Expression
+	}
+	toRules := make(map[[2]string]string, len(to))
+	for _, r := range to {
+		toRules[key(r)] = r.Expression
+	}
+	var changes []ExpressionRuleChange
+	for k, expression := range fromRules {
+		if toRules[k] != expression {
+			changes = append(changes, ExpressionRuleChange{Field: k[0], Tag: k[1], From: expression, To: toRules[k]})
+		}
+	}
+	for k, expression := range toRules {
+		if _, ok := fromRules[k]; !ok {
+			changes = append(changes, ExpressionRuleChange{Field: k[0], Tag: k[1], To: expression})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Field != changes[j].Field {
+			return changes[i].Field < changes[j].Field
+		}
+		return changes[i].Tag < changes[j].Tag
+	})
+	return changes
+}
+
+// RollbackTenantRules re-activates a previous version of the rules of a tenant as a new version.
+// Like UpdateTenantRules, it only succeeds if version is the current version of the tenant rules.
+func (vp *POCDefaultValidationProvider) RollbackTenantRules(tenant string, version, target int, author string) (int, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return 0, err
+	}
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	if vp.tenantRuleVersions[tenantID] != version {
+		return 0, ErrVersionConflict
+	}
+	previous, err := vp.tenantRuleVersion(tenantID, target)
+	if err != nil {
+		return 0, err
+	}
+	set := previous.ruleSet()
+	if set.structLevels == nil {
+		// struct level functions are not persisted, versions loaded from the rule store keep the active ones
+		set.structLevels = vp.tenantStructLevels[tenantID]
+	}
+	return vp.activateRules(tenantID, set, author, fmt.Sprintf("rollback to version %d", target))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantRuleHistory(t *testing.T) {
+	store := NewFileRuleStore(filepath.Join(t.TempDir(), "rules.json"))
+	vp := newTestProvider()
+	assert.NoError(t, vp.SetRuleStore(store))
+
+	v1, err := vp.UpdateTenantRules("2", 0, "alice", map[string]string{"FirstName": "max=5"})
+	assert.NoError(t, err)
+	v2, err := vp.UpdateTenantRules("2", v1, "bob", map[string]string{"FirstName": "max=8", "Phone": "e164"})
+	assert.NoError(t, err)
+	history, err := vp.TenantRuleHistory("2")
+	assert.NoError(t, err)
+
+	changes, err := vp.DiffTenantRules("2", v1, v2)
+	assert.NoError(t, err)
+	assert.Equal(t, RuleSetDiff{Rules: []RuleChange{{Field: "FirstName", From: "max=5", To: "max=8"}, {Field: "Phone", To: "e164"}}}, changes)
+	_, err = vp.DiffTenantRules("2", v1, 42)
+	assert.ErrorIs(t, err, ErrUnknownRuleVersion)
+
+	_, err = vp.RollbackTenantRules("2", v1, v1, "carol")
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	v3, err := vp.RollbackTenantRules("2", v2, v1, "carol")
+	assert.NoError(t, err)
+	rules, version, err := vp.TenantRules("2")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, version)
+	assert.Equal(t, map[string]string{"FirstName": "max=5"}, rules)
+
+	versions, err := vp.TenantRuleHistory("2")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 3)
+	assert.Equal(t, history, versions[:2]) // previous versions are immutable
+	assert.Equal(t, versions[0].Hash, versions[2].Hash)
+	assert.NotEqual(t, versions[0].Hash, versions[1].Hash)
+	assert.Equal(t, "carol", versions[2].Author)
+	assert.Equal(t, "rollback to version 1", versions[2].Comment)
+	assert.Equal(t, v3, versions[2].Number)
+
+	// modifying returned or rolled back rules leaves the history untouched
+	versions[0].Rules["FirstName"] = "max=1"
+	rules["FirstName"] = "max=2"
+	versions, err = vp.TenantRuleHistory("2")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"FirstName": "max=5"}, versions[0].Rules)
+	assert.Equal(t, map[string]string{"FirstName": "max=5"}, versions[2].Rules)
+
+	// history is persisted
+	reloaded := newTestProvider()
+	assert.NoError(t, reloaded.SetRuleStore(store))
+	reloadedVersions, err := reloaded.TenantRuleHistory("2")
+	assert.NoError(t, err)
+	assert.Equal(t, versions, reloadedVersions)
+}
+
+func TestAdminRuleHistory(t *testing.T) {
+	vp := newTestProvider()
+	h := NewAdminHandler(vp, "secret")
+	adminRequest(t, h, http.MethodPut, "/tenants/1/rules", `"0"`, `{"FirstName":"max=5"}`)
+	adminRequest(t, h, http.MethodPut, "/tenants/1/rules", `"1"`, `{"FirstName":"max=6"}`)
+
+	w := adminRequest(t, h, http.MethodGet, "/tenants/1/versions/diff?from=1&to=2", "", "")
+	assert.JSONEq(t, `{"rules":[{"field":"FirstName","from":"max=5","to":"max=6"}]}`, w.Body.String())
+
+	w = adminRequest(t, h, http.MethodPost, "/tenants/1/versions/9/rollback", `"2"`, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = adminRequest(t, h, http.MethodPost, "/tenants/1/versions/1/rollback", `"2"`, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"version":3,"rules":{"FirstName":"max=5"}}`, w.Body.String())
+
+	w = adminRequest(t, h, http.MethodGet, "/tenants/1/versions", "", "")
+	var versions []RuleVersion
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &versions))
+	assert.Len(t, versions, 3)
+	assert.Equal(t, "admin", versions[2].Author)
+}
+
+func TestDiffTenantRuleSet(t *testing.T) {
+	vp := newTestProvider()
+	assert.NoError(t, Register[Address](vp, EntityRules{}, nil))
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	v1, err := vp.UpdateTenantRules("2", 0, "alice", map[string]string{"Phone": "required"})
+	assert.NoError(t, err)
+	assert.NoError(t, vp.SetTenantDatedRules("2", "bob", []DatedRules{{EffectiveFrom: from, Rules: map[string]string{"FirstName": "max=3"}}}))
+	assert.NoError(t, vp.SetTenantEntityRules("2", Address{}, EntityRules{Rules: map[string]string{"Province": "len=2"}}))
+	_, version, err := vp.TenantRules("2")
+	assert.NoError(t, err)
+	_, err = vp.UpdateTenantExpressionRules("2", version, "carol", []ExpressionRule{{Field: "Age", Expression: "Age >= 21"}})
+	assert.NoError(t, err)
+	_, version, err = vp.TenantRules("2")
+	assert.NoError(t, err)
+
+	// versions only changing dated, entity or expression rules differ
+	changes, err := vp.DiffTenantRules("2", v1, version)
+	assert.NoError(t, err)
+	assert.Equal(t, RuleSetDiff{
+		Rules:       []RuleChange{},
+		Dated:       []DatedRulesChange{{EffectiveFrom: from, Changes: []RuleChange{{Field: "FirstName", To: "max=3"}}}},
+		Entities:    map[string][]RuleChange{"Address": {{Field: "Province", To: "len=2"}}},
+		Expressions: []ExpressionRuleChange{{Field: "Age", Tag: "expr", To: "Age >= 21"}},
+	}, changes)
+	changes, err = vp.DiffTenantRules("2", version, v1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Age >= 21", changes.Expressions[0].From)
+	assert.Equal(t, "len=2", changes.Entities["Address"][0].From)
+}
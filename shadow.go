@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// shadowRuleSet is a candidate rule set evaluated alongside the active rules of a tenant
+type shadowRuleSet struct {
+	rules      map[string]string
+	hash       string
+	sampleRate float64
+}
+
+// ShadowDiff is the difference between the active and candidate results of a validation.
+// Violations are redacted.
+type ShadowDiff struct {
+	Tenant           string      `json:"tenant"` // ID of the tenant
+	EntityType       string      `json:"entityType"`
+	EntityID         string      `json:"entityID,omitempty"`
+	CandidateHash    string      `json:"candidateHash"`
+	Timestamp        time.Time   `json:"timestamp"`
+	ActiveOutcome    string      `json:"activeOutcome"`
+	CandidateOutcome string      `json:"candidateOutcome"`
+	NewlyFailing     []Violation `json:"newlyFailing,omitempty"` // violations only raised by the candidate rules
+	NewlyPassing     []Violation `json:"newlyPassing,omitempty"` // violations only raised by the active rules
+}
+
+// ShadowStats counts the validations evaluated against the candidate rules of a tenant
+type ShadowStats struct {
+	Evaluated int `json:"evaluated"`
+	Differing int `json:"differing"`
+}
+
+// ShadowSink records the differences found between active and candidate rules
+type ShadowSink interface {
+	Record(ctx context.Context, diff ShadowDiff) error
+}
+
+// MemoryShadowSink keeps shadow differences in memory, meant for tests
+type MemoryShadowSink struct {
+	mu    sync.Mutex
+	diffs []ShadowDiff
+}
+
+// NewMemoryShadowSink returns an empty MemoryShadowSink
+func NewMemoryShadowSink() *MemoryShadowSink {
+	return &MemoryShadowSink{}
+}
+
+func (s *MemoryShadowSink) Record(_ context.Context, diff ShadowDiff) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.diffs = append(s.diffs, diff)
+	return nil
+}
+
+// Diffs returns the recorded differences, oldest first
+func (s *MemoryShadowSink) Diffs() []ShadowDiff {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ShadowDiff{}, s.diffs...)
+}
+
+// JSONLinesShadowSink writes shadow differences as JSON lines, one difference per line
+type JSONLinesShadowSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLinesShadowSink returns a JSONLinesShadowSink writing to w
+func NewJSONLinesShadowSink(w io.Writer) *JSONLinesShadowSink {
+	return &JSONLinesShadowSink{w: w}
+}
+
+func (s *JSONLinesShadowSink) Record(_ context.Context, diff ShadowDiff) error {
+	line, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// SetShadowSink sets the sink the differences found by shadow evaluation are recorded to
+func (vp *POCDefaultValidationProvider) SetShadowSink(sink ShadowSink) {
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	vp.shadowSink = sink
+}
+
+// SetTenantShadowRules sets candidate rules evaluated alongside the tenant rules, on a sampleRate share (0 to 1)
+// of the validations done with rules. Callers only ever get the result of the active rules,
+// differences are recorded to the shadow sink. Candidate rules replace the tenant rules and are linted like them.
+func (vp *POCDefaultValidationProvider) SetTenantShadowRules(tenant string, rules map[string]string, sampleRate float64) error {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return err
+	}
+	if sampleRate < 0 || sampleRate > 1 {
+		return fmt.Errorf("sample rate %v is not between 0 and 1", sampleRate)
+	}
+	// callers may keep changing their map
+	rules = copyRules(rules)
+	if err := vp.lintTenantRules(tenantID, rules); err != nil {
+		return err
+	}
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	vp.tenantShadows[tenantID] = &shadowRuleSet{rules: rules, hash: contentHash(rules), sampleRate: sampleRate}
+	vp.shadowStats[tenantID] = ShadowStats{}
+	return nil
+}
+
+// ClearTenantShadowRules stops evaluating candidate rules for a tenant
+func (vp *POCDefaultValidationProvider) ClearTenantShadowRules(tenant string) error {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return err
+	}
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	delete(vp.tenantShadows, tenantID)
+	return nil
+}
+
+// TenantShadowStats returns the shadow evaluation counters of a tenant since its candidate rules were set
+func (vp *POCDefaultValidationProvider) TenantShadowStats(tenant string) (ShadowStats, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return ShadowStats{}, err
+	}
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	return vp.shadowStats[tenantID], nil
+}
+
+// shadowUserRules evaluates the candidate rules of the tenant, when sampled, and records how their result
+// differs from the active result. Shadow evaluation never changes the result returned to the caller.
+func (vp *POCDefaultValidationProvider) shadowUserRules(ctx context.Context, tenantID int, asOf time.Time, user POCUser, active error) {
+	vp.mu.RLock()
+	shadow, sink := vp.tenantShadows[tenantID], vp.shadowSink
+	vp.mu.RUnlock()
+	if shadow == nil || sink == nil || rand.Float64() >= shadow.sampleRate {
+		return
+	}
+
+	own := vp.activeRuleSet(tenantID)
+	own.rules = shadow.rules
+	candidate := vp.validateUserRules(ctx, "shadow", tenantID, vp.composeUserRules(tenantID, own, asOf), vp.expressionRulesOf(tenantID), user)
+	newlyFailing, newlyPassing := diffViolations(vp.RedactionPolicy().Violations(active), vp.RedactionPolicy().Violations(candidate))
+	activeOutcome, candidateOutcome := validationOutcome(active), validationOutcome(candidate)
+	differing := activeOutcome != candidateOutcome || len(newlyFailing) > 0 || len(newlyPassing) > 0
+
+	vp.mu.Lock()
+	stats := vp.shadowStats[tenantID]
+	stats.Evaluated++
+	if differing {
+		stats.Differing++
+	}
+	vp.shadowStats[tenantID] = stats
+	vp.mu.Unlock()
+	if !differing {
+		return
+	}
+
+	entityID, _ := ctx.Value("entityID").(string)
+	// a failing sink must not affect callers, the difference is only lost
+	_ = sink.Record(ctx, ShadowDiff{
+		Tenant:           vp.tenantIDOf(tenantID),
+		EntityType:       "POCUser",
+		EntityID:         entityID,
+		CandidateHash:    shadow.hash,
+		Timestamp:        vp.now().UTC(),
+		ActiveOutcome:    activeOutcome,
+		CandidateOutcome: candidateOutcome,
+		NewlyFailing:     newlyFailing,
+		NewlyPassing:     newlyPassing,
+	})
+}
+
+// diffViolations returns the candidate violations not raised by the active rules and the opposite,
+// violations are matched by namespace and rule
+func diffViolations(active, candidate []Violation) (newlyFailing, newlyPassing []Violation) {
+	key := func(v Violation) string { return v.Namespace + "|" + v.Rule }
+	activeKeys := make(map[string]bool, len(active))
+	for _, v := range active {
+		activeKeys[key(v)] = true
+	}
+	candidateKeys := make(map[string]bool, len(candidate))
+	for _, v := range candidate {
+		candidateKeys[key(v)] = true
+		if !activeKeys[key(v)] {
+			newlyFailing = append(newlyFailing, v)
+		}
+	}
+	for _, v := range active {
+		if !candidateKeys[key(v)] {
+			newlyPassing = append(newlyPassing, v)
+		}
+	}
+	return newlyFailing, newlyPassing
+}
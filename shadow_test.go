@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShadowRules(t *testing.T) {
+	vp := newTestProvider()
+	sink := NewMemoryShadowSink()
+	vp.SetShadowSink(sink)
+	vp.SetTenantRules("2", map[string]string{"Phone": "required"})
+	assert.NoError(t, vp.SetTenantShadowRules("2", map[string]string{"FirstName": "max=2", "Email": "endswith=@corp.com"}, 1))
+	ctx := context.WithValue(context.WithValue(context.Background(), "tenant", 2), "entityID", "app-1")
+
+	user := provideValidUser()
+	user.Phone = ""
+	err := vp.ValidateUserWithRulesValidation(ctx, user)
+	// callers only get the active result
+	assert.Equal(t, []string{"Phone:required"}, fieldFailures(err))
+
+	diffs := sink.Diffs()
+	assert.Len(t, diffs, 1)
+	assert.Equal(t, "app-1", diffs[0].EntityID)
+	assert.Equal(t, outcomeInvalid, diffs[0].ActiveOutcome)
+	assert.Equal(t, outcomeInvalid, diffs[0].CandidateOutcome)
+	var failing []string
+	for _, v := range diffs[0].NewlyFailing {
+		failing = append(failing, v.Field+":"+v.Rule)
+	}
+	assert.ElementsMatch(t, []string{"FirstName:max", "Email:endswith"}, failing)
+	assert.Len(t, diffs[0].NewlyPassing, 1)
+	assert.Equal(t, "required", diffs[0].NewlyPassing[0].Rule)
+	assertNoPII(t, []string{user.Email}, diffs)
+
+	// same result with both rule sets: counted, not recorded, changes to the caller map are not seen
+	candidate := map[string]string{"Phone": "required,e164"}
+	assert.NoError(t, vp.SetTenantShadowRules("2", candidate, 1))
+	candidate["FirstName"] = "max=2"
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(ctx, provideValidUser()))
+	assert.Len(t, sink.Diffs(), 1)
+	stats, err := vp.TenantShadowStats("2")
+	assert.NoError(t, err)
+	assert.Equal(t, ShadowStats{Evaluated: 1}, stats)
+
+	// nothing sampled
+	assert.NoError(t, vp.SetTenantShadowRules("2", map[string]string{"FirstName": "max=2"}, 0))
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(ctx, provideValidUser()))
+	stats, err = vp.TenantShadowStats("2")
+	assert.NoError(t, err)
+	assert.Equal(t, ShadowStats{}, stats)
+
+	assert.Error(t, vp.SetTenantShadowRules("2", map[string]string{"FirstName": "max=2"}, 1.5))
+	assert.Error(t, vp.SetTenantShadowRules("2", map[string]string{"FirstName": "unknowntag"}, 1))
+}
+
+func TestJSONLinesShadowSink(t *testing.T) {
+	var b bytes.Buffer
+	sink := NewJSONLinesShadowSink(&b)
+	assert.NoError(t, sink.Record(context.Background(), ShadowDiff{Tenant: "1", ActiveOutcome: outcomeValid, CandidateOutcome: outcomeInvalid}))
+	assert.Contains(t, b.String(), `"candidateOutcome":"invalid"`)
+	assert.True(t, bytes.HasSuffix(b.Bytes(), []byte("\n")))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// StructReporter reports struct level violations at precise paths below the validated struct,
+// ex: r.Field("Addresses").Index(2).Field("Province").Report("isprovincename", "")
+// reports POCUser.Addresses[2].Province with the value found at that path.
+// In debug mode a path not matching the struct panics instead of being reported as is.
+type StructReporter struct {
+	sl    validator.StructLevel
+	debug bool
+}
+
+// NewStructReporter returns a StructReporter for the struct level being validated
+func NewStructReporter(sl validator.StructLevel, debug bool) *StructReporter {
+	return &StructReporter{sl: sl, debug: debug}
+}
+
+// ReportPath is a path below the validated struct violations are reported at
+type ReportPath struct {
+	r     *StructReporter
+	path  string
+	value reflect.Value
+	err   error // why the path does not match the struct
+}
+
+// Field returns the path of a field of the validated struct
+func (r *StructReporter) Field(name string) ReportPath {
+	return ReportPath{r: r, value: r.sl.Current()}.Field(name)
+}
+
+// Field returns the path of a field of the struct at p
+func (p ReportPath) Field(name string) ReportPath {
+	if len(p.path) > 0 {
+		p.path += "."
+	}
+	p.path += name
+	if p.err != nil {
+		return p
+	}
+	v := reflect.Indirect(p.value)
+	if v.Kind() != reflect.Struct {
+		p.err = fmt.Errorf("%s: %s is not a struct", p.path, v.Kind())
+		return p
+	}
+	p.value = v.FieldByName(name)
+	if !p.value.IsValid() {
+		p.err = fmt.Errorf("%s: %s has no field %s", p.path, v.Type().Name(), name)
+	}
+	return p
+}
+
+// Index returns the path of an item of the slice or array at p
+func (p ReportPath) Index(i int) ReportPath {
+	p.path += fmt.Sprintf("[%d]", i)
+	if p.err != nil {
+		return p
+	}
+	v := reflect.Indirect(p.value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		p.err = fmt.Errorf("%s: %s is not a slice", p.path, v.Kind())
+		return p
+	}
+	if i < 0 || i >= v.Len() {
+		p.err = fmt.Errorf("%s: index out of range [0, %d)", p.path, v.Len())
+		return p
+	}
+	p.value = v.Index(i)
+	return p
+}
+
+// Key returns the path of an entry of the map at p
+func (p ReportPath) Key(key interface{}) ReportPath {
+	p.path += fmt.Sprintf("[%v]", key)
+	if p.err != nil {
+		return p
+	}
+	v := reflect.Indirect(p.value)
+	if v.Kind() != reflect.Map {
+		p.err = fmt.Errorf("%s: %s is not a map", p.path, v.Kind())
+		return p
+	}
+	k := reflect.ValueOf(key)
+	if !k.IsValid() || !k.Type().ConvertibleTo(v.Type().Key()) {
+		p.err = fmt.Errorf("%s: %T is not a key of %s", p.path, key, v.Type())
+		return p
+	}
+	p.value = v.MapIndex(k.Convert(v.Type().Key()))
+	if !p.value.IsValid() {
+		p.err = fmt.Errorf("%s: no such key", p.path)
+	}
+	return p
+}
+
+// Report reports a violation of a rule at p, with the value found there
+func (p ReportPath) Report(tag, param string) {
+	if p.err != nil && p.r.debug {
+		panic(fmt.Errorf("invalid report path %s", p.err))
+	}
+	var value interface{}
+	if p.err == nil && p.value.CanInterface() {
+		value = p.value.Interface()
+	}
+	// the namespace of the error is the namespace of the struct followed by the path
+	p.r.sl.ReportError(value, p.path, p.path, tag, param)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+type reportedApplication struct {
+	Applicants map[int]*reportedApplicant
+}
+
+type reportedApplicant struct {
+	Address Address
+}
+
+func TestStructReporterPaths(t *testing.T) {
+	vp := newTestProvider()
+	user := provideValidUser()
+	user.Addresses = append(user.Addresses, &Address{ZipCode: "H2X1Y4", Province: "Quebec"}, &Address{Province: "Ontario"})
+
+	ctx := context.WithValue(context.Background(), "tenant", 2)
+	err := vp.ValidateUserWithStructValidation(ctx, user)
+	namespaces := make(map[string]interface{})
+	for _, fe := range err.(ValidationErrors) {
+		namespaces[fe.StructNamespace()] = fe.Value()
+	}
+	assert.Equal(t, map[string]interface{}{
+		"POCUser.Addresses[0].Province": "Quebec",
+		"POCUser.Addresses[1].Province": "Quebec",
+		"POCUser.Addresses[2].Province": "Ontario",
+		"POCUser.Addresses[2].ZipCode":  "",
+	}, namespaces)
+	assert.Equal(t, "/Addresses/2/ZipCode", JSONPointers(err)["POCUser.Addresses[2].ZipCode"])
+}
+
+func TestStructReporterDebug(t *testing.T) {
+	report := func(debug bool, path func(r *StructReporter) ReportPath) error {
+		validate := validator.New()
+		validate.RegisterStructValidation(func(sl validator.StructLevel) {
+			path(NewStructReporter(sl, debug)).Report("required", "")
+		}, reportedApplication{})
+		return validate.Struct(reportedApplication{Applicants: map[int]*reportedApplicant{123456: {}}})
+	}
+	valid := func(r *StructReporter) ReportPath {
+		return r.Field("Applicants").Key(123456).Field("Address").Field("ZipCode")
+	}
+	err := report(true, valid)
+	assert.Equal(t, "reportedApplication.Applicants[123456].Address.ZipCode", err.(validator.ValidationErrors)[0].Namespace())
+	assert.Equal(t, "", err.(validator.ValidationErrors)[0].Value())
+
+	for name, path := range map[string]func(r *StructReporter) ReportPath{
+		"unknown field": func(r *StructReporter) ReportPath { return r.Field("Applicants").Key(123456).Field("PostalCode") },
+		"unknown key":   func(r *StructReporter) ReportPath { return r.Field("Applicants").Key(1).Field("Address") },
+		"key type":      func(r *StructReporter) ReportPath { return r.Field("Applicants").Key("a").Field("Address") },
+		"not a slice":   func(r *StructReporter) ReportPath { return r.Field("Applicants").Index(0) },
+		"not a struct":  func(r *StructReporter) ReportPath { return r.Field("Applicants").Field("Address") },
+	} {
+		assert.Panics(t, func() { _ = report(true, path) }, name)
+		// reported as is outside of debug mode
+		assert.Error(t, report(false, path), name)
+	}
+}
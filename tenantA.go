@@ -1,6 +1,8 @@
 package main
 
 import (
+	"strings"
+
 	"github.com/go-playground/validator/v10"
 )
 
@@ -14,10 +16,15 @@ func NewTenantAUserValidator() *TenantAUserValidator {
 
 // UserValidation sets struct validation only required for Tenant A
 func (v *TenantAUserValidator) UserValidation(sl validator.StructLevel) {
+	v.UserValidationWithReporter(sl, NewStructReporter(sl, false))
+}
+
+// UserValidationWithReporter sets struct validation only required for Tenant A, reporting provinces at their index
+func (v *TenantAUserValidator) UserValidationWithReporter(sl validator.StructLevel, r *StructReporter) {
 	user := sl.Current().Interface().(POCUser)
 
 	// Name has to start with "S"
-	if user.FirstName[0:1] != "S" {
+	if !strings.HasPrefix(user.FirstName, "S") {
 		sl.ReportError(user.FirstName, "first name", "FirstName", "namestartswiths", "")
 	}
 
@@ -28,19 +35,17 @@ func (v *TenantAUserValidator) UserValidation(sl validator.StructLevel) {
 	}
 
 	// Address province is province name
-	addresses := user.Addresses
-	for _, a := range addresses {
-		sl.Validator().RegisterValidation("isprovincename", isProvinceName)
+	for i, a := range user.Addresses {
 		err = sl.Validator().Var(a.Province, "isprovincename")
 		if err != nil {
-			sl.ReportError(addresses, "province", "Province", "isprovincename", "")
+			r.Field("Addresses").Index(i).Field("Province").Report("isprovincename", "")
 		}
 	}
 }
 
 func (v *TenantAUserValidator) UserValidationRules() map[string]string {
-	userRules := make(map[string]string)
-	appendRule("FirstName", "startswiths", userRules)
-	appendRule("Phone", "e164", userRules)
-	return userRules
+	return Rules[POCUser]().
+		Field(func(u *POCUser) any { return &u.FirstName }).Rule("startswiths").
+		Field(func(u *POCUser) any { return &u.Phone }).Rule("e164").
+		MustBuild()
 }
@@ -11,6 +11,11 @@ func NewTenantBUserValidator() *TenantBUserValidator {
 
 // UserValidation sets struct validation only required for Tenant A
 func (v *TenantBUserValidator) UserValidation(sl validator.StructLevel) {
+	v.UserValidationWithReporter(sl, NewStructReporter(sl, false))
+}
+
+// UserValidationWithReporter sets struct validation only required for Tenant B, reporting provinces at their index
+func (v *TenantBUserValidator) UserValidationWithReporter(sl validator.StructLevel, r *StructReporter) {
 	user := sl.Current().Interface().(POCUser)
 
 	// Maximum age is 40
@@ -19,12 +24,10 @@ func (v *TenantBUserValidator) UserValidation(sl validator.StructLevel) {
 	}
 
 	// Address province is province name
-	addresses := user.Addresses
-	for _, a := range addresses {
-		sl.Validator().RegisterValidation("isprovincecode", isProvinceCode)
+	for i, a := range user.Addresses {
 		err := sl.Validator().Var(a.Province, "isprovincecode")
 		if err != nil {
-			sl.ReportError(a, "province", "Province", "isprovincecode", "")
+			r.Field("Addresses").Index(i).Field("Province").Report("isprovincecode", "")
 		}
 	}
 }
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ErrVersionConflict is returned when tenant rules are updated from a version that is no longer the current one
+var ErrVersionConflict = errors.New("tenant rules were modified concurrently")
+
+// RuleLintError lists the problems found in tenant rules
+type RuleLintError struct {
+	Problems []string
+}
+
+func (e *RuleLintError) Error() string {
+	return fmt.Sprintf("invalid rules: %s", strings.Join(e.Problems, "; "))
+}
+
+// StoredRules are the rules of a tenant as persisted, with the history of every accepted version
+type StoredRules struct {
+	Version int               `json:"version"`
+	Rules   map[string]string `json:"rules"`
+	Dated   []DatedRules      `json:"dated,omitempty"`
+	// map rules set by the tenant on registered entities, by entity type name
+	Entities    map[string]map[string]string `json:"entities,omitempty"`
+	Expressions []ExpressionRule             `json:"expressions,omitempty"`
+	History     []RuleVersion                `json:"history,omitempty"`
+}
+
+// ruleSet is the definition of the rules of a tenant, versioned as a whole
+type ruleSet struct {
+	rules       map[string]string
+	dated       []DatedRules
+	entities    map[string]map[string]string
+	expressions []ExpressionRule
+	// struct level functions set by the tenant on registered entities, by type name, nil when not known
+	structLevels map[string]validator.StructLevelFunc
+}
+
+// copy returns a copy of the rule set and of its maps
+func (s ruleSet) copy() ruleSet {
+	return ruleSet{
+		rules:        copyRules(s.rules),
+		dated:        copyDatedRules(s.dated),
+		entities:     copyEntityRules(s.entities),
+		expressions:  append([]ExpressionRule(nil), s.expressions...),
+		structLevels: copyStructLevels(s.structLevels),
+	}
+}
+
+// copyStructLevels returns a copy of struct level functions by type name, nil when nil
+func copyStructLevels(structLevels map[string]validator.StructLevelFunc) map[string]validator.StructLevelFunc {
+	if structLevels == nil {
+		return nil
+	}
+	copied := make(map[string]validator.StructLevelFunc, len(structLevels))
+	for name, f := range structLevels {
+		copied[name] = f
+	}
+	return copied
+}
+
+// ruleSetOf returns the active rule set of a tenant, the caller must hold vp.mu
+func (vp *POCDefaultValidationProvider) ruleSetOf(tenantID int) ruleSet {
+	set := ruleSet{
+		rules:        vp.tenantRules[tenantID],
+		dated:        vp.tenantDatedRules[tenantID],
+		entities:     vp.tenantEntityRules[tenantID],
+		structLevels: vp.tenantStructLevels[tenantID],
+	}
+	for _, e := range vp.tenantExpressions[tenantID] {
+		set.expressions = append(set.expressions, e.ExpressionRule)
+	}
+	return set
+}
+
+// RuleStore persists tenant rules by tenant ID
+type RuleStore interface {
+	Load() (map[string]StoredRules, error)
+	Save(tenant string, rules StoredRules) error
+}
+
+// FileRuleStore persists the rules of every tenant in a single JSON file
+type FileRuleStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileRuleStore returns a FileRuleStore backed by the given file, created on first save
+func NewFileRuleStore(path string) *FileRuleStore {
+	return &FileRuleStore{path: path}
+}
+
+func (s *FileRuleStore) Load() (map[string]StoredRules, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *FileRuleStore) load() (map[string]StoredRules, error) {
+	stored := make(map[string]StoredRules)
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return stored, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, fmt.Errorf("reading rule store %s: %w", s.path, err)
+	}
+	return stored, nil
+}
+
+// Save rewrites the file with the rules of the tenant, the file is replaced atomically
+func (s *FileRuleStore) Save(tenant string, rules StoredRules) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, err := s.load()
+	if err != nil {
+		return err
+	}
+	stored[tenant] = rules
+	b, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// SetRuleStore sets the store tenant rules are persisted to and loads the rules it holds.
+// With a tenant registry, it must be set after the registry and every stored tenant must be registered.
+func (vp *POCDefaultValidationProvider) SetRuleStore(store RuleStore) error {
+	stored, err := store.Load()
+	if err != nil {
+		return err
+	}
+	byKey := make(map[int]StoredRules, len(stored))
+	expressions := make(map[int][]compiledExpressionRule, len(stored))
+	for tenant, s := range stored {
+		key, err := vp.configuredTenantKey(tenant)
+		if err != nil {
+			return fmt.Errorf("rule store: %w", err)
+		}
+		if expressions[key], err = compileExpressionRules(s.Expressions); err != nil {
+			return fmt.Errorf("rule store, tenant %s: %w", tenant, err)
+		}
+		byKey[key] = s
+	}
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	vp.ruleStore = store
+	for tenantID, s := range byKey {
+		vp.tenantRules[tenantID] = s.Rules
+		vp.tenantDatedRules[tenantID] = s.Dated
+		vp.tenantEntityRules[tenantID] = s.Entities
+		vp.tenantExpressions[tenantID] = expressions[tenantID]
+		vp.tenantRuleVersions[tenantID] = s.Version
+		vp.tenantRuleHistory[tenantID] = s.History
+	}
+	return nil
+}
+
+// TenantRules returns a copy of the rules set for a tenant and their version
+func (vp *POCDefaultValidationProvider) TenantRules(tenant string) (map[string]string, int, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return nil, 0, err
+	}
+	rules, version := vp.tenantRulesOf(tenantID)
+	return rules, version, nil
+}
+
+// tenantRulesOf returns a copy of the rules set for a tenant key and their version
+func (vp *POCDefaultValidationProvider) tenantRulesOf(tenantID int) (map[string]string, int) {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	return copyRules(vp.tenantRules[tenantID]), vp.tenantRuleVersions[tenantID]
+}
+
+// copyEntityRules returns a copy of the entity rules of a tenant and of their rule maps
+func copyEntityRules(entities map[string]map[string]string) map[string]map[string]string {
+	if len(entities) == 0 {
+		return nil
+	}
+	copied := make(map[string]map[string]string, len(entities))
+	for name, rules := range entities {
+		copied[name] = copyRules(rules)
+	}
+	return copied
+}
+
+// copyRules returns a copy of map rules, never nil
+func copyRules(rules map[string]string) map[string]string {
+	copied := make(map[string]string, len(rules))
+	for field, rule := range rules {
+		copied[field] = rule
+	}
+	return copied
+}
+
+// Tenants returns the IDs of the tenants having a validator or rules, or registered in the tenant registry
+func (vp *POCDefaultValidationProvider) Tenants() []string {
+	keys := vp.tenantKeys()
+	tenants := make([]string, len(keys))
+	for i, key := range keys {
+		tenants[i] = vp.tenantIDOf(key)
+	}
+	return tenants
+}
+
+// tenantKeys returns the sorted keys of the tenants having a validator or rules, or registered in the tenant registry
+func (vp *POCDefaultValidationProvider) tenantKeys() []int {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	seen := make(map[int]bool)
+	var tenants []int
+	for id := range vp.tenantValidators {
+		seen[id] = true
+		tenants = append(tenants, id)
+	}
+	for id := range vp.tenantRules {
+		if !seen[id] {
+			seen[id] = true
+			tenants = append(tenants, id)
+		}
+	}
+	if vp.tenants != nil {
+		for _, t := range vp.tenants.Tenants() {
+			if !seen[t.key] {
+				tenants = append(tenants, t.key)
+			}
+		}
+	}
+	sort.Ints(tenants)
+	return tenants
+}
+
+// LintTenantRules checks that every rule applies to an existing POCUser field and only uses tags known to the tenant
+func (vp *POCDefaultValidationProvider) LintTenantRules(tenant string, rules map[string]string) error {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return err
+	}
+	return vp.lintTenantRules(tenantID, rules)
+}
+
+// lintTenantRules lints the rules of a tenant key, see LintTenantRules
+func (vp *POCDefaultValidationProvider) lintTenantRules(tenantID int, rules map[string]string) error {
+	var problems []string
+	fields := make([]string, 0, len(rules))
+	for field := range rules {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		tag := rules[field]
+		f, ok := reflect.TypeOf(POCUser{}).FieldByName(field)
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s: unknown field", field))
+		case len(f.Index) > 1:
+			// map rules only apply to the fields declared by the struct itself
+			problems = append(problems, fmt.Sprintf("%s: field of an embedded struct", field))
+		case len(tag) == 0:
+			problems = append(problems, fmt.Sprintf("%s: empty rule", field))
+		default:
+			if err := vp.checkUserRule(tenantID, field, tag); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", field, err))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &RuleLintError{Problems: problems}
+	}
+	return nil
+}
+
+// checkUserRule applies a rule to an empty user, go-playground panics on unknown tags or tags not suited to the field
+func (vp *POCDefaultValidationProvider) checkUserRule(tenantID int, field, tag string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	validate, err := vp.validators.build(vp.tenantChain(tenantID), nil)
+	if err != nil {
+		return err
+	}
+	validate.RegisterStructValidationMapRules(map[string]string{field: tag}, POCUser{})
+	_ = validate.Struct(POCUser{})
+	return nil
+}
+
+// UpdateTenantRules lints and replaces the rules of a tenant, persisting them when a rule store is set.
+// The update only succeeds if version is the current version of the tenant rules, the new version is returned.
+func (vp *POCDefaultValidationProvider) UpdateTenantRules(tenant string, version int, author string, rules map[string]string) (int, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return 0, err
+	}
+	return vp.updateTenantRules(tenantID, version, author, rules)
+}
+
+// updateTenantRules lints and replaces the rules of a tenant key, see UpdateTenantRules
+func (vp *POCDefaultValidationProvider) updateTenantRules(tenantID, version int, author string, rules map[string]string) (int, error) {
+	if err := vp.lintTenantRules(tenantID, rules); err != nil {
+		return 0, err
+	}
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	if vp.tenantRuleVersions[tenantID] != version {
+		return 0, ErrVersionConflict
+	}
+	set := vp.ruleSetOf(tenantID)
+	set.rules = rules
+	return vp.activateRules(tenantID, set, author, "")
+}
+
+// activateRules records a new version of the rule set of a tenant, persists it when a rule store is set
+// and activates it. The caller must hold vp.mu.
+func (vp *POCDefaultValidationProvider) activateRules(tenantID int, set ruleSet, author, comment string) (int, error) {
+	expressions, err := compileExpressionRules(set.expressions)
+	if err != nil {
+		return 0, err
+	}
+	if set.structLevels == nil {
+		// versions record the struct level functions in force, even when there is none
+		set.structLevels = make(map[string]validator.StructLevelFunc)
+	}
+	// the version owns its maps, neither the caller nor the active rules can modify it
+	version := newRuleVersion(vp.tenantRuleVersions[tenantID]+1, set.copy(), author, comment)
+	set = set.copy()
+	// versions are immutable, the history is copied so slices handed out before are never modified
+	history := append(vp.tenantRuleHistory[tenantID][:len(vp.tenantRuleHistory[tenantID]):len(vp.tenantRuleHistory[tenantID])], version)
+	if vp.ruleStore != nil {
+		if err := vp.ruleStore.Save(vp.tenantIDOf(tenantID), StoredRules{
+			Version:     version.Number,
+			Rules:       set.rules,
+			Dated:       set.dated,
+			Entities:    set.entities,
+			Expressions: set.expressions,
+			History:     history,
+		}); err != nil {
+			return 0, err
+		}
+	}
+	vp.tenantRules[tenantID] = set.rules
+	vp.tenantDatedRules[tenantID] = set.dated
+	vp.tenantEntityRules[tenantID] = set.entities
+	vp.tenantExpressions[tenantID] = expressions
+	if len(set.structLevels) > 0 || len(vp.tenantStructLevels[tenantID]) > 0 {
+		// struct level functions are not part of the fingerprint of cached validators
+		vp.generation++
+	}
+	vp.tenantStructLevels[tenantID] = set.structLevels
+	vp.tenantRuleVersions[tenantID] = version.Number
+	vp.tenantRuleHistory[tenantID] = history
+	return version.Number, nil
+}
+
+// PatchTenantRules merges rules into the current rules of a tenant, an empty rule removes the field rule.
+// See UpdateTenantRules.
+func (vp *POCDefaultValidationProvider) PatchTenantRules(tenant string, version int, author string, patch map[string]string) (int, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return 0, err
+	}
+	rules, current := vp.tenantRulesOf(tenantID)
+	if current != version {
+		return 0, ErrVersionConflict
+	}
+	for field, tag := range patch {
+		if len(tag) == 0 {
+			delete(rules, field)
+		} else {
+			rules[field] = tag
+		}
+	}
+	return vp.updateTenantRules(tenantID, version, author, rules)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+var (
+	// ErrUnknownTenant is returned when validating for a tenant the registry does not know and the policy rejects it
+	ErrUnknownTenant = errors.New("unknown tenant")
+	// ErrTenantDisabled is returned when validating for a disabled tenant
+	ErrTenantDisabled = errors.New("tenant is disabled")
+)
+
+// Tenant describes a tenant of the provider
+type Tenant struct {
+	ID            string   // stable identifier, ex: nesto
+	Aliases       []string // other identifiers the tenant is looked up by
+	DisplayName   string
+	DefaultLocale string // locale of the messages when the context does not tell, DefaultLocale when empty
+	Country       string // ISO 3166 alpha-2 code, ex: CA
+	Parent        string // ID of the parent tenant, empty for none
+	Enabled       bool
+
+	key int // assigned at registration, validators, rules and metrics of the tenant are registered under it
+}
+
+// UnknownTenantMode is what is done when validating for a tenant the registry does not know
+type UnknownTenantMode int
+
+const (
+	// RejectUnknownTenants fails validations of unknown tenants with ErrUnknownTenant
+	RejectUnknownTenants UnknownTenantMode = iota
+	// DefaultRulesForUnknownTenants validates entities of unknown tenants with the default rules only
+	DefaultRulesForUnknownTenants
+	// FallbackForUnknownTenants validates entities of unknown tenants like the ones of a named tenant
+	FallbackForUnknownTenants
+)
+
+// UnknownTenantPolicy is the policy applied to tenants the registry does not know
+type UnknownTenantPolicy struct {
+	Mode     UnknownTenantMode
+	Fallback string // ID or alias of the tenant used by FallbackForUnknownTenants
+}
+
+// TenantRegistry holds the tenants of the provider, looked up by ID, alias or key
+type TenantRegistry struct {
+	mu      sync.RWMutex
+	tenants map[string]*Tenant // by ID and alias
+	byKey   map[int]*Tenant
+	policy  UnknownTenantPolicy
+}
+
+// NewTenantRegistry returns an empty TenantRegistry rejecting unknown tenants
+func NewTenantRegistry() *TenantRegistry {
+	return &TenantRegistry{tenants: make(map[string]*Tenant), byKey: make(map[int]*Tenant)}
+}
+
+// Register adds a tenant. IDs and aliases must be unique and the parent registered first.
+func (r *TenantRegistry) Register(t Tenant) error {
+	if len(t.ID) == 0 {
+		return errors.New("tenant ID is required")
+	}
+	if len(t.DefaultLocale) > 0 {
+		if _, ok := supportedLocale(t.DefaultLocale); !ok {
+			return fmt.Errorf("tenant %s: unsupported locale %q", t.ID, t.DefaultLocale)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(t.Parent) > 0 {
+		if _, ok := r.tenants[t.Parent]; !ok {
+			return fmt.Errorf("tenant %s: unknown parent %s", t.ID, t.Parent)
+		}
+	}
+	for _, name := range append([]string{t.ID}, t.Aliases...) {
+		if _, ok := r.tenants[name]; ok {
+			return fmt.Errorf("tenant %s: %s is already registered", t.ID, name)
+		}
+	}
+	t.Aliases = append([]string(nil), t.Aliases...)
+	// keys start after globalScope, reserved for declarations shared by all tenants
+	t.key = globalScope + len(r.byKey) + 1
+	tenant := &t
+	r.byKey[t.key] = tenant
+	for _, name := range append([]string{t.ID}, t.Aliases...) {
+		r.tenants[name] = tenant
+	}
+	return nil
+}
+
+// Lookup returns the tenant with the given ID or alias
+func (r *TenantRegistry) Lookup(idOrAlias string) (Tenant, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tenants[idOrAlias]
+	if !ok {
+		return Tenant{}, false
+	}
+	return *t, true
+}
+
+// byKeyOf returns the tenant registered under a key
+func (r *TenantRegistry) byKeyOf(key int) (Tenant, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.byKey[key]
+	if !ok {
+		return Tenant{}, false
+	}
+	return *t, true
+}
+
+// Tenants returns the registered tenants in registration order
+func (r *TenantRegistry) Tenants() []Tenant {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tenants := make([]Tenant, 0, len(r.byKey))
+	for _, t := range r.byKey {
+		tenants = append(tenants, *t)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].key < tenants[j].key })
+	return tenants
+}
+
+// SetUnknownTenantPolicy sets the policy applied to unknown tenants, the fallback tenant must be registered
+func (r *TenantRegistry) SetUnknownTenantPolicy(policy UnknownTenantPolicy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if policy.Mode == FallbackForUnknownTenants {
+		if _, ok := r.tenants[policy.Fallback]; !ok {
+			return fmt.Errorf("unknown fallback tenant %q", policy.Fallback)
+		}
+	}
+	r.policy = policy
+	return nil
+}
+
+// resolve returns the key of a tenant referenced by ID, alias or key, applying the unknown tenant policy.
+// The tenant is returned when registered, false for unknown tenants validated with the default rules.
+func (r *TenantRegistry) resolve(ref string) (int, Tenant, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tenants[ref]
+	if !ok {
+		if key, err := strconv.Atoi(ref); err == nil {
+			t, ok = r.byKey[key]
+		}
+	}
+	if !ok {
+		switch r.policy.Mode {
+		case DefaultRulesForUnknownTenants:
+			return globalScope, Tenant{}, false, nil
+		case FallbackForUnknownTenants:
+			t = r.tenants[r.policy.Fallback]
+		default:
+			return 0, Tenant{}, false, fmt.Errorf("%w %q", ErrUnknownTenant, ref)
+		}
+	}
+	if !t.Enabled {
+		return 0, Tenant{}, false, fmt.Errorf("%w: %s", ErrTenantDisabled, t.ID)
+	}
+	return t.key, *t, true, nil
+}
+
+// SetTenantRegistry sets the registry tenants of validations are resolved with.
+// Without registry tenants are referenced by number, ex: "1" or the int 1 as "tenant" context value,
+// and any number is accepted.
+func (vp *POCDefaultValidationProvider) SetTenantRegistry(r *TenantRegistry) {
+	vp.tenants = r
+}
+
+// TenantRegistry returns the registry tenants are resolved with, nil when not set
+func (vp *POCDefaultValidationProvider) TenantRegistry() *TenantRegistry {
+	return vp.tenants
+}
+
+// tenantKey returns the key of a tenant referenced by ID, alias or key, see TenantRegistry.resolve
+func (vp *POCDefaultValidationProvider) tenantKey(ref string) (int, error) {
+	if vp.tenants == nil {
+		key, err := strconv.Atoi(ref)
+		if err != nil {
+			return 0, fmt.Errorf("%w %q", ErrUnknownTenant, ref)
+		}
+		return key, nil
+	}
+	key, _, _, err := vp.tenants.resolve(ref)
+	return key, err
+}
+
+// configuredTenantKey returns the key of a tenant referenced by ID, alias or key in stored or configured data.
+// Unlike tenantKey, disabled tenants are found and unknown tenants are never resolved by the unknown tenant policy.
+func (vp *POCDefaultValidationProvider) configuredTenantKey(ref string) (int, error) {
+	if vp.tenants == nil {
+		return vp.tenantKey(ref)
+	}
+	if t, ok := vp.tenants.Lookup(ref); ok {
+		return t.key, nil
+	}
+	if key, err := strconv.Atoi(ref); err == nil {
+		if _, ok := vp.tenants.byKeyOf(key); ok {
+			return key, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q", ErrUnknownTenant, ref)
+}
+
+// tenantIDOf returns the ID a tenant is referenced by outside the provider: the ID of the tenant when registered,
+// its key otherwise. Keys are only used internally.
+func (vp *POCDefaultValidationProvider) tenantIDOf(key int) string {
+	if vp.tenants != nil {
+		if t, ok := vp.tenants.byKeyOf(key); ok {
+			return t.ID
+		}
+	}
+	return strconv.Itoa(key)
+}
+
+// tenantFromContext returns the key of the tenant of a validation context.
+// The "tenant" context value is the ID or alias of the tenant, or without registry its number.
+func (vp *POCDefaultValidationProvider) tenantFromContext(ctx context.Context) (int, error) {
+	switch ref := ctx.Value("tenant").(type) {
+	case int:
+		if vp.tenants == nil {
+			return ref, nil
+		}
+		return vp.tenantKey(strconv.Itoa(ref))
+	case string:
+		return vp.tenantKey(ref)
+	default:
+		return 0, ErrMissingTenant
+	}
+}
+
+// tenantLocale returns the default locale of a tenant, DefaultLocale when it has none
+func (vp *POCDefaultValidationProvider) tenantLocale(tenantID int) string {
+	if vp.tenants != nil {
+		if t, ok := vp.tenants.byKeyOf(tenantID); ok && len(t.DefaultLocale) > 0 {
+			locale, _ := supportedLocale(t.DefaultLocale)
+			return locale
+		}
+	}
+	return DefaultLocale
+}
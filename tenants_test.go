@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTenantRegistry(t *testing.T) *TenantRegistry {
+	tenants := NewTenantRegistry()
+	assert.NoError(t, tenants.Register(Tenant{ID: "nesto", DisplayName: "nesto", Country: "CA", Enabled: true}))
+	assert.NoError(t, tenants.Register(Tenant{ID: "ig", Aliases: []string{"ig-wealth"}, DefaultLocale: "fr-CA", Enabled: true}))
+	assert.NoError(t, tenants.Register(Tenant{ID: "legacy", Parent: "nesto"}))
+	return tenants
+}
+
+func TestTenantRegistry(t *testing.T) {
+	tenants := newTestTenantRegistry(t)
+	for _, invalid := range []Tenant{
+		{},
+		{ID: "nesto"},
+		{ID: "other", Aliases: []string{"ig-wealth"}},
+		{ID: "other", Parent: "unknown"},
+		{ID: "other", DefaultLocale: "de-DE"},
+	} {
+		assert.Error(t, tenants.Register(invalid), invalid.ID)
+	}
+
+	ig, ok := tenants.Lookup("ig-wealth")
+	assert.True(t, ok)
+	assert.Equal(t, "ig", ig.ID)
+	legacy, _ := tenants.byKeyOf(3)
+	assert.Equal(t, "nesto", legacy.Parent)
+	_, ok = tenants.Lookup("unknown")
+	assert.False(t, ok)
+	assert.Len(t, tenants.Tenants(), 3)
+
+	key, _, _, err := tenants.resolve("2")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, key)
+	_, _, _, err = tenants.resolve("legacy")
+	assert.ErrorIs(t, err, ErrTenantDisabled)
+	_, _, _, err = tenants.resolve("unknown")
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+
+	assert.Error(t, tenants.SetUnknownTenantPolicy(UnknownTenantPolicy{Mode: FallbackForUnknownTenants, Fallback: "unknown"}))
+	assert.NoError(t, tenants.SetUnknownTenantPolicy(UnknownTenantPolicy{Mode: FallbackForUnknownTenants, Fallback: "ig-wealth"}))
+	key, tenant, known, err := tenants.resolve("unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, key)
+	assert.Equal(t, "ig", tenant.ID)
+	assert.True(t, known)
+
+	assert.NoError(t, tenants.SetUnknownTenantPolicy(UnknownTenantPolicy{Mode: DefaultRulesForUnknownTenants}))
+	key, _, known, err = tenants.resolve("unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, globalScope, key)
+	assert.False(t, known)
+}
+
+func TestValidateRegisteredTenants(t *testing.T) {
+	vp := newTestProvider()
+	tenants := newTestTenantRegistry(t)
+	vp.SetTenantRegistry(tenants)
+	user := provideValidUser()
+	user.FirstName = "Pam"
+
+	// tenants are referenced by ID, alias or key, messages use their default locale
+	ctx := context.WithValue(context.Background(), "tenant", "nesto")
+	assert.Equal(t, []string{"FirstName:startswiths"}, fieldFailures(vp.ValidateUserWithRulesValidation(ctx, user)))
+	assert.Equal(t, map[string]string{"POCUser.Age": "Âge doit être égal à 18 ou plus"},
+		ErrorMessages(vp.Validate(context.WithValue(context.Background(), "tenant", "ig-wealth"), POCUser{Age: 10, Email: "a@b.ca"})))
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(context.WithValue(context.Background(), "tenant", 2), provideValidUser()))
+
+	ctx = context.WithValue(context.Background(), "tenant", "unknown")
+	assert.ErrorIs(t, vp.ValidateUserWithRulesValidation(ctx, user), ErrUnknownTenant)
+	assert.ErrorIs(t, vp.ValidateUserWithRulesValidation(context.WithValue(context.Background(), "tenant", 9), user), ErrUnknownTenant)
+	assert.ErrorIs(t, vp.ValidateUserWithStructValidation(context.WithValue(context.Background(), "tenant", "legacy"), user), ErrTenantDisabled)
+
+	// unknown tenants validated with the default rules only
+	assert.NoError(t, tenants.SetUnknownTenantPolicy(UnknownTenantPolicy{Mode: DefaultRulesForUnknownTenants}))
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(ctx, user))
+	assert.NoError(t, vp.ValidateUserWithStructValidation(ctx, user))
+	user.Age = 10
+	assert.Equal(t, []string{"Age:min"}, fieldFailures(vp.ValidateUserWithRulesValidation(ctx, user)))
+}
+
+func TestAdminRegisteredTenants(t *testing.T) {
+	vp := newTestProvider()
+	vp.SetTenantRegistry(newTestTenantRegistry(t))
+	h := NewAdminHandler(vp, "secret")
+	w := adminRequest(t, h, "GET", "/tenants", "", "")
+	assert.JSONEq(t, `[
+		{"id":"nesto","displayName":"nesto","enabled":true,"rulesVersion":0},
+		{"id":"ig","enabled":true,"rulesVersion":0},
+		{"id":"legacy","parent":"nesto","enabled":false,"rulesVersion":0}
+	]`, w.Body.String())
+	assert.Equal(t, 200, adminRequest(t, h, "GET", "/tenants/ig-wealth/rules", "", "").Code)
+	assert.Equal(t, 404, adminRequest(t, h, "GET", "/tenants/unknown/rules", "", "").Code)
+
+	// disabled tenants are managed, unknown ones are never resolved by the unknown tenant policy
+	w = adminRequest(t, h, "PUT", "/tenants/legacy/rules", `"0"`, `{"Phone":"required"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 409, adminRequest(t, h, "POST", "/tenants/legacy/validate", "", `{}`).Code)
+	for _, policy := range []UnknownTenantPolicy{{Mode: DefaultRulesForUnknownTenants}, {Mode: FallbackForUnknownTenants, Fallback: "ig"}} {
+		assert.NoError(t, vp.TenantRegistry().SetUnknownTenantPolicy(policy))
+		assert.Equal(t, 404, adminRequest(t, h, "PUT", "/tenants/nesot/rules", `"0"`, `{"Phone":"required"}`).Code)
+	}
+	rules, _, err := vp.TenantRules("ig")
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+	rules, _ = vp.tenantRulesOf(globalScope)
+	assert.Empty(t, rules)
+}
+
+func TestTenantIDsOutsideProvider(t *testing.T) {
+	t.Setenv("VALIDATION_REDACTION_KEY", string(testRedactionKey))
+	store := NewFileRuleStore(filepath.Join(t.TempDir(), "rules.json"))
+	vp := NewPOCDefaultValidationProvider()
+	vp.SetTenantRegistry(newTestTenantRegistry(t))
+	assert.NoError(t, vp.SetRuleStore(store))
+	sink := &MemoryAuditSink{}
+	vp.SetAuditSink(sink)
+	_, err := vp.UpdateTenantRules("legacy", 0, "ops", map[string]string{"Phone": "required"})
+	assert.NoError(t, err)
+	// tenants are referenced by ID or alias, never resolved by the unknown tenant policy
+	assert.ErrorIs(t, vp.SetTenantRules("nesot", map[string]string{"Phone": "required"}), ErrUnknownTenant)
+	_, err = vp.ValidateBatch(context.Background(), "nesot", nil, BatchOptions{})
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+	stored, err := store.Load()
+	assert.NoError(t, err)
+	assert.Contains(t, stored, "legacy")
+
+	// disabled tenants keep their rules, overlays and disabled rules
+	reloaded := NewPOCDefaultValidationProvider()
+	reloaded.SetTenantRegistry(newTestTenantRegistry(t))
+	assert.NoError(t, reloaded.SetRuleStore(store))
+	rules, _, err := reloaded.TenantRules("legacy")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Phone": "required"}, rules)
+	assert.NoError(t, vp.DisableRule(DisabledRule{Entity: "POCUser", Field: "Age", Tag: "min", Tenant: "ig-wealth"}, "", "ops"))
+	assert.Equal(t, "ig", vp.DisabledRules()[0].Tenant)
+	assert.NoError(t, vp.LoadOverlays(RuleOverlay{Name: "phones", Rules: map[string]map[string]string{"legacy": {"Phone": ""}}}))
+	assert.Error(t, vp.LoadOverlays(RuleOverlay{Name: "unknown", Rules: map[string]map[string]string{"unknown": {"Phone": ""}}}))
+
+	user := provideValidUser()
+	user.FirstName = "Samantha is too long"
+	assert.Error(t, vp.ValidateUserWithRulesValidation(context.WithValue(context.Background(), "tenant", "nesto"), user))
+	assert.Equal(t, "nesto", sink.Records()[0].Tenant)
+	var metrics strings.Builder
+	assert.NoError(t, vp.Metrics().WriteOpenMetrics(&metrics))
+	assert.Contains(t, metrics.String(), `tenant="nesto"`)
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -13,67 +16,489 @@ type POCValidator interface {
 	UserValidationRules() map[string]string
 }
 
+// ReportingValidator is a POCValidator reporting violations at precise paths with a StructReporter.
+// The provider calls UserValidationWithReporter instead of UserValidation when a tenant validator implements it.
+type ReportingValidator interface {
+	POCValidator
+	UserValidationWithReporter(sl validator.StructLevel, r *StructReporter)
+}
+
 // POCValidationProvider provides ways to validate fields.
 type POCValidationProvider interface {
 	ValidateUserWithStructValidation(ctx context.Context, user POCUser) error
 	ValidateUserWithRulesValidation(ctx context.Context, user POCUser) error
+	Validate(ctx context.Context, entity any) error
 }
 
 // POCDefaultValidationProvider is the default validation provider.
 // It has an embedded sanitizer that should be used to sanitize data before validation is executed.
 type POCDefaultValidationProvider struct {
 	tenantValidators   map[int]POCValidator // allows multi tenancy validation
+	mu                 sync.RWMutex         // guards tenant rules, overlays and the redaction policy, updated at runtime
 	tenantRules        map[int]map[string]string
+	tenantRuleVersions map[int]int
+	tenantRuleHistory  map[int][]RuleVersion
+	tenantDatedRules   map[int][]DatedRules                         // applied on top of tenant rules while in force
+	tenantEntityRules  map[int]map[string]map[string]string         // rules of tenants on registered entities, by type name
+	tenantStructLevels map[int]map[string]validator.StructLevelFunc // versioned like tenantEntityRules
+	tenantShadows      map[int]*shadowRuleSet                       // candidate rules evaluated alongside tenant rules
+	shadowStats        map[int]ShadowStats
+	shadowSink         ShadowSink
+	ruleStore          RuleStore // persists tenant rules when set
 	validationEntities map[string]map[string]string
+	entities           map[reflect.Type]*entityRegistration // entity types validated by Validate
+	validators         *ValidatorRegistry                   // custom validations declared at startup
+	validatorCache     *validatorCache                      // validators built for the tenants
+	generation         int                                  // changes with tenant validators and entity registrations, see validatorGeneration
+	tenantExpressions  map[int][]compiledExpressionRule
+	asyncValidators    map[int][]asyncRule // validators requiring I/O, run once synchronous rules pass
+	asyncCache         *asyncResultCache
+	metrics            *ValidationMetrics
+	redaction          *RedactionPolicy // PII redaction applied to the values of returned errors, keyed by ApplyConfig
+	audit              AuditSink        // records every validation decision when set
+	messages           *MessageCatalog  // end user messages of violations
+	fieldNames         *FieldNamer      // names fields from struct tags in errors
+	clock              func() time.Time // current time, time.Now when not set
+	asOfFunc           AsOfFunc         // time the rules applied to an entity are picked at, the clock when not set
+	asOfMaxAge         time.Duration    // as-of times found by asOfFunc are not older than this
+	debug              bool             // struct level report paths are checked against the struct
+	panicHook          PanicHook        // called for every panic recovered while validating
+	hooks              hookChain        // called around validations, nil when none
+	tenants            *TenantRegistry  // resolves the tenants of validations when set
+	environment        Environment      // production when not set
+	overlays           []RuleOverlay    // applied on top of tenant rules, loaded at startup
+	disabledRules      map[DisabledRule]*DisabledRuleState
+	disabledRuleHook   DisabledRuleHook // called for every violation of a disabled rule
+}
+
+// compiledExpressionRule is an ExpressionRule compiled against the entity it validates
+type compiledExpressionRule struct {
+	ExpressionRule
+	expression *Expression
 }
 
 // NewPOCDefaultValidationProvider returns a new POCDefaultValidationProvider
 func NewPOCDefaultValidationProvider() *POCDefaultValidationProvider {
-	return &POCDefaultValidationProvider{
+	messages, err := NewMessageCatalog()
+	if err != nil {
+		// the catalog is static, failing to build it is a programming error
+		panic(err)
+	}
+	vp := &POCDefaultValidationProvider{
 		tenantValidators:   make(map[int]POCValidator),
-		validationEntities: make(map[string]map[string]string),
+		tenantRules:        make(map[int]map[string]string),
+		tenantRuleVersions: make(map[int]int),
+		tenantRuleHistory:  make(map[int][]RuleVersion),
+		tenantDatedRules:   make(map[int][]DatedRules),
+		tenantEntityRules:  make(map[int]map[string]map[string]string),
+		tenantStructLevels: make(map[int]map[string]validator.StructLevelFunc),
+		tenantShadows:      make(map[int]*shadowRuleSet),
+		shadowStats:        make(map[int]ShadowStats),
+		validationEntities: ComposeEntityFieldsMap(POCUser{}),
+		entities:           make(map[reflect.Type]*entityRegistration),
+		validators:         NewValidatorRegistry(),
+		validatorCache:     newValidatorCache(),
+		tenantExpressions:  make(map[int][]compiledExpressionRule),
+		asyncValidators:    make(map[int][]asyncRule),
+		asyncCache:         newAsyncResultCache(time.Minute, DefaultAsyncCacheSize),
+		metrics:            NewValidationMetrics(),
+		redaction:          defaultRedactionPolicy(nil),
+		messages:           messages,
+		fieldNames:         NewFieldNamer(DefaultFieldNameTag),
+		disabledRules:      make(map[DisabledRule]*DisabledRuleState),
+	}
+	// test phones are accepted by environment overlays, see EnvironmentOverlays
+	if err := vp.validators.RegisterValidation("testphone", isTestPhone); err != nil {
+		panic(err)
 	}
+	return vp
+}
+
+// SetDebug checks the paths struct level validations report violations at against the validated struct,
+// a path not matching it panics. Meant for development and tests.
+func (vp *POCDefaultValidationProvider) SetDebug(debug bool) {
+	vp.debug = debug
+}
+
+// Metrics returns the validation metrics of the provider
+func (vp *POCDefaultValidationProvider) Metrics() *ValidationMetrics {
+	return vp.metrics
 }
 
-func (vp *POCDefaultValidationProvider) SetTenantValidator(tenantID int, validator POCValidator) {
+func (vp *POCDefaultValidationProvider) SetTenantValidator(tenant string, validator POCValidator) error {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return err
+	}
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
 	vp.tenantValidators[tenantID] = validator
+	vp.generation++
+	return nil
 }
 
-func (vp *POCDefaultValidationProvider) SetTenantRules(tenantID int, rules map[string]string) {
-	vp.tenantRules[tenantID] = rules
+// tenantValidator returns the validator set for a tenant
+func (vp *POCDefaultValidationProvider) tenantValidator(tenantID int) (POCValidator, bool) {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	v, ok := vp.tenantValidators[tenantID]
+	return v, ok
 }
 
-func (vp *POCDefaultValidationProvider) ValidateUserWithStructValidation(ctx context.Context, user POCUser) error {
-	// validation that is applied to all tenants
-	tenantID := ctx.Value("tenant").(int)
-	validate := validator.New()
-	// Register function to get tag name from json tags by default, then field names
-	// Register Struct Validation Pattern
-	validate.RegisterStructValidation(decorateStructValidation(vp.DefaultUserValidation, vp.tenantValidators[tenantID].UserValidation), POCUser{})
-	err := validate.Struct(user)
+// SetTenantRules sets the rules of a tenant, applied on top of the default and tenant validator rules.
+// Rules set this way are not linted and failing to persist them is ignored, see UpdateTenantRules.
+func (vp *POCDefaultValidationProvider) SetTenantRules(tenant string, rules map[string]string) error {
+	tenantID, err := vp.configuredTenantKey(tenant)
 	if err != nil {
-		test := err.(validator.ValidationErrors)
-		test = test
 		return err
 	}
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	set := vp.ruleSetOf(tenantID)
+	set.rules = rules
+	_, _ = vp.activateRules(tenantID, set, "", "")
 	return nil
 }
 
-func (vp *POCDefaultValidationProvider) ValidateUserWithRulesValidation(ctx context.Context, user POCUser) error {
+// EffectiveUserRules returns the rules applied now to a user of a tenant, see EffectiveUserRulesAt
+func (vp *POCDefaultValidationProvider) EffectiveUserRules(tenant string) (map[string]string, error) {
+	return vp.EffectiveUserRulesAt(tenant, vp.now())
+}
+
+// EffectiveUserRulesAt returns the rules applied to a user of a tenant at the given time: default, then
+// the validator, rules and dated rules in force of every tenant of the chain, ancestors first, then the
+// environment overlays. See UserRuleOrigins.
+func (vp *POCDefaultValidationProvider) EffectiveUserRulesAt(tenant string, asOf time.Time) (map[string]string, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return vp.effectiveUserRulesAt(tenantID, asOf), nil
+}
+
+// effectiveUserRulesAt returns the rules applied to a user of a tenant at the given time, see EffectiveUserRulesAt
+func (vp *POCDefaultValidationProvider) effectiveUserRulesAt(tenantID int, asOf time.Time) map[string]string {
+	vp.mu.RLock()
+	// active rules are replaced, never modified, they can be shared
+	own := vp.ruleSetOf(tenantID)
+	vp.mu.RUnlock()
+	return vp.composeUserRules(tenantID, own, asOf)
+}
+
+// composeUserRules returns the user rules of a tenant with the rules and dated rules of the given rule set
+// in place of its own, see userRuleLayers
+func (vp *POCDefaultValidationProvider) composeUserRules(tenantID int, own ruleSet, asOf time.Time) map[string]string {
+	return decorateLayers(vp.userRuleLayers(tenantID, own, asOf))
+}
+
+// UpdateTenantExpressionRules replaces the expression rules of a tenant, versioned with its other rules.
+// Every expression is compiled and type-checked against POCUser, nothing is set if any of them is invalid.
+// Like UpdateTenantRules, it only succeeds if version is the current version of the tenant rules.
+func (vp *POCDefaultValidationProvider) UpdateTenantExpressionRules(tenant string, version int, author string, rules []ExpressionRule) (int, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return 0, err
+	}
+	rules = append([]ExpressionRule(nil), rules...)
+	var problems []string
+	for i, r := range rules {
+		if len(r.Tag) == 0 {
+			rules[i].Tag = "expr"
+		}
+		if _, err := compileExpressionRule(r); err != nil {
+			problems = append(problems, fmt.Sprintf("expression %d: %v", i, err))
+		}
+	}
+	if len(problems) > 0 {
+		return 0, &RuleLintError{Problems: problems}
+	}
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	if vp.tenantRuleVersions[tenantID] != version {
+		return 0, ErrVersionConflict
+	}
+	set := vp.ruleSetOf(tenantID)
+	set.expressions = rules
+	return vp.activateRules(tenantID, set, author, "expression rules")
+}
+
+// TenantExpressionRules returns the expression rules of a tenant
+func (vp *POCDefaultValidationProvider) TenantExpressionRules(tenant string) ([]ExpressionRule, error) {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return vp.activeRuleSet(tenantID).expressions, nil
+}
+
+// activeRuleSet returns a copy of the active rule set of a tenant
+func (vp *POCDefaultValidationProvider) activeRuleSet(tenantID int) ruleSet {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	return vp.ruleSetOf(tenantID).copy()
+}
+
+// expressionRulesOf returns the compiled expression rules of a tenant and of its ancestors, see inheritExpressionRules
+func (vp *POCDefaultValidationProvider) expressionRulesOf(tenantID int) []compiledExpressionRule {
+	vp.mu.RLock()
+	own := vp.tenantExpressions[tenantID]
+	vp.mu.RUnlock()
+	return vp.inheritExpressionRules(tenantID, own)
+}
+
+// inheritExpressionRules returns the expression rules of the ancestors of a tenant, root first, then own as the
+// rules of the tenant itself. The rules of a tenant replace the ones of its ancestors with the same field and tag.
+func (vp *POCDefaultValidationProvider) inheritExpressionRules(tenantID int, own []compiledExpressionRule) []compiledExpressionRule {
+	chain := vp.tenantChain(tenantID)
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	var rules []compiledExpressionRule
+	for _, key := range chain {
+		scope := vp.tenantExpressions[key]
+		if key == tenantID {
+			scope = own
+		}
+		rules = inheritRules(rules, scope, func(r compiledExpressionRule) [2]string { return [2]string{r.Field, r.Tag} })
+	}
+	return rules
+}
+
+// inheritRules returns the inherited rules, without the ones replaced by the rules of a descendant, followed
+// by the rules of the descendant. Rules are replaced when they have the same identity, ex: field and tag.
+func inheritRules[R any, K comparable](inherited, descendant []R, identity func(R) K) []R {
+	replaced := make(map[K]bool, len(descendant))
+	for _, r := range descendant {
+		replaced[identity(r)] = true
+	}
+	rules := make([]R, 0, len(inherited)+len(descendant))
+	for _, r := range inherited {
+		if !replaced[identity(r)] {
+			rules = append(rules, r)
+		}
+	}
+	return append(rules, descendant...)
+}
+
+// compileExpressionRules compiles expression rules against POCUser
+func compileExpressionRules(rules []ExpressionRule) ([]compiledExpressionRule, error) {
+	compiled := make([]compiledExpressionRule, 0, len(rules))
+	for _, r := range rules {
+		c, err := compileExpressionRule(r)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// compileExpressionRule compiles an expression rule against POCUser, its field must exist
+func compileExpressionRule(r ExpressionRule) (compiledExpressionRule, error) {
+	if _, ok := reflect.TypeOf(POCUser{}).FieldByName(r.Field); !ok {
+		return compiledExpressionRule{}, fmt.Errorf("expression rule field %s does not exist on POCUser", r.Field)
+	}
+	expression, err := CompileExpression(r.Expression, POCUser{})
+	if err != nil {
+		return compiledExpressionRule{}, err
+	}
+	if len(r.Tag) == 0 {
+		r.Tag = "expr"
+	}
+	return compiledExpressionRule{ExpressionRule: r, expression: expression}, nil
+}
+
+// RegisterValidation declares a custom validation available to all tenants.
+// Custom validations must be registered at startup, before the first validation.
+func (vp *POCDefaultValidationProvider) RegisterValidation(tag string, fn validator.Func) error {
+	return vp.validators.RegisterValidation(tag, fn)
+}
+
+// RegisterTenantValidation declares a custom validation only available to the given tenant.
+// Custom validations must be registered at startup, before the first validation.
+func (vp *POCDefaultValidationProvider) RegisterTenantValidation(tenant string, tag string, fn validator.Func) error {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return err
+	}
+	return vp.validators.RegisterTenantValidation(tenantID, tag, fn)
+}
+
+// RegisterAlias declares an alias available to all tenants
+func (vp *POCDefaultValidationProvider) RegisterAlias(alias, tags string) error {
+	return vp.validators.RegisterAlias(alias, tags)
+}
+
+// RegisterTenantAlias declares an alias only available to the given tenant
+func (vp *POCDefaultValidationProvider) RegisterTenantAlias(tenant string, alias, tags string) error {
+	tenantID, err := vp.configuredTenantKey(tenant)
+	if err != nil {
+		return err
+	}
+	return vp.validators.RegisterTenantAlias(tenantID, alias, tags)
+}
+
+func (vp *POCDefaultValidationProvider) ValidateUserWithStructValidation(ctx context.Context, user POCUser) (err error) {
 	// validation that is applied to all tenants
-	tenantID := ctx.Value("tenant").(int)
-	validate := validator.New()
-	validate.RegisterValidation("startswiths", ValidateFieldStartsWithS)
-	//  RegisterStructValidationMapRules Pattern
-	userRules := DecorateRules(ComposeDefaultUserRules(), vp.tenantValidators[tenantID].UserValidationRules())
-	validate.RegisterStructValidationMapRules(userRules, POCUser{})
-	err := validate.Struct(user)
+	tenantID, err := vp.tenantFromContext(ctx)
 	if err != nil {
-		test := err.(validator.ValidationErrors)
-		test = test
 		return err
 	}
-	return nil
+	guard := vp.newPanicGuard(tenantID, user)
+	if len(vp.hooks) > 0 {
+		info := vp.validationInfo(ctx, tenantID, "POCUser")
+		ctx = vp.hooks.BeforeValidate(ctx, info)
+		defer vp.afterValidate(ctx, info, time.Now(), &err)
+		guard.withHooks(ctx, vp.hooks, info)
+	}
+	asOf := vp.asOf(ctx, user)
+	defer vp.metrics.observe(vp.tenantIDOf(tenantID), "POCUser", time.Now(), &err)
+	defer vp.recordAudit(ctx, tenantID, reflect.TypeOf(user), asOf, &err)
+	defer vp.redactErrors(&err)
+	defer vp.recoverValidation(ctx, guard, &err)
+	chain := vp.tenantChain(tenantID)
+	validate, err := vp.userStructValidate(tenantID, chain, vp.datedUserRulesAt(chain, asOf), guard)
+	if err != nil {
+		return err
+	}
+	defer vp.validatorCache.release(validate)
+	if err := validate.validate.StructCtx(ctx, &user); err != nil {
+		err = vp.describeErrors(ctx, tenantID, reflect.TypeOf(user), guard.convert(err))
+		if err = vp.suppressDisabledRules(ctx, tenantID, reflect.TypeOf(user), err); err != nil {
+			return err
+		}
+	}
+	err = vp.describeErrors(ctx, tenantID, reflect.TypeOf(user), vp.validateAsync(ctx, tenantID, user, guard))
+	return vp.suppressDisabledRules(ctx, tenantID, reflect.TypeOf(user), err)
+}
+
+// userStructValidate returns the validator of the users of a tenant running the default and tenant validator
+// struct level validations, tenants after the ancestors they inherit from, then the given dated rules and the
+// expression rules of the tenant, for the validation of a guard. It must be released once the validation is done.
+func (vp *POCDefaultValidationProvider) userStructValidate(tenantID int, chain []int, datedRules map[string]string, guard *panicGuard) (*cachedValidator, error) {
+	expressions := vp.expressionRulesOf(tenantID)
+	return vp.validatorCache.acquire("struct", chain, validatorFingerprint(vp.validatorGeneration(), datedRules, expressions), guard, func(slot *guardSlot) (*cachedValidator, error) {
+		validate, err := vp.newValidate(chain, slot)
+		if err != nil {
+			return nil, err
+		}
+		// Register Struct Validation Pattern, tenants run after the ancestors they inherit from
+		structValidations := []validator.StructLevelFunc{slot.structFunc("DefaultUserValidation", vp.DefaultUserValidation)}
+		for _, key := range chain {
+			if tenantValidator, ok := vp.tenantValidator(key); ok {
+				structValidations = append(structValidations, slot.structFunc(ruleName(tenantValidator, "UserValidation"), func(sl validator.StructLevel) {
+					if reporting, ok := tenantValidator.(ReportingValidator); ok {
+						reporting.UserValidationWithReporter(sl, NewStructReporter(sl, vp.debug))
+						return
+					}
+					tenantValidator.UserValidation(sl)
+				}))
+			}
+		}
+		structValidations = append(structValidations, vp.registeredUserStructLevel(chain, slot)...)
+		structValidation := decorateStructValidation(structValidations...)
+		if len(datedRules) > 0 {
+			validate.RegisterStructValidationMapRules(datedRules, POCUser{})
+		}
+		expressionValidation := slot.structFuncCtx("expr", expressionRulesValidation(expressions))
+		validate.RegisterStructValidationCtx(func(ctx context.Context, sl validator.StructLevel) {
+			structValidation(sl)
+			expressionValidation(ctx, sl)
+		}, POCUser{})
+		return &cachedValidator{validate: validate}, nil
+	})
+}
+
+func (vp *POCDefaultValidationProvider) ValidateUserWithRulesValidation(ctx context.Context, user POCUser) (err error) {
+	// validation that is applied to all tenants
+	tenantID, err := vp.tenantFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	guard := vp.newPanicGuard(tenantID, user)
+	if len(vp.hooks) > 0 {
+		info := vp.validationInfo(ctx, tenantID, "POCUser")
+		ctx = vp.hooks.BeforeValidate(ctx, info)
+		defer vp.afterValidate(ctx, info, time.Now(), &err)
+		guard.withHooks(ctx, vp.hooks, info)
+	}
+	asOf := vp.asOf(ctx, user)
+	defer vp.metrics.observe(vp.tenantIDOf(tenantID), "POCUser", time.Now(), &err)
+	defer vp.recordAudit(ctx, tenantID, reflect.TypeOf(user), asOf, &err)
+	defer vp.redactErrors(&err)
+	defer vp.recoverValidation(ctx, guard, &err)
+	userRules, stripped := withoutDisabledTags("POCUser", vp.effectiveUserRulesAt(tenantID, asOf), vp.disabledRulesOf(vp.tenantChain(tenantID)))
+	validate, err := vp.userRulesValidate("rules", tenantID, userRules, vp.expressionRulesOf(tenantID), guard)
+	if err != nil {
+		return err
+	}
+	defer vp.validatorCache.release(validate)
+	err = guard.convert(validate.validate.StructCtx(ctx, &user))
+	vp.evaluateStrippedTags(ctx, tenantID, guard, reflect.ValueOf(user), map[reflect.Type][]strippedTag{reflect.TypeOf(user): stripped})
+	vp.shadowUserRules(ctx, tenantID, asOf, user, err)
+	if err != nil {
+		err = vp.describeErrors(ctx, tenantID, reflect.TypeOf(user), err)
+		if err = vp.suppressDisabledRules(ctx, tenantID, reflect.TypeOf(user), err); err != nil {
+			return err
+		}
+	}
+	err = vp.describeErrors(ctx, tenantID, reflect.TypeOf(user), vp.validateAsync(ctx, tenantID, user, guard))
+	return vp.suppressDisabledRules(ctx, tenantID, reflect.TypeOf(user), err)
+}
+
+// userRulesValidate returns the validator of the users of a tenant applying the given map rules and expression rules,
+// for the validation of a guard. It must be released once the validation is done.
+// Validators are cached by purpose, ex: the shadow rules of a tenant are validated alongside its rules without
+// rebuilding either validator.
+func (vp *POCDefaultValidationProvider) userRulesValidate(purpose string, tenantID int, userRules map[string]string, expressions []compiledExpressionRule, guard *panicGuard) (*cachedValidator, error) {
+	chain := vp.tenantChain(tenantID)
+	return vp.validatorCache.acquire(purpose, chain, validatorFingerprint(vp.validatorGeneration(), userRules, expressions), guard, func(slot *guardSlot) (*cachedValidator, error) {
+		validate, err := vp.newValidate(chain, slot)
+		if err != nil {
+			return nil, err
+		}
+		//  RegisterStructValidationMapRules Pattern
+		validate.RegisterStructValidationMapRules(userRules, POCUser{})
+		structValidation := decorateStructValidation(vp.registeredUserStructLevel(chain, slot)...)
+		expressionValidation := slot.structFuncCtx("expr", expressionRulesValidation(expressions))
+		validate.RegisterStructValidationCtx(func(ctx context.Context, sl validator.StructLevel) {
+			structValidation(sl)
+			expressionValidation(ctx, sl)
+		}, POCUser{})
+		return &cachedValidator{validate: validate}, nil
+	})
+}
+
+// validatorGeneration returns the generation of the tenant validators and entity registrations,
+// cached validators built from an older one are rebuilt
+func (vp *POCDefaultValidationProvider) validatorGeneration() int {
+	vp.mu.RLock()
+	defer vp.mu.RUnlock()
+	return vp.generation
+}
+
+// validateUserRules validates a user against the given map rules and expression rules with the validator
+// cached for a purpose, see userRulesValidate
+func (vp *POCDefaultValidationProvider) validateUserRules(ctx context.Context, purpose string, tenantID int, userRules map[string]string, expressions []compiledExpressionRule, user POCUser) error {
+	guard := vp.newPanicGuard(tenantID, user)
+	validate, err := vp.userRulesValidate(purpose, tenantID, userRules, expressions, guard)
+	if err != nil {
+		return err
+	}
+	defer vp.validatorCache.release(validate)
+	return guard.convert(validate.validate.StructCtx(ctx, &user))
+}
+
+// newValidate returns a validator holding the custom validations of a tenant chain, guarded through a slot,
+// and the translations of built-in tags, see ValidatorRegistry.newValidate
+func (vp *POCDefaultValidationProvider) newValidate(chain []int, slot *guardSlot) (*validator.Validate, error) {
+	validate, err := vp.validators.newValidate(chain, slot)
+	if err != nil {
+		return nil, err
+	}
+	if err := vp.messages.registerAll(validate); err != nil {
+		return nil, fmt.Errorf("registering translations: %w", err)
+	}
+	return validate, nil
 }
 
 // DecorateStructValidation returns a decorated struct validation function
@@ -85,17 +510,32 @@ func decorateStructValidation(customValidation ...validator.StructLevelFunc) val
 	}
 }
 
+// expressionRulesValidation returns a struct validation function evaluating the given expression rules.
+// An expression failing to evaluate (ex: exceeding its budget) is reported as a violation.
+func expressionRulesValidation(rules []compiledExpressionRule) validator.StructLevelFuncCtx {
+	return func(ctx context.Context, sl validator.StructLevel) {
+		for _, r := range rules {
+			ok, err := r.expression.Eval(ctx, sl.Current().Interface())
+			if err != nil || !ok {
+				sl.ReportError(sl.Current().FieldByName(r.Field).Interface(), r.Field, r.Field, r.Tag, r.Expression)
+			}
+		}
+	}
+}
+
 // DefaultUserValidation sets struct validation that will be shared between all tenants
 func (vp *POCDefaultValidationProvider) DefaultUserValidation(sl validator.StructLevel) {
 	user := sl.Current().Interface().(POCUser)
 
-	ValidateFieldWithTag(sl, user, user.FirstName, "FirstName", "max=10", vp.validationEntities)
+	// entities are registered at runtime, the map is replaced rather than changed
+	vp.mu.RLock()
+	entities := vp.validationEntities
+	vp.mu.RUnlock()
+	ValidateFieldWithTag(sl, user, user.FirstName, "FirstName", "max=10", entities)
 
 	// Validate Age - 18+
 	err := sl.Validator().Var(user.Age, "min=18")
 	if err != nil {
-		test := err.(validator.ValidationErrors)
-		test = test
 		sl.ReportError(user, "age", "Age", "min=18", "")
 	}
 
@@ -106,17 +546,20 @@ func (vp *POCDefaultValidationProvider) DefaultUserValidation(sl validator.Struc
 	}
 
 	// Validate Addresses
-	address := user.Addresses
-	for _, a := range address {
+	r := NewStructReporter(sl, vp.debug)
+	for i, a := range user.Addresses {
 		err = sl.Validator().Var(a.ZipCode, "required")
 		if err != nil {
-			sl.ReportError(a, "zipcode", "ZipCode", "required", "")
+			r.Field("Addresses").Index(i).Field("ZipCode").Report("required", "")
 		}
 	}
 
 	// Validate Account
 	account := user.Account
-
+	if account == nil {
+		sl.ReportError(account, "account", "Account", "required", "")
+		return
+	}
 	err = sl.Validator().Var(account.ID, "required")
 	if err != nil {
 		sl.ReportError(account, "id", "ID", "required", "")
@@ -151,43 +594,6 @@ func extractJSONTag(T any, name string) string {
 	return name
 }
 
-// findStructField looks for a field (f) in the given struct (s).
-// Function parameters:
-// s: pointer to the struct. If s is not a pointer to the struct, nil will be returned.
-// f: pointer to the field being looked for and should be a pointer to the actual struct field. If f is not a pointer to the field, nil will be returned.
-//
-// If found, the field info will be returned. Otherwise, nil will be returned.
-func findStructField_old(s interface{}, f interface{}) *reflect.StructField {
-	// Check if s (struct) is a pointer to an interface
-	var structValue reflect.Value
-	if reflect.ValueOf(s).Type().Kind() == reflect.Ptr || reflect.ValueOf(s).Type().Kind() == reflect.Interface {
-		structValue = reflect.ValueOf(s).Elem()
-	} else {
-		return nil
-	}
-	// Check if f (field) is a pointer to an interface
-	var fieldValue reflect.Value
-	if reflect.ValueOf(f).Type().Kind() == reflect.Ptr {
-		fieldValue = reflect.ValueOf(f)
-	} else {
-		return nil
-	}
-	// Set field pointer and type
-	fieldPointer := fieldValue.Pointer()
-	fieldType := fieldValue.Elem().Type()
-	for i := structValue.NumField() - 1; i >= 0; i-- {
-		structField := structValue.Type().Field(i)
-		// Compare if field and struct field are the same type
-		if structValue.Field(i).Type().Kind() == fieldType.Kind() {
-			// Compare if field and struct field are the same
-			if fieldPointer == structValue.Field(i).Addr().Pointer() {
-				return &structField
-			}
-		}
-	}
-	return nil
-}
-
 func DecorateRules(rules ...map[string]string) map[string]string {
 	decoratedRules := make(map[string]string)
 	for _, r := range rules {
@@ -199,11 +605,11 @@ func DecorateRules(rules ...map[string]string) map[string]string {
 }
 
 func ComposeDefaultUserRules() map[string]string {
-	rules := make(map[string]string)
-	appendRule("FirstName", "max=10", rules)
-	appendRule("Age", "min=18", rules)
-	appendRule("Email", "required,email", rules)
-	return rules
+	return Rules[POCUser]().
+		Field(func(u *POCUser) any { return &u.FirstName }).Max(10).
+		Field(func(u *POCUser) any { return &u.Age }).Min(18).
+		Field(func(u *POCUser) any { return &u.Email }).Required().Email().
+		MustBuild()
 }
 
 func ComposeDefaultAddressRules() map[string]string {
@@ -253,26 +659,59 @@ func ValidateFieldWithTag(sl validator.StructLevel, s, field interface{}, fieldN
 	}
 }
 
+// ComposeEntityFieldsMap maps the fields of the given structs, and of the structs they contain, to their JSON name.
+// Structs are keyed by package path and name, fields of embedded structs are promoted.
 func ComposeEntityFieldsMap(structs ...interface{}) map[string]map[string]string {
+	return composeEntityFieldsMap(NewFieldNamer(DefaultFieldNameTag), structs...)
+}
+
+// composeEntityFieldsMap maps the fields of the given structs, and of the structs they contain, to their name
+func composeEntityFieldsMap(namer *FieldNamer, structs ...interface{}) map[string]map[string]string {
 	entityFields := make(map[string]map[string]string)
-	for i := 0; i < len(structs); i++ {
-		structValue := reflect.ValueOf(structs[i])
-		if reflect.ValueOf(structValue).Type().Kind() != reflect.Struct {
+	for _, s := range structs {
+		t := reflect.TypeOf(s)
+		if t == nil || t.Kind() != reflect.Struct {
 			return nil
 		}
-		fieldsMap := make(map[string]string)
-		for i := 0; i < structValue.NumField(); i++ {
-			structField := structValue.Type().Field(i)
-			fieldName := structField.Name
-			fieldJSONTag := extractJSONTag(structValue.Interface(), fieldName)
-			fieldsMap[fieldName] = fieldJSONTag
-		}
-		entityFields[fmt.Sprintf("%s.%s", structValue.Type().PkgPath(), structValue.Type().Name())] = fieldsMap
+		addEntityFields(namer, t, entityFields)
 	}
 	return entityFields
 }
 
+func addEntityFields(namer *FieldNamer, t reflect.Type, entityFields map[string]map[string]string) {
+	key := fmt.Sprintf("%s.%s", t.PkgPath(), t.Name())
+	if _, ok := entityFields[key]; ok {
+		return
+	}
+	fieldsMap := make(map[string]string)
+	entityFields[key] = fieldsMap
+	addStructFields(namer, t, fieldsMap, entityFields)
+}
+
+func addStructFields(namer *FieldNamer, t reflect.Type, fieldsMap map[string]string, entityFields map[string]map[string]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		nested := structType(f.Type)
+		if namer.promoted(f) {
+			addStructFields(namer, nested, fieldsMap, entityFields)
+			continue
+		}
+		name, ok := namer.Name(f)
+		if !ok {
+			// fields excluded from the encoding keep their Go name
+			name = f.Name
+		}
+		fieldsMap[f.Name] = name
+		if nested != nil {
+			addEntityFields(namer, nested, entityFields)
+		}
+	}
+}
+
 // ValidateFieldStartsWithS implements validator.Func
 func ValidateFieldStartsWithS(fl validator.FieldLevel) bool {
-	return fl.Field().String()[0:1] == "S"
+	return strings.HasPrefix(fl.Field().String(), "S")
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// validatorCache holds the validators built for the tenants, so that validations do not build one every time.
+// Validators are kept by purpose and tenant chain along with a fingerprint of the rules they were built from,
+// they are rebuilt once the fingerprint changes, ex: when the rules of a tenant are updated.
+// A validator is used by one validation at a time since its functions recover their panics through the guard
+// of that validation, concurrent validations of a tenant each get their own.
+type validatorCache struct {
+	mu    sync.Mutex
+	pools map[string]*validatorPool
+}
+
+// validatorPool holds the validators built from the rules identified by a fingerprint that are not in use
+type validatorPool struct {
+	fingerprint string
+	free        []*cachedValidator
+}
+
+// cachedValidator is a validator of the cache along with the slot of the guard of the validation using it
+type cachedValidator struct {
+	validate *validator.Validate
+	stripped map[reflect.Type][]strippedTag // tags of disabled rules removed from the rules of the current validation
+	slot     *guardSlot
+	pool     *validatorPool
+}
+
+// newValidatorCache returns an empty validatorCache
+func newValidatorCache() *validatorCache {
+	return &validatorCache{pools: make(map[string]*validatorPool)}
+}
+
+// acquire returns a validator of a purpose and a tenant chain built from the rules identified by fingerprint
+// for the validation of a guard, build is called outside of the lock when none is free.
+// The validator must be released once the validation is done.
+func (c *validatorCache) acquire(purpose string, chain []int, fingerprint string, guard *panicGuard, build func(slot *guardSlot) (*cachedValidator, error)) (*cachedValidator, error) {
+	key := fmt.Sprint(purpose, chain)
+	c.mu.Lock()
+	pool, ok := c.pools[key]
+	if !ok || pool.fingerprint != fingerprint {
+		// validators built from other rules are dropped once released
+		pool = &validatorPool{fingerprint: fingerprint}
+		c.pools[key] = pool
+	}
+	var cached *cachedValidator
+	if n := len(pool.free); n > 0 {
+		cached, pool.free = pool.free[n-1], pool.free[:n-1]
+	}
+	c.mu.Unlock()
+	if cached == nil {
+		slot := &guardSlot{}
+		built, err := build(slot)
+		if err != nil {
+			return nil, err
+		}
+		cached, built.slot, built.pool = built, slot, pool
+	}
+	cached.slot.guard = guard
+	return cached, nil
+}
+
+// release makes a validator available to other validations
+func (c *validatorCache) release(cached *cachedValidator) {
+	cached.slot.guard = nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached.pool.free = append(cached.pool.free, cached)
+}
+
+// validatorFingerprint identifies the rules a validator is built from: map rules are printed sorted by key,
+// expression rules by their source
+func validatorFingerprint(generation int, rules interface{}, expressions []compiledExpressionRule) string {
+	var b strings.Builder
+	fmt.Fprint(&b, generation, rules)
+	for _, r := range expressions {
+		fmt.Fprint(&b, r.ExpressionRule)
+	}
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatorCache(t *testing.T) {
+	vp := newTestProvider()
+	ctx := context.WithValue(context.Background(), "tenant", 1)
+	user := provideValidUser()
+	user.Age = 25
+
+	// validators are built once and reused by the following validations
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(ctx, user))
+	assert.NoError(t, vp.ValidateUserWithRulesValidation(ctx, user))
+	assert.NoError(t, vp.ValidateUserWithStructValidation(ctx, user))
+	assert.NoError(t, vp.ValidateUserWithStructValidation(ctx, user))
+	assert.Len(t, vp.validatorCache.pools, 2)
+	assert.Len(t, vp.validatorCache.pools["rules[1]"].free, 1)
+	assert.Len(t, vp.validatorCache.pools["struct[1]"].free, 1)
+
+	// updated rules rebuild the validator
+	vp.SetTenantRules("1", map[string]string{"Age": "min=30"})
+	err := vp.ValidateUserWithRulesValidation(ctx, user)
+	assert.Error(t, err)
+	assert.Equal(t, "min", err.(ValidationErrors)[0].Tag())
+	vp.SetTenantValidator("1", NewTenantBUserValidator())
+	assert.Error(t, vp.ValidateUserWithStructValidation(ctx, user))
+
+	// concurrent validations each use their own validator
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(age uint8) {
+			defer wg.Done()
+			user := provideValidUser()
+			user.Age = age
+			err := vp.ValidateUserWithRulesValidation(ctx, user)
+			assert.Equal(t, age < 30, err != nil)
+		}(uint8(26 + i))
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, len(vp.validatorCache.pools["rules[1]"].free), 8)
+}
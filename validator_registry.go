@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// globalScope is the registry scope shared by all tenants.
+const globalScope = 0
+
+// ErrRegistrySealed is returned when a custom validation is registered after validation has started.
+var ErrRegistrySealed = errors.New("validator registry is sealed: custom validations must be registered at startup")
+
+// customValidation is a custom validation function declared under a tag
+type customValidation struct {
+	tag string
+	fn  validator.Func
+}
+
+// customAlias is an alias mapping a tag to a set of existing tags
+type customAlias struct {
+	alias string
+	tags  string
+}
+
+// registryScope holds the custom validations and aliases declared for one scope (global or a single tenant)
+type registryScope struct {
+	validations []customValidation
+	aliases     []customAlias
+}
+
+// ValidatorRegistry holds custom validation functions and aliases declared once at startup,
+// either globally or scoped to a tenant.
+// A tenant only ever sees the global declarations plus its own, so tags declared for one tenant
+// are unknown to every other tenant.
+// The registry is sealed the first time a validator is built from it, after that registration fails.
+type ValidatorRegistry struct {
+	mu     sync.Mutex
+	scopes map[int]*registryScope
+	sealed bool
+}
+
+// NewValidatorRegistry returns a new, empty ValidatorRegistry
+func NewValidatorRegistry() *ValidatorRegistry {
+	return &ValidatorRegistry{
+		scopes: make(map[int]*registryScope),
+	}
+}
+
+// RegisterValidation declares a custom validation available to all tenants
+func (r *ValidatorRegistry) RegisterValidation(tag string, fn validator.Func) error {
+	return r.registerValidation(globalScope, tag, fn)
+}
+
+// RegisterTenantValidation declares a custom validation only available to the given tenant
+func (r *ValidatorRegistry) RegisterTenantValidation(tenantID int, tag string, fn validator.Func) error {
+	if tenantID == globalScope {
+		return fmt.Errorf("tenant ID %d is reserved for global validations", globalScope)
+	}
+	return r.registerValidation(tenantID, tag, fn)
+}
+
+// RegisterAlias declares an alias available to all tenants
+func (r *ValidatorRegistry) RegisterAlias(alias, tags string) error {
+	return r.registerAlias(globalScope, alias, tags)
+}
+
+// RegisterTenantAlias declares an alias only available to the given tenant
+func (r *ValidatorRegistry) RegisterTenantAlias(tenantID int, alias, tags string) error {
+	if tenantID == globalScope {
+		return fmt.Errorf("tenant ID %d is reserved for global aliases", globalScope)
+	}
+	return r.registerAlias(tenantID, alias, tags)
+}
+
+func (r *ValidatorRegistry) registerValidation(scopeID int, tag string, fn validator.Func) error {
+	if len(tag) == 0 || fn == nil {
+		return fmt.Errorf("custom validation requires a tag and a function")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sealed {
+		return ErrRegistrySealed
+	}
+	if err := r.checkTagAvailable(scopeID, tag); err != nil {
+		return err
+	}
+	scope := r.scope(scopeID)
+	scope.validations = append(scope.validations, customValidation{tag: tag, fn: fn})
+	return nil
+}
+
+func (r *ValidatorRegistry) registerAlias(scopeID int, alias, tags string) error {
+	if len(alias) == 0 || len(tags) == 0 {
+		return fmt.Errorf("alias requires a name and the tags it stands for")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sealed {
+		return ErrRegistrySealed
+	}
+	if err := r.checkTagAvailable(scopeID, alias); err != nil {
+		return err
+	}
+	scope := r.scope(scopeID)
+	scope.aliases = append(scope.aliases, customAlias{alias: alias, tags: tags})
+	return nil
+}
+
+// checkTagAvailable makes sure a tag is not declared twice in the same scope
+// and that a tenant does not shadow a global tag (or the opposite).
+func (r *ValidatorRegistry) checkTagAvailable(scopeID int, tag string) error {
+	for id, scope := range r.scopes {
+		if scopeID != globalScope && id != globalScope && id != scopeID {
+			// other tenants may reuse the same tag
+			continue
+		}
+		if scope.declares(tag) {
+			return fmt.Errorf("tag %q is already registered", tag)
+		}
+	}
+	return nil
+}
+
+func (r *ValidatorRegistry) scope(scopeID int) *registryScope {
+	scope, ok := r.scopes[scopeID]
+	if !ok {
+		scope = &registryScope{}
+		r.scopes[scopeID] = scope
+	}
+	return scope
+}
+
+func (s *registryScope) declares(tag string) bool {
+	for _, v := range s.validations {
+		if v.tag == tag {
+			return true
+		}
+	}
+	for _, a := range s.aliases {
+		if a.alias == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// NewValidate returns a validator containing the global declarations and the ones scoped to the given tenant.
+// Calling NewValidate seals the registry.
+func (r *ValidatorRegistry) NewValidate(tenantID int) (*validator.Validate, error) {
+	return r.newValidate([]int{tenantID}, nil)
+}
+
+// newValidate is NewValidate for a tenant chain, root first, with custom validations recovering their panics
+// through the guard of a slot, nil for none
+func (r *ValidatorRegistry) newValidate(chain []int, slot *guardSlot) (*validator.Validate, error) {
+	r.mu.Lock()
+	r.sealed = true
+	r.mu.Unlock()
+	return r.build(chain, slot)
+}
+
+// build returns a validator containing the global declarations and the ones scoped to the tenants of a chain,
+// root first so that tenants override the declarations of their ancestors, without sealing the registry.
+// It is meant for checks done before validation starts, like linting rules.
+// The declarations are copied under the lock, the validator is built outside of it.
+func (r *ValidatorRegistry) build(chain []int, slot *guardSlot) (*validator.Validate, error) {
+	var scopes []registryScope
+	r.mu.Lock()
+	for _, scopeID := range chainScopes(chain) {
+		if scope, ok := r.scopes[scopeID]; ok {
+			scopes = append(scopes, *scope)
+		}
+	}
+	r.mu.Unlock()
+	validate := validator.New()
+	for _, scope := range scopes {
+		for _, v := range scope.validations {
+			if err := validate.RegisterValidation(v.tag, slot.fieldFunc(v.tag, v.fn)); err != nil {
+				return nil, err
+			}
+		}
+		for _, a := range scope.aliases {
+			validate.RegisterAlias(a.alias, a.tags)
+		}
+	}
+	return validate, nil
+}
+
+// chainScopes returns the scopes of a tenant chain: the global one, then the tenants of the chain
+func chainScopes(chain []int) []int {
+	scopes := []int{globalScope}
+	for _, scopeID := range chain {
+		if scopeID != globalScope {
+			scopes = append(scopes, scopeID)
+		}
+	}
+	return scopes
+}
+
+// tags returns the sorted custom tags and aliases available to a tenant chain
+func (r *ValidatorRegistry) tags(chain []int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tags []string
+	for _, scopeID := range chainScopes(chain) {
+		if scope, ok := r.scopes[scopeID]; ok {
+			for _, v := range scope.validations {
+				tags = append(tags, v.tag)
+			}
+			for _, a := range scope.aliases {
+				tags = append(tags, a.alias+"="+a.tags)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
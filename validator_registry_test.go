@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatorRegistryTenantScopes(t *testing.T) {
+	registry := NewValidatorRegistry()
+	assert.NoError(t, registry.RegisterAlias("canadian_postal_code", "postcode_iso3166_alpha2=CA"))
+	assert.NoError(t, registry.RegisterTenantValidation(1, "isprovincename", isProvinceName))
+	assert.NoError(t, registry.RegisterTenantValidation(2, "isprovincecode", isProvinceCode))
+
+	tenantA, err := registry.NewValidate(1)
+	assert.NoError(t, err)
+	assert.NoError(t, tenantA.Var("Quebec", "isprovincename"))
+	assert.NoError(t, tenantA.Var("T2Y5G1", "canadian_postal_code"))
+
+	tenantB, err := registry.NewValidate(2)
+	assert.NoError(t, err)
+	assert.NoError(t, tenantB.Var("QC", "isprovincecode"))
+	// tenant A tags are unknown to tenant B
+	assert.Panics(t, func() { _ = tenantB.Var("Quebec", "isprovincename") })
+}
+
+func TestValidatorRegistryRejectsDuplicates(t *testing.T) {
+	registry := NewValidatorRegistry()
+	assert.NoError(t, registry.RegisterValidation("isprovincecode", isProvinceCode))
+	assert.Error(t, registry.RegisterValidation("isprovincecode", isProvinceCode))
+	// a tenant cannot shadow a global tag
+	assert.Error(t, registry.RegisterTenantValidation(1, "isprovincecode", isProvinceCode))
+	// but two tenants can declare the same tag
+	assert.NoError(t, registry.RegisterTenantValidation(1, "startswiths", ValidateFieldStartsWithS))
+	assert.NoError(t, registry.RegisterTenantValidation(2, "startswiths", ValidateFieldStartsWithS))
+	assert.Error(t, registry.RegisterValidation("startswiths", ValidateFieldStartsWithS))
+}
+
+func TestValidatorRegistrySealed(t *testing.T) {
+	registry := NewValidatorRegistry()
+	_, err := registry.NewValidate(1)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, registry.RegisterValidation("isprovincecode", isProvinceCode), ErrRegistrySealed)
+	assert.ErrorIs(t, registry.RegisterTenantAlias(1, "postal", "required"), ErrRegistrySealed)
+}